@@ -2,10 +2,12 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -13,9 +15,11 @@ import (
 	"go.uber.org/zap"
 
 	"streamkit/internal/api/handlers"
+	"streamkit/internal/api/metrics"
 	"streamkit/internal/api/repos"
 	"streamkit/internal/api/routes"
 	"streamkit/internal/api/service"
+	"streamkit/internal/shared/keyseal"
 )
 
 func main() {
@@ -65,17 +69,53 @@ func main() {
 
 	// Initialize layers with logger
 	streamRepo := repos.NewStreamRepository(db, logger)
-	streamService := service.NewStreamService(streamRepo, logger)
+	profileRepo := repos.NewProfileRepository(db, logger)
+	recordingRepo := repos.NewRecordingRepository(db, logger)
+	sessionRepo := repos.NewSessionRepository(db, logger)
+	webhookRepo := repos.NewWebhookRepository(db, logger)
+	userRepo := repos.NewUserRepository(db, logger)
+	apiKeyRepo := repos.NewAPIKeyRepository(db, logger)
+	organizationRepo := repos.NewOrganizationRepository(db, logger)
+	keyRepo := repos.NewKeyRepository(db, logger)
+
+	// Key encryption key shared with the encoder, as 64 hex characters.
+	// Streams cannot have encryption enabled, and their keys cannot be served,
+	// when it is unset.
+	var keyring *keyseal.Keyring
+	if keyEncryptionKey := getEnv("HLS_KEY_ENCRYPTION_KEY", ""); keyEncryptionKey != "" {
+		keyring, err = keyseal.New(keyEncryptionKey)
+		if err != nil {
+			logger.Fatal("Invalid HLS_KEY_ENCRYPTION_KEY", zap.Error(err))
+		}
+	}
+
+	streamService := service.NewStreamService(streamRepo, profileRepo, recordingRepo, sessionRepo,
+		keyRepo, keyring, logger)
+	profileService := service.NewProfileService(profileRepo, logger)
+	webhookService := service.NewWebhookService(webhookRepo, logger)
+	authService := service.NewAuthService(userRepo, apiKeyRepo, logger)
+	organizationService := service.NewOrganizationService(organizationRepo, logger)
 	streamHandler := handlers.NewStreamHandler(streamService, logger)
+	profileHandler := handlers.NewProfileHandler(profileService, logger)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, logger)
+	adminToken := getEnv("API_ADMIN_TOKEN", "")
+	authHandler := handlers.NewAuthHandler(authService, adminToken, logger)
+	organizationHandler := handlers.NewOrganizationHandler(organizationService, adminToken, logger)
 
 	// Setup router
 	router := mux.NewRouter()
 
 	// Setup routes
 	routes.SetupStreamRoutes(router, streamHandler)
+	routes.SetupProfileRoutes(router, profileHandler)
+	routes.SetupWebhookRoutes(router, webhookHandler)
+	routes.SetupAuthRoutes(router, authHandler)
+	routes.SetupOrganizationRoutes(router, organizationHandler)
 
-	// Add middleware for CORS
+	// Add middleware for request metrics, CORS, then API key authentication
+	router.Use(metrics.Middleware)
 	router.Use(corsMiddleware)
+	router.Use(authMiddleware(authService, logger))
 
 	// Health check endpoint
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -85,6 +125,9 @@ func main() {
 		w.Write([]byte(`{"status": "ok", "message": "StreamKit API is running"}`))
 	}).Methods("GET")
 
+	// Prometheus metrics
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
 	// Get port from environment
 	port := getEnv("PORT", "8080")
 	serverAddr := ":" + port
@@ -124,3 +167,45 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// adminRoutes are the POST routes authenticated with API_ADMIN_TOKEN instead
+// of an API key
+var adminRoutes = map[string]bool{
+	"/api/users":         true,
+	"/api/organizations": true,
+}
+
+// authMiddleware requires a bearer API key on every /api/ route and stores
+// the authenticated user in the request context. User and organization
+// creation are exempt because their handlers authenticate the admin token.
+func authMiddleware(authService *service.AuthService, logger *zap.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" || !strings.HasPrefix(r.URL.Path, "/api/") ||
+				(r.Method == "POST" && adminRoutes[r.URL.Path]) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			user, err := authService.Authenticate(key)
+			if err != nil {
+				if errors.Is(err, service.ErrUnauthorized) {
+					logger.Warn("Rejected unauthenticated request",
+						zap.String("method", r.Method),
+						zap.String("url", r.URL.Path),
+						zap.String("remote_addr", r.RemoteAddr),
+					)
+					w.Header().Set("WWW-Authenticate", `Bearer realm="streamkit"`)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				} else {
+					logger.Error("Error authenticating request", zap.Error(err))
+					http.Error(w, "Failed to authenticate request", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(handlers.WithUser(r.Context(), user)))
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"streamkit/internal/api/models"
+
+	"go.uber.org/zap"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// WithUser returns a context carrying the authenticated user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// CurrentUser returns the authenticated user of a request, or nil
+func CurrentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
+}
+
+// requireUser returns the authenticated user, writing 401 if there is none
+func requireUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	return user, true
+}
+
+// requireAdmin checks the request's bearer token against the admin token,
+// writing 403 if it does not match. An empty adminToken rejects everything.
+func requireAdmin(w http.ResponseWriter, r *http.Request, adminToken string, logger *zap.Logger) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if adminToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		logger.Warn("Rejected admin request without admin token",
+			zap.String("url", r.URL.Path),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"streamkit/internal/api/models"
+	"streamkit/internal/api/service"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type AuthHandler struct {
+	service    *service.AuthService
+	adminToken string
+	logger     *zap.Logger
+}
+
+// NewAuthHandler creates the handler for users and API keys. Users can only
+// be created with adminToken; an empty adminToken disables user creation.
+func NewAuthHandler(service *service.AuthService, adminToken string, logger *zap.Logger) *AuthHandler {
+	logger.Info("Initializing AuthHandler")
+	return &AuthHandler{service: service, adminToken: adminToken, logger: logger}
+}
+
+// CreateUser handles POST /api/users, authenticated with the admin token
+func (h *AuthHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminToken, h.logger) {
+		return
+	}
+
+	var user models.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		h.logger.Error("Error decoding request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	apiKey, err := h.service.CreateUser(&user)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUser) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if err.Error() == "user already exists" {
+			http.Error(w, "User already exists", http.StatusConflict)
+		} else if err.Error() == "organization not found" {
+			http.Error(w, "Organization not found", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The API key is only ever returned here
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		User   *models.User   `json:"user"`
+		APIKey *models.APIKey `json:"api_key"`
+	}{&user, apiKey})
+}
+
+// GetCurrentUser handles GET /api/me
+func (h *AuthHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// CreateAPIKey handles POST /api/keys
+func (h *AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.logger.Error("Error decoding request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	apiKey, err := h.service.CreateAPIKey(user.ID, request.Name)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUser) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to create API key: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The key is only ever returned here
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(apiKey)
+}
+
+// GetAPIKeys handles GET /api/keys
+func (h *AuthHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	apiKeys, err := h.service.GetAPIKeys(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to get API keys: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiKeys)
+}
+
+// RevokeAPIKey handles DELETE /api/keys/{id}
+func (h *AuthHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RevokeAPIKey(user.ID, id); err != nil {
+		if err.Error() == "api key not found" {
+			http.Error(w, "API key not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to revoke API key: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
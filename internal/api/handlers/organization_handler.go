@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"streamkit/internal/api/models"
+	"streamkit/internal/api/service"
+
+	"go.uber.org/zap"
+)
+
+type OrganizationHandler struct {
+	service    *service.OrganizationService
+	adminToken string
+	logger     *zap.Logger
+}
+
+// NewOrganizationHandler creates the handler for organizations. Like users,
+// organizations can only be created with adminToken.
+func NewOrganizationHandler(
+	service *service.OrganizationService,
+	adminToken string,
+	logger *zap.Logger,
+) *OrganizationHandler {
+	logger.Info("Initializing OrganizationHandler")
+	return &OrganizationHandler{service: service, adminToken: adminToken, logger: logger}
+}
+
+// CreateOrganization handles POST /api/organizations, authenticated with the
+// admin token
+func (h *OrganizationHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r, h.adminToken, h.logger) {
+		return
+	}
+
+	var organization models.Organization
+	if err := json.NewDecoder(r.Body).Decode(&organization); err != nil {
+		h.logger.Error("Error decoding request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.CreateOrganization(&organization); err != nil {
+		if errors.Is(err, service.ErrInvalidOrganization) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if err.Error() == "organization already exists" {
+			http.Error(w, "Organization already exists", http.StatusConflict)
+		} else {
+			http.Error(w, "Failed to create organization: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(organization)
+}
+
+// GetCurrentOrganization handles GET /api/organization
+func (h *OrganizationHandler) GetCurrentOrganization(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	organization, err := h.service.GetOrganization(user.OrganizationID)
+	if err != nil {
+		http.Error(w, "Failed to get organization: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(organization)
+}
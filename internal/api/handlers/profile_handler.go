@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"streamkit/internal/api/models"
+	"streamkit/internal/api/service"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type ProfileHandler struct {
+	service *service.ProfileService
+	logger  *zap.Logger
+}
+
+func NewProfileHandler(service *service.ProfileService, logger *zap.Logger) *ProfileHandler {
+	logger.Info("Initializing ProfileHandler")
+	return &ProfileHandler{service: service, logger: logger}
+}
+
+// CreateProfile handles POST /api/profiles
+func (h *ProfileHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	h.logger.Info("Creating encoding profile", zap.String("remote_addr", r.RemoteAddr))
+
+	// Fields omitted from the request keep the encoder's defaults
+	profile := models.EncodingProfile{
+		Preset:          "ultrafast",
+		Tune:            "zerolatency",
+		SegmentDuration: 3,
+		PlaylistSize:    60,
+		Renditions:      []string{},
+		Packaging:       models.PackagingHLS,
+	}
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		h.logger.Error("Error decoding request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	profile.OrganizationID = user.OrganizationID
+
+	if err := h.service.CreateProfile(&profile); err != nil {
+		if errors.Is(err, service.ErrInvalidProfile) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			h.logger.Error("Error creating encoding profile", zap.Error(err))
+			http.Error(w, "Failed to create encoding profile: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.logger.Info("Successfully created encoding profile", zap.Int("id", profile.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(profile)
+}
+
+// GetProfile handles GET /api/profiles/{id}
+func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.logger.Warn("Invalid profile ID", zap.String("id", vars["id"]))
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := h.service.GetProfileByID(id, user.OrganizationID)
+	if err != nil {
+		if err.Error() == "encoding profile not found" {
+			http.Error(w, "Encoding profile not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to get encoding profile: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// GetAllProfiles handles GET /api/profiles
+func (h *ProfileHandler) GetAllProfiles(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	h.logger.Info("Getting all encoding profiles")
+
+	profiles, err := h.service.GetAllProfiles(user.OrganizationID)
+	if err != nil {
+		http.Error(w, "Failed to get encoding profiles: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// UpdateProfile handles PUT /api/profiles/{id}
+func (h *ProfileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.logger.Warn("Invalid profile ID", zap.String("id", vars["id"]))
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("Updating encoding profile", zap.Int("id", id))
+
+	// Start from the stored profile so omitted fields are left unchanged
+	profile, err := h.service.GetProfileByID(id, user.OrganizationID)
+	if err != nil {
+		if err.Error() == "encoding profile not found" {
+			http.Error(w, "Encoding profile not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to get encoding profile: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(profile); err != nil {
+		h.logger.Error("Error decoding request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	profile.ID = id
+	profile.OrganizationID = user.OrganizationID
+
+	if err := h.service.UpdateProfile(profile); err != nil {
+		if errors.Is(err, service.ErrInvalidProfile) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if err.Error() == "encoding profile not found" {
+			http.Error(w, "Encoding profile not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to update encoding profile: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.logger.Info("Successfully updated encoding profile", zap.Int("id", id))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// DeleteProfile handles DELETE /api/profiles/{id}
+func (h *ProfileHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.logger.Warn("Invalid profile ID", zap.String("id", vars["id"]))
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteProfile(id, user.OrganizationID); err != nil {
+		if err.Error() == "encoding profile not found" {
+			http.Error(w, "Encoding profile not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete encoding profile: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.logger.Info("Successfully deleted encoding profile", zap.Int("id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,11 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"streamkit/internal/api/models"
 	"streamkit/internal/api/service"
+	"streamkit/internal/shared/keyseal"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -30,6 +36,11 @@ func (h *StreamHandler) CreateStream(w http.ResponseWriter, r *http.Request) {
 		zap.String("remote_addr", r.RemoteAddr),
 	)
 
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	var stream models.LiveStream
 	if err := json.NewDecoder(r.Body).Decode(&stream); err != nil {
 		h.logger.Error("Error decoding request body", zap.Error(err))
@@ -40,17 +51,25 @@ func (h *StreamHandler) CreateStream(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("Received stream data",
 		zap.String("title", stream.Title),
 		zap.String("stream_name", stream.StreamName),
-		zap.String("created_by", stream.StreamCreatedBy),
+		zap.Int("owner_id", user.ID),
 	)
 
 	// Validate required fields
-	if stream.Title == "" || stream.StreamName == "" || stream.StreamCreatedBy == "" {
+	if stream.Title == "" || stream.StreamName == "" {
 		h.logger.Warn("Validation failed - missing required fields")
-		http.Error(w, "Title, StreamName, and StreamCreatedBy are required", http.StatusBadRequest)
+		http.Error(w, "Title and StreamName are required", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.service.CreateStream(&stream); err != nil {
+	if err := h.service.CreateStream(&stream, user); err != nil {
+		if err.Error() == "encoding profile not found" {
+			http.Error(w, "Encoding profile not found", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidStreamEncryption) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		h.logger.Error("Error creating stream", zap.Error(err))
 		http.Error(w, "Failed to create stream: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -79,9 +98,14 @@ func (h *StreamHandler) GetStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	h.logger.Info("Getting stream by ID", zap.Int("id", id))
 
-	stream, err := h.service.GetStreamByID(id)
+	stream, err := h.service.GetStreamByID(id, user)
 	if err != nil {
 		if err.Error() == "stream not found" {
 			h.logger.Warn("Stream not found", zap.Int("id", id))
@@ -109,9 +133,14 @@ func (h *StreamHandler) GetStreamByKey(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	streamKey := vars["streamKey"]
 
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	h.logger.Info("Getting stream by key", zap.String("stream_key", streamKey))
 
-	stream, err := h.service.GetStreamByStreamKey(streamKey)
+	stream, err := h.service.GetStreamByStreamKey(streamKey, user)
 	if err != nil {
 		if err.Error() == "stream not found" {
 			h.logger.Warn("Stream not found", zap.String("stream_key", streamKey))
@@ -134,21 +163,83 @@ func (h *StreamHandler) GetStreamByKey(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(fullStream)
 }
 
-// GetAllStreams handles GET /api/streams
+// GetAllStreams handles GET /api/streams?status=&stream_created_by=
+// &created_after=&created_before=&q=&sort=&order=&limit=&cursor=
 func (h *StreamHandler) GetAllStreams(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("Getting all streams")
 
-	streams, err := h.service.GetAllStreamsWithFullURLs()
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	query, err := parseStreamListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.service.ListStreams(user, query)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidStreamQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		h.logger.Error("Error getting all streams", zap.Error(err))
 		http.Error(w, "Failed to get streams: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Info("Successfully retrieved streams", zap.Int("count", len(streams)))
+	h.logger.Info("Successfully retrieved streams", zap.Int("count", len(page.Data)))
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(streams)
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseStreamListQuery reads the listing parameters of GET /api/streams.
+// Timestamps are RFC 3339.
+func parseStreamListQuery(r *http.Request) (*models.StreamListQuery, error) {
+	values := r.URL.Query()
+	query := &models.StreamListQuery{
+		Status:    values.Get("status"),
+		CreatedBy: values.Get("stream_created_by"),
+		Search:    strings.TrimSpace(values.Get("q")),
+		Sort:      values.Get("sort"),
+		Order:     values.Get("order"),
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid limit", service.ErrInvalidStreamQuery)
+		}
+		query.Limit = limit
+	}
+
+	for name, target := range map[string]**time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+	} {
+		if value := values.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s must be an RFC 3339 timestamp", service.ErrInvalidStreamQuery, name)
+			}
+			// created_at is stored without a time zone, in UTC
+			parsed = parsed.UTC()
+			*target = &parsed
+		}
+	}
+
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := service.DecodeStreamCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		query.After = cursor
+	}
+
+	return query, nil
 }
 
 // UpdateStream handles PUT /api/streams/{id}
@@ -161,21 +252,40 @@ func (h *StreamHandler) UpdateStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	h.logger.Info("Updating stream", zap.Int("id", id))
 
-	var stream models.LiveStream
-	if err := json.NewDecoder(r.Body).Decode(&stream); err != nil {
+	// Status shadows the stream's own field so a status in the body is seen
+	var request struct {
+		models.LiveStream
+		Status *string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		h.logger.Error("Error decoding request body", zap.Error(err))
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if request.Status != nil {
+		http.Error(w, "status cannot be updated here; use PATCH /api/streams/{id}/status", http.StatusBadRequest)
+		return
+	}
 
+	stream := request.LiveStream
 	stream.ID = id
+	stream.OrganizationID = user.OrganizationID
 
-	if err := h.service.UpdateStream(&stream); err != nil {
+	if err := h.service.UpdateStream(&stream, user); err != nil {
 		if err.Error() == "stream not found" {
 			h.logger.Warn("Stream not found", zap.Int("id", id))
 			http.Error(w, "Stream not found", http.StatusNotFound)
+		} else if err.Error() == "encoding profile not found" {
+			http.Error(w, "Encoding profile not found", http.StatusBadRequest)
+		} else if errors.Is(err, service.ErrInvalidStreamEncryption) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		} else {
 			h.logger.Error("Error updating stream",
 				zap.Int("id", id),
@@ -187,7 +297,7 @@ func (h *StreamHandler) UpdateStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the updated stream with full URLs
-	updatedStream, err := h.service.GetStreamByID(id)
+	updatedStream, err := h.service.GetStreamByID(id, user)
 	if err != nil {
 		h.logger.Error("Error getting updated stream",
 			zap.Int("id", id),
@@ -215,9 +325,14 @@ func (h *StreamHandler) DeleteStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	h.logger.Info("Deleting stream", zap.Int("id", id))
 
-	if err := h.service.DeleteStream(id); err != nil {
+	if err := h.service.DeleteStream(id, user); err != nil {
 		if err.Error() == "stream not found" {
 			h.logger.Warn("Stream not found", zap.Int("id", id))
 			http.Error(w, "Stream not found", http.StatusNotFound)
@@ -245,10 +360,16 @@ func (h *StreamHandler) UpdateStreamStatus(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	h.logger.Info("Updating status for stream", zap.Int("id", id))
 
 	var statusUpdate struct {
 		Status string `json:"status"`
+		Reason string `json:"reason"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&statusUpdate); err != nil {
 		h.logger.Error("Error decoding status update", zap.Error(err))
@@ -264,10 +385,19 @@ func (h *StreamHandler) UpdateStreamStatus(w http.ResponseWriter, r *http.Reques
 
 	h.logger.Info("Updating status", zap.String("status", statusUpdate.Status))
 
-	if err := h.service.UpdateStreamStatus(id, statusUpdate.Status); err != nil {
+	err = h.service.UpdateStreamStatus(id, user, statusUpdate.Status, statusUpdate.Reason)
+	if err != nil {
 		if err.Error() == "stream not found" {
 			h.logger.Warn("Stream not found", zap.Int("id", id))
 			http.Error(w, "Stream not found", http.StatusNotFound)
+		} else if errors.Is(err, service.ErrInvalidStreamStatus) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, service.ErrStreamStatusConflict) {
+			h.logger.Warn("Rejected stream status change",
+				zap.Int("id", id),
+				zap.Error(err),
+			)
+			http.Error(w, err.Error(), http.StatusConflict)
 		} else {
 			h.logger.Error("Error updating stream status",
 				zap.Int("id", id),
@@ -279,7 +409,7 @@ func (h *StreamHandler) UpdateStreamStatus(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Get the updated stream
-	stream, err := h.service.GetStreamByID(id)
+	stream, err := h.service.GetStreamByID(id, user)
 	if err != nil {
 		h.logger.Error("Error getting updated stream",
 			zap.Int("id", id),
@@ -296,3 +426,251 @@ func (h *StreamHandler) UpdateStreamStatus(w http.ResponseWriter, r *http.Reques
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(fullStream)
 }
+
+// GetStreamStatusHistory handles GET /api/streams/{id}/status-history?limit=
+func (h *StreamHandler) GetStreamStatusHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.logger.Warn("Invalid stream ID", zap.String("id", vars["id"]))
+		http.Error(w, "Invalid stream ID", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	history, err := h.service.GetStreamStatusHistory(id, user, limit)
+	if err != nil {
+		if err.Error() == "stream not found" {
+			h.logger.Warn("Stream not found", zap.Int("id", id))
+			http.Error(w, "Stream not found", http.StatusNotFound)
+		} else {
+			h.logger.Error("Error getting stream status history",
+				zap.Int("id", id),
+				zap.Error(err),
+			)
+			http.Error(w, "Failed to get status history: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// GetStreamSessions handles
+// GET /api/streams/{id}/sessions?started_after=&started_before=&limit=
+func (h *StreamHandler) GetStreamSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.logger.Warn("Invalid stream ID", zap.String("id", vars["id"]))
+		http.Error(w, "Invalid stream ID", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	values := r.URL.Query()
+	limit := 0
+	if value := values.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var startedAfter, startedBefore *time.Time
+	for name, target := range map[string]**time.Time{
+		"started_after":  &startedAfter,
+		"started_before": &startedBefore,
+	} {
+		if value := values.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			// started_at is stored without a time zone, in UTC
+			parsed = parsed.UTC()
+			*target = &parsed
+		}
+	}
+
+	sessions, err := h.service.GetStreamSessions(id, user, startedAfter, startedBefore, limit)
+	if err != nil {
+		if err.Error() == "stream not found" {
+			h.logger.Warn("Stream not found", zap.Int("id", id))
+			http.Error(w, "Stream not found", http.StatusNotFound)
+		} else if errors.Is(err, service.ErrInvalidStreamQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			h.logger.Error("Error getting sessions",
+				zap.Int("id", id),
+				zap.Error(err),
+			)
+			http.Error(w, "Failed to get sessions: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// GetStreamRecordings handles GET /api/streams/{id}/recordings
+func (h *StreamHandler) GetStreamRecordings(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.logger.Warn("Invalid stream ID", zap.String("id", vars["id"]))
+		http.Error(w, "Invalid stream ID", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	h.logger.Info("Getting recordings for stream", zap.Int("id", id))
+
+	recordings, err := h.service.GetStreamRecordings(id, user)
+	if err != nil {
+		if err.Error() == "stream not found" {
+			h.logger.Warn("Stream not found", zap.Int("id", id))
+			http.Error(w, "Stream not found", http.StatusNotFound)
+		} else {
+			h.logger.Error("Error getting recordings",
+				zap.Int("id", id),
+				zap.Error(err),
+			)
+			http.Error(w, "Failed to get recordings: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.logger.Info("Successfully retrieved recordings",
+		zap.Int("id", id),
+		zap.Int("count", len(recordings)),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recordings)
+}
+
+// CreatePlaybackToken handles POST /api/streams/{id}/playback-token, issuing
+// the token a viewer needs to play the stream's encrypted playlists. The
+// body is optional: {"ttl_seconds": n} sets the token's lifetime.
+func (h *StreamHandler) CreatePlaybackToken(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.logger.Warn("Invalid stream ID", zap.String("id", vars["id"]))
+		http.Error(w, "Invalid stream ID", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var tokenRequest struct {
+		TTLSeconds int `json:"ttl_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&tokenRequest); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.Error("Error decoding playback token request", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ttl := time.Duration(tokenRequest.TTLSeconds) * time.Second
+	token, err := h.service.CreatePlaybackToken(id, user, ttl)
+	if err != nil {
+		if err.Error() == "stream not found" {
+			h.logger.Warn("Stream not found", zap.Int("id", id))
+			http.Error(w, "Stream not found", http.StatusNotFound)
+		} else if errors.Is(err, service.ErrInvalidPlaybackTokenTTL) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, service.ErrEncryptionNotConfigured) {
+			http.Error(w, "Encryption is not configured", http.StatusServiceUnavailable)
+		} else {
+			h.logger.Error("Error creating playback token",
+				zap.Int("id", id),
+				zap.Error(err),
+			)
+			http.Error(w, "Failed to create playback token: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Tokens are per viewer and must not be kept by shared caches
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+}
+
+// GetEncryptionKey handles GET /keys/{playbackId}/{keyId}?exp=&sig=, the
+// key URI of an encrypted stream's EXT-X-KEY tags. It is authenticated by
+// the URI's signature, which the encoder adds when it serves a playlist, and
+// never by an API key.
+func (h *StreamHandler) GetEncryptionKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	playbackID := vars["playbackId"]
+	keyID, err := strconv.ParseInt(vars["keyId"], 10, 64)
+	if err != nil {
+		h.logger.Warn("Invalid key ID", zap.String("key_id", vars["keyId"]))
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("Getting encryption key for stream",
+		zap.String("playback_id", playbackID),
+		zap.Int64("key_id", keyID),
+	)
+
+	key, err := h.service.GetEncryptionKey(playbackID, keyID, r.URL.Query())
+	if err != nil {
+		if errors.Is(err, keyseal.ErrInvalidSignature) {
+			h.logger.Warn("Rejected encryption key request",
+				zap.String("playback_id", playbackID),
+				zap.Int64("key_id", keyID),
+				zap.Error(err),
+			)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		} else if err.Error() == "encryption key not found" {
+			http.Error(w, "Encryption key not found", http.StatusNotFound)
+		} else if errors.Is(err, service.ErrEncryptionNotConfigured) {
+			http.Error(w, "Encryption is not configured", http.StatusServiceUnavailable)
+		} else {
+			h.logger.Error("Error getting encryption key",
+				zap.String("playback_id", playbackID),
+				zap.Int64("key_id", keyID),
+				zap.Error(err),
+			)
+			http.Error(w, "Failed to get encryption key", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Keys must not be kept by shared caches
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(key)
+}
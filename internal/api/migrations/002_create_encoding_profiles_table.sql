@@ -0,0 +1,23 @@
+-- Migration: Create encoding_profiles table
+-- Created: 2026-10-17
+
+CREATE TABLE IF NOT EXISTS encoding_profiles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    preset VARCHAR(50) NOT NULL DEFAULT 'ultrafast',
+    tune VARCHAR(50) NOT NULL DEFAULT 'zerolatency',
+    segment_duration INTEGER NOT NULL DEFAULT 3,
+    playlist_size INTEGER NOT NULL DEFAULT 60,
+    audio_bitrate INTEGER NOT NULL DEFAULT 128,
+    renditions TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Streams reference an optional encoding profile
+ALTER TABLE live_streams
+    ADD COLUMN IF NOT EXISTS encoding_profile_id INTEGER
+    REFERENCES encoding_profiles(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_encoding_profile_id ON live_streams(encoding_profile_id);
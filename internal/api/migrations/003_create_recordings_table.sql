@@ -0,0 +1,22 @@
+-- Migration: Create recordings table
+-- Created: 2026-10-17
+
+-- Streams opt in to live-to-VOD archiving
+ALTER TABLE live_streams
+    ADD COLUMN IF NOT EXISTS recording_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- One row per archived broadcast, written by the encoder service
+CREATE TABLE IF NOT EXISTS recordings (
+    id BIGSERIAL PRIMARY KEY,
+    live_stream_id INTEGER NOT NULL REFERENCES live_streams(id) ON DELETE CASCADE,
+    stream_key VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'recording',
+    storage_prefix VARCHAR(500) NOT NULL DEFAULT '',
+    duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    segment_count INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recordings_live_stream_id ON recordings(live_stream_id, started_at DESC);
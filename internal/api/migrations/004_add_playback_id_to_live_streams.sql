@@ -0,0 +1,14 @@
+-- Migration: Add public playback_id to live_streams
+-- Created: 2026-10-17
+
+-- Playback URLs use playback_id so the secret stream_key is only needed for ingest
+ALTER TABLE live_streams ADD COLUMN IF NOT EXISTS playback_id VARCHAR(64);
+
+-- Backfill existing streams with a random identifier
+UPDATE live_streams
+SET playback_id = md5(random()::text || id::text || clock_timestamp()::text)
+WHERE playback_id IS NULL;
+
+ALTER TABLE live_streams ALTER COLUMN playback_id SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_playback_id ON live_streams(playback_id);
@@ -0,0 +1,55 @@
+-- Migration: Create organizations table and tenant ownership
+-- Created: 2026-10-17
+
+-- Organizations are the tenant boundary. Every object in storage written for
+-- an organization lives under its storage_prefix.
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(63) NOT NULL UNIQUE,
+    storage_prefix VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Existing users, profiles and webhooks move to a default organization whose
+-- files stay at the root of the bucket, where they were written before
+INSERT INTO organizations (name, slug, storage_prefix)
+VALUES ('Default', 'default', '')
+ON CONFLICT (slug) DO NOTHING;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+UPDATE users SET organization_id = (SELECT id FROM organizations WHERE slug = 'default')
+WHERE organization_id IS NULL;
+ALTER TABLE users ALTER COLUMN organization_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_organization_id ON users(organization_id);
+
+-- Streams belong to their owner's organization. Streams without an owner are
+-- assigned to the default organization in 020.
+ALTER TABLE live_streams
+    ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+UPDATE live_streams ls SET organization_id = u.organization_id
+FROM users u
+WHERE ls.owner_id = u.id AND ls.organization_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_live_streams_organization_id ON live_streams(organization_id, created_at DESC);
+
+-- Encoding profiles are per organization; names are unique within one
+ALTER TABLE encoding_profiles
+    ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+UPDATE encoding_profiles SET organization_id = (SELECT id FROM organizations WHERE slug = 'default')
+WHERE organization_id IS NULL;
+ALTER TABLE encoding_profiles ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE encoding_profiles DROP CONSTRAINT IF EXISTS encoding_profiles_name_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_encoding_profiles_organization_name ON encoding_profiles(organization_id, name);
+
+-- Webhooks only receive events for their organization's streams
+ALTER TABLE webhook_subscriptions
+    ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+UPDATE webhook_subscriptions SET organization_id = (SELECT id FROM organizations WHERE slug = 'default')
+WHERE organization_id IS NULL;
+ALTER TABLE webhook_subscriptions ALTER COLUMN organization_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_organization_id ON webhook_subscriptions(organization_id);
@@ -0,0 +1,21 @@
+-- Migration: Add full-text search and listing indexes to live_streams
+-- Created: 2026-10-17
+
+-- Title matches rank above description matches
+ALTER TABLE live_streams
+    ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_live_streams_search ON live_streams USING GIN (search_vector);
+
+-- Keyset pagination orders by the sort column, then id
+CREATE INDEX IF NOT EXISTS idx_live_streams_org_created ON live_streams(organization_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_live_streams_org_title ON live_streams(organization_id, title, id);
+CREATE INDEX IF NOT EXISTS idx_live_streams_org_stream_name ON live_streams(organization_id, stream_name, id);
+CREATE INDEX IF NOT EXISTS idx_live_streams_org_status ON live_streams(organization_id, status, created_at);
+
+-- Superseded by idx_live_streams_org_created
+DROP INDEX IF EXISTS idx_live_streams_organization_id;
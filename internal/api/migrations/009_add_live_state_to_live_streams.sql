@@ -0,0 +1,22 @@
+-- Migration: Track the encoder's live state on live_streams
+-- Created: 2026-10-17
+
+-- The encoder updates status, started_at and stopped_at whenever a stream key
+-- starts or stops publishing
+ALTER TABLE live_streams
+    ADD COLUMN IF NOT EXISTS started_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS stopped_at TIMESTAMP;
+
+-- Copy the current state of keys that have already been published. The
+-- encoder's streams table does not exist until the encoder has migrated.
+DO $$
+BEGIN
+    IF to_regclass('streams') IS NOT NULL THEN
+        UPDATE live_streams ls
+        SET status = CASE WHEN ls.status = 'disabled' THEN ls.status ELSE s.status END,
+            started_at = s.started_at,
+            stopped_at = s.stopped_at
+        FROM streams s
+        WHERE s.stream_key = ls.stream_key;
+    END IF;
+END $$;
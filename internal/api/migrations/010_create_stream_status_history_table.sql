@@ -0,0 +1,33 @@
+-- Migration: Stream status state machine and status history
+-- Created: 2026-10-17
+
+-- Map the encoder's previous active/inactive/error statuses, and any free-form
+-- status set through the API, onto the state machine's statuses
+UPDATE live_streams SET status = CASE
+    WHEN status = 'active' THEN 'live'
+    WHEN status = 'error' THEN 'errored'
+    WHEN status = 'disabled' THEN 'disabled'
+    WHEN started_at IS NOT NULL THEN 'ended'
+    ELSE 'created'
+END
+WHERE status IS NULL OR status NOT IN
+    ('created', 'idle', 'connecting', 'live', 'reconnecting', 'ended', 'errored', 'disabled');
+
+ALTER TABLE live_streams ALTER COLUMN status SET DEFAULT 'created';
+ALTER TABLE live_streams ALTER COLUMN status SET NOT NULL;
+ALTER TABLE live_streams DROP CONSTRAINT IF EXISTS live_streams_status_check;
+ALTER TABLE live_streams ADD CONSTRAINT live_streams_status_check CHECK (status IN
+    ('created', 'idle', 'connecting', 'live', 'reconnecting', 'ended', 'errored', 'disabled'));
+
+-- One row per status change, written by the API and the encoder
+CREATE TABLE IF NOT EXISTS stream_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    live_stream_id INTEGER NOT NULL REFERENCES live_streams(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_status_history_live_stream
+    ON stream_status_history(live_stream_id, created_at DESC);
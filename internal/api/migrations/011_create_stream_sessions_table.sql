@@ -0,0 +1,18 @@
+-- Migration: Create stream_sessions table
+-- Created: 2026-10-17
+
+-- One row per publish of a stream key, written by the encoder. ended_at,
+-- duration_seconds and end_reason stay NULL while the session is live.
+CREATE TABLE IF NOT EXISTS stream_sessions (
+    id BIGSERIAL PRIMARY KEY,
+    live_stream_id INTEGER NOT NULL REFERENCES live_streams(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    duration_seconds DOUBLE PRECISION,
+    end_reason VARCHAR(50),
+    bytes_ingested BIGINT NOT NULL DEFAULT 0,
+    segments_produced INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_sessions_live_stream
+    ON stream_sessions(live_stream_id, started_at DESC);
@@ -0,0 +1,7 @@
+-- Migration: Add FFmpeg log to stream_sessions
+-- Created: 2026-10-17
+
+-- The last lines FFmpeg wrote to stderr during the session, stored by the
+-- encoder when the session ends
+ALTER TABLE stream_sessions
+    ADD COLUMN IF NOT EXISTS ffmpeg_log TEXT;
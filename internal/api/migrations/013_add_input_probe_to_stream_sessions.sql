@@ -0,0 +1,17 @@
+-- Migration: Add probed input media to stream_sessions
+-- Created: 2026-10-17
+
+-- Written by the encoder when it probes the publisher's input at the start
+-- of a session. input_probed_at stays NULL if the input could not be probed;
+-- the other columns are NULL when the input has no such stream or value.
+ALTER TABLE stream_sessions
+    ADD COLUMN IF NOT EXISTS input_probed_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS input_video_codec VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS input_width INTEGER,
+    ADD COLUMN IF NOT EXISTS input_height INTEGER,
+    ADD COLUMN IF NOT EXISTS input_frame_rate DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS input_keyframe_interval DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS input_audio_codec VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS input_audio_sample_rate INTEGER,
+    ADD COLUMN IF NOT EXISTS input_audio_channels INTEGER,
+    ADD COLUMN IF NOT EXISTS input_warnings TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,7 @@
+-- Migration: Add seek preview sprite sheets to recordings
+-- Created: 2026-10-17
+
+-- Number of sprite sheets the encoder built for the recording, stored with a
+-- WebVTT track under {storage_prefix}/sprites/; 0 if it has no previews
+ALTER TABLE recordings
+    ADD COLUMN IF NOT EXISTS sprite_sheets INTEGER NOT NULL DEFAULT 0;
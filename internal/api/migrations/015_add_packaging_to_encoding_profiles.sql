@@ -0,0 +1,7 @@
+-- Migration: Add output packaging to encoding_profiles
+-- Created: 2026-10-17
+
+-- hls writes MPEG-TS segments for HLS; cmaf writes fMP4 segments referenced
+-- by both the HLS playlists and a DASH manifest
+ALTER TABLE encoding_profiles
+    ADD COLUMN IF NOT EXISTS packaging VARCHAR(16) NOT NULL DEFAULT 'hls';
@@ -0,0 +1,7 @@
+-- Migration: Add low-latency mode to encoding_profiles
+-- Created: 2026-10-17
+
+-- low_latency serves LL-HLS partial segments and blocking playlist reloads;
+-- it requires cmaf packaging
+ALTER TABLE encoding_profiles
+    ADD COLUMN IF NOT EXISTS low_latency BOOLEAN NOT NULL DEFAULT FALSE;
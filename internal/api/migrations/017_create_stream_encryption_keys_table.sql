@@ -0,0 +1,23 @@
+-- Migration: AES-128 HLS encryption for live_streams
+-- Created: 2026-10-17
+
+-- Encrypted streams get a new key every key_rotation_seconds, or one key per
+-- publish for 0
+ALTER TABLE live_streams
+    ADD COLUMN IF NOT EXISTS encryption_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS key_rotation_seconds INTEGER NOT NULL DEFAULT 0;
+
+-- One row per key, written by the encoder and served to players by the API.
+-- sealed_key is the AES-128 key sealed with AES-256-GCM under the
+-- HLS_KEY_ENCRYPTION_KEY both services share: a 12-byte nonce followed by the
+-- ciphertext, with the stream's ID as additional data. Keys are deleted with
+-- their stream, which also deletes its recordings.
+CREATE TABLE IF NOT EXISTS stream_encryption_keys (
+    id BIGSERIAL PRIMARY KEY,
+    live_stream_id INTEGER NOT NULL REFERENCES live_streams(id) ON DELETE CASCADE,
+    sealed_key BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_encryption_keys_live_stream
+    ON stream_encryption_keys(live_stream_id);
@@ -0,0 +1,7 @@
+-- Migration: Default encoding_profiles.audio_bitrate to the renditions' own
+-- Created: 2026-10-17
+
+-- 0 keeps each rendition's own audio bitrate, such as 64 kbps for the
+-- audio-only rendition, instead of forcing one bitrate on the whole ladder
+ALTER TABLE encoding_profiles
+    ALTER COLUMN audio_bitrate SET DEFAULT 0;
@@ -0,0 +1,17 @@
+-- Migration: Schedule webhook delivery retries in webhook_deliveries
+-- Created: 2026-10-17
+
+-- next_attempt_at is when a pending delivery is next attempted. The encoder
+-- service polls for due deliveries, so retries survive restarts; it moves
+-- next_attempt_at forward while an attempt is in flight, so only one
+-- instance sends it.
+ALTER TABLE webhook_deliveries
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP;
+
+UPDATE webhook_deliveries
+SET next_attempt_at = CURRENT_TIMESTAMP
+WHERE status = 'pending' AND next_attempt_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+    ON webhook_deliveries(next_attempt_at)
+    WHERE status = 'pending';
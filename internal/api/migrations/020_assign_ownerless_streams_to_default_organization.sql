@@ -0,0 +1,9 @@
+-- Migration: Assign streams created before authentication to an organization
+-- Created: 2026-10-17
+
+-- Streams created before authentication have no owner, so 007 left them
+-- without an organization and they could not be reached through the API.
+-- They move to the default organization, like the other data from before
+-- organizations existed. owner_id stays NULL.
+UPDATE live_streams SET organization_id = (SELECT id FROM organizations WHERE slug = 'default')
+WHERE organization_id IS NULL;
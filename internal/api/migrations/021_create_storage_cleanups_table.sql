@@ -0,0 +1,13 @@
+-- Migration: Create storage_cleanups table
+-- Created: 2026-10-17
+
+-- A deleted stream's files outlive its row: its thumbnail, any live output
+-- left by a crash and its recordings. Deleting a stream queues its storage
+-- location here, in the same transaction, and the encoder service deletes
+-- the files and then the row, so cleanups survive restarts.
+CREATE TABLE IF NOT EXISTS storage_cleanups (
+    id BIGSERIAL PRIMARY KEY,
+    storage_prefix VARCHAR(255) NOT NULL DEFAULT '',
+    playback_id VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,21 @@
+-- Migration: Tie stream encryption keys to their recordings
+-- Created: 2026-10-17
+
+-- Keys were only deleted with their stream. A key is now tied to the
+-- recording its segments are archived in, and deleted with it; keys of
+-- publishes that are not recorded are deleted by the encoder when encoding
+-- ends, together with the live segments. recording_id is NULL for those.
+ALTER TABLE stream_encryption_keys
+    ADD COLUMN IF NOT EXISTS recording_id BIGINT REFERENCES recordings(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_stream_encryption_keys_recording
+    ON stream_encryption_keys(recording_id);
+
+-- Existing keys belong to the recording of the publish they were issued in
+UPDATE stream_encryption_keys k
+SET recording_id = r.id
+FROM recordings r
+WHERE k.recording_id IS NULL
+    AND r.live_stream_id = k.live_stream_id
+    AND k.created_at >= r.started_at
+    AND (r.ended_at IS NULL OR k.created_at <= r.ended_at);
@@ -0,0 +1,11 @@
+-- Migration: Record the encoder instance of each publish session
+-- Created: 2026-10-17
+
+-- An encoder closes the sessions left open when it stops, at its next
+-- startup. With several encoders sharing the database it must only close its
+-- own, so each session records the instance encoding it. Sessions opened
+-- before this column existed have none and are not closed by any instance.
+ALTER TABLE stream_sessions ADD COLUMN IF NOT EXISTS encoder_instance VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_stream_sessions_open_by_instance
+    ON stream_sessions(encoder_instance) WHERE ended_at IS NULL;
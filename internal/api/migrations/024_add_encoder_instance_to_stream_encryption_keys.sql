@@ -0,0 +1,12 @@
+-- Migration: Record the encoder instance that issued each encryption key
+-- Created: 2026-10-17
+
+-- An encoder deletes the keys of unrecorded publishes it was still encoding
+-- when it stopped, at its next startup. With several encoders sharing the
+-- database it must only delete its own, since another instance's keys may
+-- belong to a publish that is still live. Keys issued before this column
+-- existed have none and are not deleted by any instance.
+ALTER TABLE stream_encryption_keys ADD COLUMN IF NOT EXISTS encoder_instance VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_stream_encryption_keys_unrecorded_by_instance
+    ON stream_encryption_keys(encoder_instance) WHERE recording_id IS NULL;
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Output packagings of an encoding profile
+const (
+	PackagingHLS  = "hls"  // MPEG-TS segments with HLS playlists
+	PackagingCMAF = "cmaf" // fMP4 segments with HLS playlists and a DASH manifest
+)
+
+// EncodingProfile holds the FFmpeg settings used to encode a stream
+type EncodingProfile struct {
+	ID              int       `json:"id"`
+	OrganizationID  int       `json:"organization_id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	Preset          string    `json:"preset"`
+	Tune            string    `json:"tune"`
+	SegmentDuration int       `json:"segment_duration"`
+	PlaylistSize    int       `json:"playlist_size"`
+	AudioBitrate    int       `json:"audio_bitrate"` // kbps, 0 keeps each rendition's own
+	Renditions      []string  `json:"renditions"`
+	Packaging       string    `json:"packaging"`
+	LowLatency      bool      `json:"low_latency"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Organization is a tenant. It owns users, streams, encoding profiles and
+// webhooks, and all of its files in storage live under StoragePrefix.
+type Organization struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Slug          string    `json:"slug"`
+	StoragePrefix string    `json:"storage_prefix"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PlaybackToken lets a viewer play a stream's encrypted playlists until it
+// expires. The encoder only signs the key URIs of playlists requested with a
+// valid token.
+type PlaybackToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// PlaybackURL is the stream's master playlist URL with the token
+	PlaybackURL string `json:"playback_url"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Recording is an archived broadcast of a live stream, available as VOD
+type Recording struct {
+	ID              int64      `json:"id"`
+	LiveStreamID    int        `json:"live_stream_id"`
+	Status          string     `json:"status"`
+	PlaybackURL     string     `json:"playback_url"`
+	ThumbnailsURL   *string    `json:"thumbnails_url"` // WebVTT seek preview track
+	StoragePrefix   string     `json:"-"`
+	DurationSeconds float64    `json:"duration_seconds"`
+	SegmentCount    int        `json:"segment_count"`
+	SpriteSheets    int        `json:"-"`
+	StartedAt       time.Time  `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at"`
+}
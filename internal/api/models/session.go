@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// StreamSession is one publish of a stream, from publish to unpublish.
+// EndedAt, DurationSeconds and EndReason are null while the session is live.
+type StreamSession struct {
+	ID               int64      `json:"id"`
+	LiveStreamID     int        `json:"live_stream_id"`
+	StartedAt        time.Time  `json:"started_at"`
+	EndedAt          *time.Time `json:"ended_at"`
+	DurationSeconds  *float64   `json:"duration_seconds"`
+	EndReason        *string    `json:"end_reason"` // publisher_left, ffmpeg_crash, admin_kill or encoder_restart
+	BytesIngested    int64      `json:"bytes_ingested"`
+	SegmentsProduced int        `json:"segments_produced"`
+	// Input is the source media probed by the encoder when the session
+	// started; null if it was not probed
+	Input *SessionInput `json:"input"`
+}
+
+// SessionInput describes the media a publisher sent. Fields are null when the
+// input had no such stream or the encoder could not measure them.
+type SessionInput struct {
+	VideoCodec *string  `json:"video_codec"`
+	Width      *int     `json:"width"`
+	Height     *int     `json:"height"`
+	FrameRate  *float64 `json:"frame_rate"`
+	// KeyframeInterval is the longest time between keyframes, in seconds
+	KeyframeInterval *float64 `json:"keyframe_interval_seconds"`
+	AudioCodec       *string  `json:"audio_codec"`
+	AudioSampleRate  *int     `json:"audio_sample_rate"`
+	AudioChannels    *int     `json:"audio_channels"`
+	// Warnings describe publisher settings that hurt playback, such as a
+	// long keyframe interval
+	Warnings []string  `json:"warnings"`
+	ProbedAt time.Time `json:"probed_at"`
+}
@@ -5,12 +5,31 @@ import "time"
 type LiveStream struct {
 	ID              int       `json:"id"`
 	StreamKey       string    `json:"stream_key"`
+	PlaybackID      string    `json:"playback_id"`
 	IngestURL       string    `json:"ingest_url"`
 	PlaybackURL     string    `json:"playback_url"`
+	DashPlaybackURL *string   `json:"dash_playback_url"`
+	ThumbnailURL    *string   `json:"thumbnail_url"` // null until first published
 	Title           string    `json:"title"`
 	StreamName      string    `json:"stream_name"`
 	StreamCreatedBy string    `json:"stream_created_by"`
+	OwnerID         *int      `json:"owner_id"` // null for streams created before authentication
+	OrganizationID  int       `json:"organization_id"`
 	Description     string    `json:"description"`
 	CreatedAt       time.Time `json:"created_at"`
-	Status          string    `json:"status"`
+	// Status follows the encoder: it is active while the key is publishing
+	Status            string     `json:"status"`
+	StartedAt         *time.Time `json:"started_at"` // start of the latest publish
+	StoppedAt         *time.Time `json:"stopped_at"` // end of the latest publish
+	EncodingProfileID *int       `json:"encoding_profile_id"`
+	RecordingEnabled  bool       `json:"recording_enabled"`
+	// EncryptionEnabled encrypts the stream's segments with AES-128, with a
+	// new key every KeyRotationSeconds, or one key per publish for 0
+	EncryptionEnabled  bool `json:"encryption_enabled"`
+	KeyRotationSeconds int  `json:"key_rotation_seconds"`
+	// Packaging of the stream's encoding profile, PackagingHLS without one
+	Packaging string `json:"-"`
+	// SearchRank is how well the stream matched a listing's search, which
+	// relevance cursors carry. It is 0 outside searches.
+	SearchRank float32 `json:"-"`
 }
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// StreamSortRelevance sorts a stream listing by how well streams match its
+// search, title matches first. It requires a search.
+const StreamSortRelevance = "relevance"
+
+// StreamListQuery filters, sorts and pages a stream listing
+type StreamListQuery struct {
+	Status        string
+	CreatedBy     string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Search        string // full-text search over title and description
+	Sort          string // created_at, title, stream_name or relevance
+	Order         string // asc or desc
+	Limit         int
+	After         *StreamCursor // nil for the first page
+}
+
+// StreamCursor is the position after the last stream of a page: its sort
+// column value and ID. It is handed to clients as an opaque token.
+type StreamCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// StreamPage is one page of a stream listing
+type StreamPage struct {
+	Data   []*LiveStream `json:"data"`
+	Paging Paging        `json:"paging"`
+}
+
+// Paging describes a page of a cursor-paginated listing. NextCursor is empty
+// on the last page.
+type Paging struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	Order      string `json:"order"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Stream statuses. The encoder moves a stream through connecting, live,
+// reconnecting, ended and errored as its key publishes; created, idle and
+// disabled are set by the API.
+const (
+	StreamStatusCreated      = "created"      // never published
+	StreamStatusIdle         = "idle"         // ready for a publish
+	StreamStatusConnecting   = "connecting"   // publish accepted, encoder starting
+	StreamStatusLive         = "live"         // encoding
+	StreamStatusReconnecting = "reconnecting" // encoder restarting after a crash
+	StreamStatusEnded        = "ended"        // publish stopped
+	StreamStatusErrored      = "errored"      // encoder gave up
+	StreamStatusDisabled     = "disabled"     // publishes are rejected
+)
+
+// streamStatusTransitions lists the statuses each status can move to
+var streamStatusTransitions = map[string][]string{
+	StreamStatusCreated:      {StreamStatusIdle, StreamStatusConnecting, StreamStatusDisabled},
+	StreamStatusIdle:         {StreamStatusConnecting, StreamStatusDisabled},
+	StreamStatusConnecting:   {StreamStatusLive, StreamStatusEnded, StreamStatusErrored, StreamStatusDisabled},
+	StreamStatusLive:         {StreamStatusReconnecting, StreamStatusEnded, StreamStatusErrored, StreamStatusDisabled},
+	StreamStatusReconnecting: {StreamStatusLive, StreamStatusEnded, StreamStatusErrored, StreamStatusDisabled},
+	StreamStatusEnded:        {StreamStatusIdle, StreamStatusConnecting, StreamStatusDisabled},
+	StreamStatusErrored:      {StreamStatusIdle, StreamStatusConnecting, StreamStatusDisabled},
+	StreamStatusDisabled:     {StreamStatusIdle},
+}
+
+// IsStreamStatus reports whether status is a known stream status
+func IsStreamStatus(status string) bool {
+	_, ok := streamStatusTransitions[status]
+	return ok
+}
+
+// CanTransitionStreamStatus reports whether a stream may move from one status
+// to another
+func CanTransitionStreamStatus(from, to string) bool {
+	for _, status := range streamStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamStatusChange is one entry in a stream's status history
+type StreamStatusChange struct {
+	ID           int64     `json:"id"`
+	LiveStreamID int       `json:"live_stream_id"`
+	FromStatus   *string   `json:"from_status"` // null for the stream's creation
+	ToStatus     string    `json:"to_status"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
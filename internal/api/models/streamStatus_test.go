@@ -0,0 +1,92 @@
+package models
+
+import "testing"
+
+func TestIsStreamStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{StreamStatusCreated, true},
+		{StreamStatusIdle, true},
+		{StreamStatusConnecting, true},
+		{StreamStatusLive, true},
+		{StreamStatusReconnecting, true},
+		{StreamStatusEnded, true},
+		{StreamStatusErrored, true},
+		{StreamStatusDisabled, true},
+		{"", false},
+		{"active", false},
+		{"LIVE", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := IsStreamStatus(tt.status); got != tt.want {
+				t.Errorf("IsStreamStatus(%q) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanTransitionStreamStatus(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		// A publish from any resting status
+		{StreamStatusCreated, StreamStatusConnecting, true},
+		{StreamStatusIdle, StreamStatusConnecting, true},
+		{StreamStatusEnded, StreamStatusConnecting, true},
+		{StreamStatusErrored, StreamStatusConnecting, true},
+		{StreamStatusDisabled, StreamStatusConnecting, false},
+
+		// Encoding, crashes and restarts
+		{StreamStatusConnecting, StreamStatusLive, true},
+		{StreamStatusConnecting, StreamStatusReconnecting, false},
+		{StreamStatusLive, StreamStatusReconnecting, true},
+		{StreamStatusReconnecting, StreamStatusLive, true},
+		{StreamStatusReconnecting, StreamStatusErrored, true},
+		{StreamStatusLive, StreamStatusConnecting, false},
+
+		// Ending a publish
+		{StreamStatusConnecting, StreamStatusEnded, true},
+		{StreamStatusLive, StreamStatusEnded, true},
+		{StreamStatusLive, StreamStatusErrored, true},
+		{StreamStatusEnded, StreamStatusLive, false},
+		{StreamStatusErrored, StreamStatusEnded, false},
+
+		// Statuses set through the API
+		{StreamStatusCreated, StreamStatusIdle, true},
+		{StreamStatusEnded, StreamStatusIdle, true},
+		{StreamStatusLive, StreamStatusIdle, false},
+		{StreamStatusLive, StreamStatusDisabled, true},
+		{StreamStatusDisabled, StreamStatusIdle, true},
+		{StreamStatusDisabled, StreamStatusLive, false},
+
+		// No stream returns to created, stays in place or leaves an unknown status
+		{StreamStatusIdle, StreamStatusCreated, false},
+		{StreamStatusIdle, StreamStatusIdle, false},
+		{"unknown", StreamStatusIdle, false},
+		{StreamStatusIdle, "unknown", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanTransitionStreamStatus(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransitionStreamStatus(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamStatusTransitionsStayKnown(t *testing.T) {
+	// Every status a stream can move to must itself be able to move on
+	for from, targets := range streamStatusTransitions {
+		for _, to := range targets {
+			if !IsStreamStatus(to) {
+				t.Errorf("%q moves to unknown status %q", from, to)
+			}
+		}
+	}
+}
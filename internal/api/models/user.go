@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// User is an account that owns streams and authenticates with API keys.
+// Every user belongs to one organization.
+type User struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Email          string    `json:"email"`
+	Name           string    `json:"name"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// APIKey is a bearer credential for a user. Only a hash of the key is stored;
+// the key itself is returned once, when it is created.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"` // only returned when created
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
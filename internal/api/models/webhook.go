@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// WebhookSubscription is a URL registered to receive stream lifecycle events
+type WebhookSubscription struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	URL            string    `json:"url"`
+	Secret         string    `json:"secret,omitempty"` // only returned when created
+	Events         []string  `json:"events"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent to a subscription, with its retry state
+type WebhookDelivery struct {
+	ID             int64     `json:"id"`
+	SubscriptionID int       `json:"subscription_id"`
+	EventID        string    `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	Payload        string    `json:"payload"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	ResponseStatus *int      `json:"response_status"`
+	LastError      *string   `json:"last_error"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// NextAttemptAt is when a pending delivery is next attempted
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+}
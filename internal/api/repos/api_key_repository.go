@@ -0,0 +1,167 @@
+package repos
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"streamkit/internal/api/models"
+
+	"go.uber.org/zap"
+)
+
+// apiKeyUsageResolution is how stale a key's last_used_at may get before a
+// request updates it, so authenticating stays a read on the hot path
+const apiKeyUsageResolution = time.Minute
+
+type APIKeyRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func NewAPIKeyRepository(db *sql.DB, logger *zap.Logger) *APIKeyRepository {
+	return &APIKeyRepository{db: db, logger: logger}
+}
+
+// Create stores a new API key by its hash
+func (r *APIKeyRepository) Create(apiKey *models.APIKey, keyHash string) error {
+	r.logger.Info("Creating API key",
+		zap.Int("user_id", apiKey.UserID),
+		zap.String("prefix", apiKey.Prefix),
+	)
+
+	apiKey.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+
+	err := r.db.QueryRow(query,
+		apiKey.UserID,
+		apiKey.Name,
+		apiKey.Prefix,
+		keyHash,
+		apiKey.CreatedAt,
+	).Scan(&apiKey.ID)
+	if err != nil {
+		r.logger.Error("Error creating API key", zap.Int("user_id", apiKey.UserID), zap.Error(err))
+		return err
+	}
+
+	r.logger.Info("Successfully created API key", zap.Int("id", apiKey.ID))
+	return nil
+}
+
+// GetUserByKeyHash returns the owner of an unrevoked API key and records its
+// use. last_used_at is only updated once it is apiKeyUsageResolution old.
+func (r *APIKeyRepository) GetUserByKeyHash(keyHash string) (*models.User, error) {
+	user := &models.User{}
+	query := `
+		SELECT k.id, k.last_used_at, u.id, u.organization_id, u.email, u.name, u.created_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+	`
+
+	var keyID int
+	var lastUsedAt *time.Time
+	err := r.db.QueryRow(query, keyHash).Scan(
+		&keyID,
+		&lastUsedAt,
+		&user.ID,
+		&user.OrganizationID,
+		&user.Email,
+		&user.Name,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("api key not found")
+		}
+		r.logger.Error("Error looking up API key", zap.Error(err))
+		return nil, err
+	}
+
+	now := time.Now()
+	if lastUsedAt == nil || now.Sub(*lastUsedAt) >= apiKeyUsageResolution {
+		// The condition keeps concurrent requests from all writing
+		_, err := r.db.Exec(`
+			UPDATE api_keys SET last_used_at = $1
+			WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)
+		`, now, keyID, now.Add(-apiKeyUsageResolution))
+		if err != nil {
+			r.logger.Warn("Error recording API key use", zap.Int("api_key_id", keyID), zap.Error(err))
+		}
+	}
+
+	return user, nil
+}
+
+// GetByUserID retrieves the unrevoked API keys of a user
+func (r *APIKeyRepository) GetByUserID(userID int) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, created_at, last_used_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		r.logger.Error("Error getting API keys", zap.Int("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	apiKeys := []*models.APIKey{}
+	for rows.Next() {
+		apiKey := &models.APIKey{}
+		err := rows.Scan(
+			&apiKey.ID,
+			&apiKey.UserID,
+			&apiKey.Name,
+			&apiKey.Prefix,
+			&apiKey.CreatedAt,
+			&apiKey.LastUsedAt,
+		)
+		if err != nil {
+			r.logger.Error("Error scanning API key row", zap.Error(err))
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	return apiKeys, nil
+}
+
+// Revoke revokes one of a user's API keys
+func (r *APIKeyRepository) Revoke(id, userID int) error {
+	r.logger.Info("Revoking API key", zap.Int("id", id), zap.Int("user_id", userID))
+
+	query := `
+		UPDATE api_keys SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.Exec(query, time.Now(), id, userID)
+	if err != nil {
+		r.logger.Error("Error revoking API key", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Error getting rows affected", zap.Error(err))
+		return err
+	}
+
+	if rowsAffected == 0 {
+		r.logger.Warn("No API key found to revoke", zap.Int("id", id))
+		return errors.New("api key not found")
+	}
+
+	r.logger.Info("Successfully revoked API key", zap.Int("id", id))
+	return nil
+}
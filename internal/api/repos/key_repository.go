@@ -0,0 +1,47 @@
+package repos
+
+import (
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// KeyRepository reads the sealed HLS encryption keys the encoder stores for
+// encrypted streams
+type KeyRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func NewKeyRepository(db *sql.DB, logger *zap.Logger) *KeyRepository {
+	return &KeyRepository{db: db, logger: logger}
+}
+
+// GetSealedKey retrieves a sealed encryption key by ID, with the ID of its
+// stream, if it belongs to the stream with the given playback ID
+func (r *KeyRepository) GetSealedKey(id int64, playbackID string) (int, []byte, error) {
+	query := `
+		SELECT k.live_stream_id, k.sealed_key
+		FROM stream_encryption_keys k
+		JOIN live_streams ls ON ls.id = k.live_stream_id
+		WHERE k.id = $1 AND ls.playback_id = $2
+	`
+
+	var liveStreamID int
+	var sealedKey []byte
+	err := r.db.QueryRow(query, id, playbackID).Scan(&liveStreamID, &sealedKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil, errors.New("encryption key not found")
+		}
+		r.logger.Error("Error getting encryption key",
+			zap.Int64("id", id),
+			zap.String("playback_id", playbackID),
+			zap.Error(err),
+		)
+		return 0, nil, err
+	}
+
+	return liveStreamID, sealedKey, nil
+}
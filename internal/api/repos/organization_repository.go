@@ -0,0 +1,83 @@
+package repos
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"streamkit/internal/api/models"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type OrganizationRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func NewOrganizationRepository(db *sql.DB, logger *zap.Logger) *OrganizationRepository {
+	return &OrganizationRepository{db: db, logger: logger}
+}
+
+// Create creates a new organization
+func (r *OrganizationRepository) Create(organization *models.Organization) error {
+	r.logger.Info("Creating organization", zap.String("slug", organization.Slug))
+
+	organization.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO organizations (name, slug, storage_prefix, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	err := r.db.QueryRow(query,
+		organization.Name,
+		organization.Slug,
+		organization.StoragePrefix,
+		organization.CreatedAt,
+	).Scan(&organization.ID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			r.logger.Warn("Organization already exists", zap.String("slug", organization.Slug))
+			return errors.New("organization already exists")
+		}
+		r.logger.Error("Error creating organization",
+			zap.String("slug", organization.Slug),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	r.logger.Info("Successfully created organization", zap.Int("id", organization.ID))
+	return nil
+}
+
+// GetByID retrieves an organization by ID
+func (r *OrganizationRepository) GetByID(id int) (*models.Organization, error) {
+	organization := &models.Organization{}
+	query := `
+		SELECT id, name, slug, storage_prefix, created_at
+		FROM organizations WHERE id = $1
+	`
+
+	err := r.db.QueryRow(query, id).Scan(
+		&organization.ID,
+		&organization.Name,
+		&organization.Slug,
+		&organization.StoragePrefix,
+		&organization.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.logger.Warn("Organization not found", zap.Int("id", id))
+			return nil, errors.New("organization not found")
+		}
+		r.logger.Error("Error getting organization", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+
+	return organization, nil
+}
@@ -0,0 +1,237 @@
+package repos
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"streamkit/internal/api/models"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type ProfileRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func NewProfileRepository(db *sql.DB, logger *zap.Logger) *ProfileRepository {
+	return &ProfileRepository{db: db, logger: logger}
+}
+
+// Create creates a new encoding profile
+func (r *ProfileRepository) Create(profile *models.EncodingProfile) error {
+	r.logger.Info("Creating encoding profile", zap.String("name", profile.Name))
+
+	profile.CreatedAt = time.Now()
+	profile.UpdatedAt = profile.CreatedAt
+
+	query := `
+		INSERT INTO encoding_profiles (organization_id, name, description, preset, tune, segment_duration, playlist_size, audio_bitrate, renditions, packaging, low_latency, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`
+
+	var id int
+	err := r.db.QueryRow(query,
+		profile.OrganizationID,
+		profile.Name,
+		profile.Description,
+		profile.Preset,
+		profile.Tune,
+		profile.SegmentDuration,
+		profile.PlaylistSize,
+		profile.AudioBitrate,
+		pq.Array(profile.Renditions),
+		profile.Packaging,
+		profile.LowLatency,
+		profile.CreatedAt,
+		profile.UpdatedAt,
+	).Scan(&id)
+	if err != nil {
+		r.logger.Error("Error creating encoding profile",
+			zap.Error(err),
+			zap.String("name", profile.Name),
+		)
+		return err
+	}
+
+	profile.ID = id
+	r.logger.Info("Successfully created encoding profile", zap.Int("id", id))
+	return nil
+}
+
+// GetByID retrieves one of an organization's encoding profiles by ID
+func (r *ProfileRepository) GetByID(id, orgID int) (*models.EncodingProfile, error) {
+	r.logger.Info("Getting encoding profile by ID", zap.Int("id", id))
+
+	profile := &models.EncodingProfile{}
+	var description sql.NullString
+	query := `
+		SELECT id, organization_id, name, description, preset, tune, segment_duration, playlist_size, audio_bitrate, renditions, packaging, low_latency, created_at, updated_at
+		FROM encoding_profiles WHERE id = $1 AND organization_id = $2
+	`
+
+	err := r.db.QueryRow(query, id, orgID).Scan(
+		&profile.ID,
+		&profile.OrganizationID,
+		&profile.Name,
+		&description,
+		&profile.Preset,
+		&profile.Tune,
+		&profile.SegmentDuration,
+		&profile.PlaylistSize,
+		&profile.AudioBitrate,
+		pq.Array(&profile.Renditions),
+		&profile.Packaging,
+		&profile.LowLatency,
+		&profile.CreatedAt,
+		&profile.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.logger.Warn("Encoding profile not found", zap.Int("id", id))
+			return nil, errors.New("encoding profile not found")
+		}
+		r.logger.Error("Error getting encoding profile by ID",
+			zap.Int("id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	profile.Description = description.String
+
+	r.logger.Info("Successfully retrieved encoding profile", zap.Int("id", id))
+	return profile, nil
+}
+
+// GetAll retrieves all encoding profiles of an organization
+func (r *ProfileRepository) GetAll(orgID int) ([]*models.EncodingProfile, error) {
+	r.logger.Info("Getting all encoding profiles", zap.Int("organization_id", orgID))
+
+	query := `
+		SELECT id, organization_id, name, description, preset, tune, segment_duration, playlist_size, audio_bitrate, renditions, packaging, low_latency, created_at, updated_at
+		FROM encoding_profiles WHERE organization_id = $1 ORDER BY name ASC
+	`
+
+	rows, err := r.db.Query(query, orgID)
+	if err != nil {
+		r.logger.Error("Error getting all encoding profiles", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []*models.EncodingProfile
+	for rows.Next() {
+		profile := &models.EncodingProfile{}
+		var description sql.NullString
+		err := rows.Scan(
+			&profile.ID,
+			&profile.OrganizationID,
+			&profile.Name,
+			&description,
+			&profile.Preset,
+			&profile.Tune,
+			&profile.SegmentDuration,
+			&profile.PlaylistSize,
+			&profile.AudioBitrate,
+			pq.Array(&profile.Renditions),
+			&profile.Packaging,
+			&profile.LowLatency,
+			&profile.CreatedAt,
+			&profile.UpdatedAt,
+		)
+		if err != nil {
+			r.logger.Error("Error scanning encoding profile row", zap.Error(err))
+			return nil, err
+		}
+		profile.Description = description.String
+		profiles = append(profiles, profile)
+	}
+
+	r.logger.Info("Successfully retrieved encoding profiles", zap.Int("count", len(profiles)))
+	return profiles, nil
+}
+
+// Update updates one of an organization's encoding profiles
+func (r *ProfileRepository) Update(profile *models.EncodingProfile) error {
+	r.logger.Info("Updating encoding profile", zap.Int("id", profile.ID))
+
+	profile.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE encoding_profiles
+		SET name = $1, description = $2, preset = $3, tune = $4, segment_duration = $5,
+			playlist_size = $6, audio_bitrate = $7, renditions = $8, packaging = $9, low_latency = $10,
+			updated_at = $11
+		WHERE id = $12 AND organization_id = $13
+	`
+
+	result, err := r.db.Exec(query,
+		profile.Name,
+		profile.Description,
+		profile.Preset,
+		profile.Tune,
+		profile.SegmentDuration,
+		profile.PlaylistSize,
+		profile.AudioBitrate,
+		pq.Array(profile.Renditions),
+		profile.Packaging,
+		profile.LowLatency,
+		profile.UpdatedAt,
+		profile.ID,
+		profile.OrganizationID,
+	)
+	if err != nil {
+		r.logger.Error("Error updating encoding profile",
+			zap.Int("id", profile.ID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Error getting rows affected", zap.Error(err))
+		return err
+	}
+
+	if rowsAffected == 0 {
+		r.logger.Warn("No encoding profile found to update", zap.Int("id", profile.ID))
+		return errors.New("encoding profile not found")
+	}
+
+	r.logger.Info("Successfully updated encoding profile", zap.Int("id", profile.ID))
+	return nil
+}
+
+// Delete deletes one of an organization's encoding profiles by ID
+func (r *ProfileRepository) Delete(id, orgID int) error {
+	r.logger.Info("Deleting encoding profile", zap.Int("id", id), zap.Int("organization_id", orgID))
+
+	query := `DELETE FROM encoding_profiles WHERE id = $1 AND organization_id = $2`
+
+	result, err := r.db.Exec(query, id, orgID)
+	if err != nil {
+		r.logger.Error("Error deleting encoding profile",
+			zap.Int("id", id),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Error getting rows affected", zap.Error(err))
+		return err
+	}
+
+	if rowsAffected == 0 {
+		r.logger.Warn("No encoding profile found to delete", zap.Int("id", id))
+		return errors.New("encoding profile not found")
+	}
+
+	r.logger.Info("Successfully deleted encoding profile", zap.Int("id", id))
+	return nil
+}
@@ -0,0 +1,65 @@
+package repos
+
+import (
+	"database/sql"
+
+	"streamkit/internal/api/models"
+
+	"go.uber.org/zap"
+)
+
+type RecordingRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func NewRecordingRepository(db *sql.DB, logger *zap.Logger) *RecordingRepository {
+	return &RecordingRepository{db: db, logger: logger}
+}
+
+// GetByLiveStreamID retrieves all recordings of a stream, newest first
+func (r *RecordingRepository) GetByLiveStreamID(liveStreamID int) ([]*models.Recording, error) {
+	r.logger.Info("Getting recordings for stream", zap.Int("live_stream_id", liveStreamID))
+
+	query := `
+		SELECT id, live_stream_id, status, storage_prefix, duration_seconds, segment_count, sprite_sheets, started_at, ended_at
+		FROM recordings WHERE live_stream_id = $1 ORDER BY started_at DESC
+	`
+
+	rows, err := r.db.Query(query, liveStreamID)
+	if err != nil {
+		r.logger.Error("Error getting recordings",
+			zap.Int("live_stream_id", liveStreamID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordings := []*models.Recording{}
+	for rows.Next() {
+		recording := &models.Recording{}
+		err := rows.Scan(
+			&recording.ID,
+			&recording.LiveStreamID,
+			&recording.Status,
+			&recording.StoragePrefix,
+			&recording.DurationSeconds,
+			&recording.SegmentCount,
+			&recording.SpriteSheets,
+			&recording.StartedAt,
+			&recording.EndedAt,
+		)
+		if err != nil {
+			r.logger.Error("Error scanning recording row", zap.Error(err))
+			return nil, err
+		}
+		recordings = append(recordings, recording)
+	}
+
+	r.logger.Info("Successfully retrieved recordings",
+		zap.Int("live_stream_id", liveStreamID),
+		zap.Int("count", len(recordings)),
+	)
+	return recordings, nil
+}
@@ -0,0 +1,101 @@
+package repos
+
+import (
+	"database/sql"
+	"time"
+
+	"streamkit/internal/api/models"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type SessionRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func NewSessionRepository(db *sql.DB, logger *zap.Logger) *SessionRepository {
+	return &SessionRepository{db: db, logger: logger}
+}
+
+// GetByLiveStreamID retrieves a stream's publish sessions, newest first.
+// Sessions are limited to those started in [startedAfter, startedBefore)
+// when the bounds are set.
+func (r *SessionRepository) GetByLiveStreamID(
+	liveStreamID int,
+	startedAfter, startedBefore *time.Time,
+	limit int,
+) ([]*models.StreamSession, error) {
+	r.logger.Info("Getting sessions for stream",
+		zap.Int("live_stream_id", liveStreamID),
+		zap.Int("limit", limit),
+	)
+
+	query := `
+		SELECT id, live_stream_id, started_at, ended_at, duration_seconds, end_reason,
+			bytes_ingested, segments_produced, input_probed_at, input_video_codec,
+			input_width, input_height, input_frame_rate, input_keyframe_interval,
+			input_audio_codec, input_audio_sample_rate, input_audio_channels, input_warnings
+		FROM stream_sessions
+		WHERE live_stream_id = $1
+			AND ($2::timestamp IS NULL OR started_at >= $2)
+			AND ($3::timestamp IS NULL OR started_at < $3)
+		ORDER BY started_at DESC, id DESC
+		LIMIT $4
+	`
+
+	rows, err := r.db.Query(query, liveStreamID, startedAfter, startedBefore, limit)
+	if err != nil {
+		r.logger.Error("Error getting sessions",
+			zap.Int("live_stream_id", liveStreamID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.StreamSession{}
+	for rows.Next() {
+		session := &models.StreamSession{}
+		input := &models.SessionInput{}
+		var probedAt *time.Time
+		var warnings pq.StringArray
+		err := rows.Scan(
+			&session.ID,
+			&session.LiveStreamID,
+			&session.StartedAt,
+			&session.EndedAt,
+			&session.DurationSeconds,
+			&session.EndReason,
+			&session.BytesIngested,
+			&session.SegmentsProduced,
+			&probedAt,
+			&input.VideoCodec,
+			&input.Width,
+			&input.Height,
+			&input.FrameRate,
+			&input.KeyframeInterval,
+			&input.AudioCodec,
+			&input.AudioSampleRate,
+			&input.AudioChannels,
+			&warnings,
+		)
+		if err != nil {
+			r.logger.Error("Error scanning session row", zap.Error(err))
+			return nil, err
+		}
+		if probedAt != nil {
+			input.ProbedAt = *probedAt
+			input.Warnings = append([]string{}, warnings...)
+			session.Input = input
+		}
+		sessions = append(sessions, session)
+	}
+
+	r.logger.Info("Successfully retrieved sessions",
+		zap.Int("live_stream_id", liveStreamID),
+		zap.Int("count", len(sessions)),
+	)
+	return sessions, nil
+}
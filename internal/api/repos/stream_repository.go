@@ -3,6 +3,8 @@ package repos
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"streamkit/internal/api/models"
@@ -29,15 +31,25 @@ func (r *StreamRepository) Create(stream *models.LiveStream) error {
 	)
 
 	stream.StreamKey = uuid.New().String()
+	stream.PlaybackID = strings.ReplaceAll(uuid.New().String(), "-", "")
 	stream.CreatedAt = time.Now()
-	stream.Status = "inactive"
+	stream.Status = models.StreamStatusCreated
 
-	r.logger.Info("Generated stream key", zap.String("stream_key", stream.StreamKey))
+	r.logger.Info("Generated stream identifiers",
+		zap.String("stream_key", stream.StreamKey),
+		zap.String("playback_id", stream.PlaybackID),
+	)
 
+	// The stream's status history starts with its creation
 	query := `
-		INSERT INTO live_streams (stream_key, ingest_url, playback_url, title, stream_name, stream_created_by, description, created_at, status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id
+		WITH created AS (
+			INSERT INTO live_streams (stream_key, playback_id, ingest_url, playback_url, title, stream_name, stream_created_by, owner_id, organization_id, description, created_at, status, encoding_profile_id, recording_enabled, encryption_enabled, key_rotation_seconds)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+			RETURNING id
+		)
+		INSERT INTO stream_status_history (live_stream_id, to_status, reason, created_at)
+		SELECT id, $12, 'stream created', $11 FROM created
+		RETURNING live_stream_id
 	`
 
 	r.logger.Debug("Executing query",
@@ -50,14 +62,21 @@ func (r *StreamRepository) Create(stream *models.LiveStream) error {
 	var id int
 	err := r.db.QueryRow(query,
 		stream.StreamKey,
+		stream.PlaybackID,
 		stream.IngestURL,
 		stream.PlaybackURL,
 		stream.Title,
 		stream.StreamName,
 		stream.StreamCreatedBy,
+		stream.OwnerID,
+		stream.OrganizationID,
 		stream.Description,
 		stream.CreatedAt,
 		stream.Status,
+		stream.EncodingProfileID,
+		stream.RecordingEnabled,
+		stream.EncryptionEnabled,
+		stream.KeyRotationSeconds,
 	).Scan(&id)
 	if err != nil {
 		r.logger.Error("Error creating stream",
@@ -76,27 +95,46 @@ func (r *StreamRepository) Create(stream *models.LiveStream) error {
 	return nil
 }
 
-// GetByID retrieves a stream by ID
-func (r *StreamRepository) GetByID(id int) (*models.LiveStream, error) {
-	r.logger.Info("Getting stream by ID", zap.Int("id", id))
+// managedBy is the condition limiting live_streams to the streams a user
+// manages: their own, and the ownerless streams of their organization that
+// were created before authentication. Its placeholders, $n and $n+1, take
+// the user's organization ID and ID.
+func managedBy(n int) string {
+	return fmt.Sprintf("organization_id = $%d AND (owner_id = $%d OR owner_id IS NULL)", n, n+1)
+}
+
+// GetByID retrieves one of the streams a user manages by ID
+func (r *StreamRepository) GetByID(id int, user *models.User) (*models.LiveStream, error) {
+	r.logger.Info("Getting stream by ID", zap.Int("id", id), zap.Int("user_id", user.ID))
 
 	stream := &models.LiveStream{}
 	query := `
-		SELECT id, stream_key, ingest_url, playback_url, title, stream_name, stream_created_by, description, created_at, status
-		FROM live_streams WHERE id = $1
-	`
+		SELECT id, stream_key, playback_id, ingest_url, playback_url, title, stream_name, stream_created_by, owner_id, organization_id, description, created_at, status, started_at, stopped_at, encoding_profile_id, recording_enabled,
+			encryption_enabled, key_rotation_seconds,
+			COALESCE((SELECT packaging FROM encoding_profiles WHERE encoding_profiles.id = live_streams.encoding_profile_id), 'hls')
+		FROM live_streams WHERE id = $1 AND ` + managedBy(2)
 
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRow(query, id, user.OrganizationID, user.ID).Scan(
 		&stream.ID,
 		&stream.StreamKey,
+		&stream.PlaybackID,
 		&stream.IngestURL,
 		&stream.PlaybackURL,
 		&stream.Title,
 		&stream.StreamName,
 		&stream.StreamCreatedBy,
+		&stream.OwnerID,
+		&stream.OrganizationID,
 		&stream.Description,
 		&stream.CreatedAt,
 		&stream.Status,
+		&stream.StartedAt,
+		&stream.StoppedAt,
+		&stream.EncodingProfileID,
+		&stream.RecordingEnabled,
+		&stream.EncryptionEnabled,
+		&stream.KeyRotationSeconds,
+		&stream.Packaging,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -114,27 +152,38 @@ func (r *StreamRepository) GetByID(id int) (*models.LiveStream, error) {
 	return stream, nil
 }
 
-// GetByStreamKey retrieves a stream by stream key
-func (r *StreamRepository) GetByStreamKey(streamKey string) (*models.LiveStream, error) {
+// GetByStreamKey retrieves one of the streams a user manages by stream key
+func (r *StreamRepository) GetByStreamKey(streamKey string, user *models.User) (*models.LiveStream, error) {
 	r.logger.Info("Getting stream by stream key", zap.String("stream_key", streamKey))
 
 	stream := &models.LiveStream{}
 	query := `
-		SELECT id, stream_key, ingest_url, playback_url, title, stream_name, stream_created_by, description, created_at, status
-		FROM live_streams WHERE stream_key = $1
-	`
+		SELECT id, stream_key, playback_id, ingest_url, playback_url, title, stream_name, stream_created_by, owner_id, organization_id, description, created_at, status, started_at, stopped_at, encoding_profile_id, recording_enabled,
+			encryption_enabled, key_rotation_seconds,
+			COALESCE((SELECT packaging FROM encoding_profiles WHERE encoding_profiles.id = live_streams.encoding_profile_id), 'hls')
+		FROM live_streams WHERE stream_key = $1 AND ` + managedBy(2)
 
-	err := r.db.QueryRow(query, streamKey).Scan(
+	err := r.db.QueryRow(query, streamKey, user.OrganizationID, user.ID).Scan(
 		&stream.ID,
 		&stream.StreamKey,
+		&stream.PlaybackID,
 		&stream.IngestURL,
 		&stream.PlaybackURL,
 		&stream.Title,
 		&stream.StreamName,
 		&stream.StreamCreatedBy,
+		&stream.OwnerID,
+		&stream.OrganizationID,
 		&stream.Description,
 		&stream.CreatedAt,
 		&stream.Status,
+		&stream.StartedAt,
+		&stream.StoppedAt,
+		&stream.EncodingProfileID,
+		&stream.RecordingEnabled,
+		&stream.EncryptionEnabled,
+		&stream.KeyRotationSeconds,
+		&stream.Packaging,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -152,36 +201,121 @@ func (r *StreamRepository) GetByStreamKey(streamKey string) (*models.LiveStream,
 	return stream, nil
 }
 
-// GetAll retrieves all streams
-func (r *StreamRepository) GetAll() ([]*models.LiveStream, error) {
-	r.logger.Info("Getting all streams")
+// StreamSortColumns maps the sort fields a stream listing accepts to the
+// columns of List's matches they order by
+var StreamSortColumns = map[string]string{
+	"created_at":               "created_at",
+	"title":                    "title",
+	"stream_name":              "stream_name",
+	models.StreamSortRelevance: "search_rank",
+}
 
-	query := `
-		SELECT id, stream_key, ingest_url, playback_url, title, stream_name, stream_created_by, description, created_at, status
-		FROM live_streams ORDER BY created_at DESC
-	`
+// List retrieves a page of the streams a user manages matching query, using
+// keyset pagination on the sort column and ID. Searches rank title matches
+// above description matches, using the weights of search_vector. It returns
+// up to query.Limit+1 streams so callers can tell whether another page
+// follows.
+func (r *StreamRepository) List(user *models.User, query *models.StreamListQuery) ([]*models.LiveStream, error) {
+	r.logger.Info("Listing streams",
+		zap.Int("user_id", user.ID),
+		zap.String("sort", query.Sort),
+		zap.String("order", query.Order),
+		zap.Int("limit", query.Limit),
+	)
 
-	rows, err := r.db.Query(query)
+	column, ok := StreamSortColumns[query.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %q", query.Sort)
+	}
+	direction, comparison := "ASC", ">"
+	if query.Order == "desc" {
+		direction, comparison = "DESC", "<"
+	}
+
+	conditions := []string{managedBy(1)}
+	args := []interface{}{user.OrganizationID, user.ID}
+	addCondition := func(format string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(format, placeholders...))
+	}
+
+	if query.Status != "" {
+		addCondition("status = $%d", query.Status)
+	}
+	if query.CreatedBy != "" {
+		addCondition("stream_created_by = $%d", query.CreatedBy)
+	}
+	if query.CreatedAfter != nil {
+		addCondition("created_at >= $%d", *query.CreatedAfter)
+	}
+	if query.CreatedBefore != nil {
+		addCondition("created_at < $%d", *query.CreatedBefore)
+	}
+	searchRank := "0::real"
+	if query.Search != "" {
+		addCondition("search_vector @@ websearch_to_tsquery('english', $%d)", query.Search)
+		searchRank = fmt.Sprintf("ts_rank(search_vector, websearch_to_tsquery('english', $%d))", len(args))
+	}
+
+	// The page position applies to the matches, where search_rank exists
+	position := "TRUE"
+	if query.After != nil {
+		args = append(args, query.After.Value, query.After.ID)
+		position = fmt.Sprintf("(%s, id) %s ($%d, $%d)", column, comparison, len(args)-1, len(args))
+	}
+	args = append(args, query.Limit+1)
+
+	sqlQuery := fmt.Sprintf(`
+		SELECT id, stream_key, playback_id, ingest_url, playback_url, title, stream_name, stream_created_by, owner_id, organization_id, description, created_at, status, started_at, stopped_at, encoding_profile_id, recording_enabled,
+			encryption_enabled, key_rotation_seconds,
+			COALESCE((SELECT packaging FROM encoding_profiles WHERE encoding_profiles.id = matches.encoding_profile_id), 'hls'),
+			search_rank
+		FROM (
+			SELECT *, %s AS search_rank
+			FROM live_streams
+			WHERE %s
+		) AS matches
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT $%d
+	`, searchRank, strings.Join(conditions, " AND "), position, column, direction, direction, len(args))
+
+	rows, err := r.db.Query(sqlQuery, args...)
 	if err != nil {
-		r.logger.Error("Error getting all streams", zap.Error(err))
+		r.logger.Error("Error listing streams", zap.Error(err))
 		return nil, err
 	}
 	defer rows.Close()
 
-	var streams []*models.LiveStream
+	streams := []*models.LiveStream{}
 	for rows.Next() {
 		stream := &models.LiveStream{}
 		err := rows.Scan(
 			&stream.ID,
 			&stream.StreamKey,
+			&stream.PlaybackID,
 			&stream.IngestURL,
 			&stream.PlaybackURL,
 			&stream.Title,
 			&stream.StreamName,
 			&stream.StreamCreatedBy,
+			&stream.OwnerID,
+			&stream.OrganizationID,
 			&stream.Description,
 			&stream.CreatedAt,
 			&stream.Status,
+			&stream.StartedAt,
+			&stream.StoppedAt,
+			&stream.EncodingProfileID,
+			&stream.RecordingEnabled,
+			&stream.EncryptionEnabled,
+			&stream.KeyRotationSeconds,
+			&stream.Packaging,
+			&stream.SearchRank,
 		)
 		if err != nil {
 			r.logger.Error("Error scanning stream row", zap.Error(err))
@@ -189,13 +323,18 @@ func (r *StreamRepository) GetAll() ([]*models.LiveStream, error) {
 		}
 		streams = append(streams, stream)
 	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating stream rows", zap.Error(err))
+		return nil, err
+	}
 
-	r.logger.Info("Successfully retrieved streams", zap.Int("count", len(streams)))
+	r.logger.Info("Successfully listed streams", zap.Int("count", len(streams)))
 	return streams, nil
 }
 
-// Update updates a stream
-func (r *StreamRepository) Update(stream *models.LiveStream) error {
+// Update updates one of the streams a user manages. The status is owned by
+// the encoder and UpdateStatus, so it is not written here.
+func (r *StreamRepository) Update(stream *models.LiveStream, user *models.User) error {
 	r.logger.Info("Updating stream",
 		zap.Int("id", stream.ID),
 		zap.String("title", stream.Title),
@@ -203,17 +342,21 @@ func (r *StreamRepository) Update(stream *models.LiveStream) error {
 
 	query := `
 		UPDATE live_streams 
-		SET title = $1, stream_name = $2, stream_created_by = $3, description = $4, status = $5
-		WHERE id = $6
-	`
+		SET title = $1, stream_name = $2, description = $3, encoding_profile_id = $4,
+			recording_enabled = $5, encryption_enabled = $6, key_rotation_seconds = $7
+		WHERE id = $8 AND ` + managedBy(9)
 
 	result, err := r.db.Exec(query,
 		stream.Title,
 		stream.StreamName,
-		stream.StreamCreatedBy,
 		stream.Description,
-		stream.Status,
+		stream.EncodingProfileID,
+		stream.RecordingEnabled,
+		stream.EncryptionEnabled,
+		stream.KeyRotationSeconds,
 		stream.ID,
+		user.OrganizationID,
+		user.ID,
 	)
 	if err != nil {
 		r.logger.Error("Error updating stream",
@@ -238,13 +381,26 @@ func (r *StreamRepository) Update(stream *models.LiveStream) error {
 	return nil
 }
 
-// Delete deletes a stream by ID
-func (r *StreamRepository) Delete(id int) error {
-	r.logger.Info("Deleting stream", zap.Int("id", id))
+// Delete deletes one of the streams a user manages by ID and queues its
+// files for deletion from storage
+func (r *StreamRepository) Delete(id int, user *models.User) error {
+	r.logger.Info("Deleting stream", zap.Int("id", id), zap.Int("user_id", user.ID))
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.Error("Error starting transaction", zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
 
-	query := `DELETE FROM live_streams WHERE id = $1`
+	query := `DELETE FROM live_streams WHERE id = $1 AND ` + managedBy(2) + ` RETURNING playback_id`
 
-	result, err := r.db.Exec(query, id)
+	var playbackID sql.NullString
+	err = tx.QueryRow(query, id, user.OrganizationID, user.ID).Scan(&playbackID)
+	if err == sql.ErrNoRows {
+		r.logger.Warn("No stream found to delete", zap.Int("id", id))
+		return errors.New("stream not found")
+	}
 	if err != nil {
 		r.logger.Error("Error deleting stream",
 			zap.Int("id", id),
@@ -253,35 +409,59 @@ func (r *StreamRepository) Delete(id int) error {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		r.logger.Error("Error getting rows affected", zap.Error(err))
-		return err
+	// The encoder service deletes the stream's thumbnail, live output and
+	// recordings from storage
+	if playbackID.Valid {
+		query = `
+			INSERT INTO storage_cleanups (storage_prefix, playback_id)
+			SELECT storage_prefix, $1 FROM organizations WHERE id = $2
+		`
+
+		if _, err := tx.Exec(query, playbackID.String, user.OrganizationID); err != nil {
+			r.logger.Error("Error queueing stream storage cleanup",
+				zap.Int("id", id),
+				zap.Error(err),
+			)
+			return err
+		}
 	}
 
-	if rowsAffected == 0 {
-		r.logger.Warn("No stream found to delete", zap.Int("id", id))
-		return errors.New("stream not found")
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("Error committing stream deletion", zap.Error(err))
+		return err
 	}
 
 	r.logger.Info("Successfully deleted stream", zap.Int("id", id))
 	return nil
 }
 
-// UpdateStatus updates the status of a stream
-func (r *StreamRepository) UpdateStatus(id int, status string) error {
+// UpdateStatus moves one of the streams a user manages from one status to
+// another and records the change in its status history. It fails with
+// "stream status changed" if the stream is no longer in the from status.
+func (r *StreamRepository) UpdateStatus(id int, user *models.User, from, to, reason string) error {
 	r.logger.Info("Updating stream status",
 		zap.Int("id", id),
-		zap.String("status", status),
+		zap.Int("user_id", user.ID),
+		zap.String("from_status", from),
+		zap.String("to_status", to),
 	)
 
-	query := `UPDATE live_streams SET status = $1 WHERE id = $2`
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.Error("Error starting transaction", zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE live_streams SET status = $1
+		WHERE id = $2 AND status = $3 AND ` + managedBy(4)
 
-	result, err := r.db.Exec(query, status, id)
+	result, err := tx.Exec(query, to, id, from, user.OrganizationID, user.ID)
 	if err != nil {
 		r.logger.Error("Error updating stream status",
 			zap.Int("id", id),
-			zap.String("status", status),
+			zap.String("status", to),
 			zap.Error(err),
 		)
 		return err
@@ -294,13 +474,71 @@ func (r *StreamRepository) UpdateStatus(id int, status string) error {
 	}
 
 	if rowsAffected == 0 {
-		r.logger.Warn("No stream found to update status", zap.Int("id", id))
-		return errors.New("stream not found")
+		r.logger.Warn("Stream status changed before update", zap.Int("id", id))
+		return errors.New("stream status changed")
+	}
+
+	query = `
+		INSERT INTO stream_status_history (live_stream_id, from_status, to_status, reason)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	if _, err := tx.Exec(query, id, from, to, reason); err != nil {
+		r.logger.Error("Error recording stream status change",
+			zap.Int("id", id),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("Error committing stream status change", zap.Error(err))
+		return err
 	}
 
 	r.logger.Info("Successfully updated stream status",
 		zap.Int("id", id),
-		zap.String("status", status),
+		zap.String("status", to),
 	)
 	return nil
 }
+
+// GetStatusHistory retrieves a stream's status changes, newest first
+func (r *StreamRepository) GetStatusHistory(id, limit int) ([]*models.StreamStatusChange, error) {
+	r.logger.Info("Getting stream status history", zap.Int("id", id), zap.Int("limit", limit))
+
+	query := `
+		SELECT id, live_stream_id, from_status, to_status, reason, created_at
+		FROM stream_status_history
+		WHERE live_stream_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(query, id, limit)
+	if err != nil {
+		r.logger.Error("Error getting stream status history", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*models.StreamStatusChange{}
+	for rows.Next() {
+		change := &models.StreamStatusChange{}
+		err := rows.Scan(
+			&change.ID,
+			&change.LiveStreamID,
+			&change.FromStatus,
+			&change.ToStatus,
+			&change.Reason,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			r.logger.Error("Error scanning stream status change", zap.Error(err))
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
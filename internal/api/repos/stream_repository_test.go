@@ -0,0 +1,32 @@
+package repos
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/api/models"
+)
+
+func TestListRejectsSortOutsideWhitelist(t *testing.T) {
+	// Sort fields are interpolated into the query, so anything outside
+	// StreamSortColumns must fail before the database is used
+	repo := NewStreamRepository(nil, zap.NewNop())
+
+	tests := []string{
+		"",
+		"id",
+		"search_rank",
+		"title DESC, (SELECT 1)",
+		"created_at; DROP TABLE live_streams",
+	}
+
+	for _, sort := range tests {
+		t.Run(sort, func(t *testing.T) {
+			_, err := repo.List(&models.User{ID: 1, OrganizationID: 1}, &models.StreamListQuery{Sort: sort, Order: "asc", Limit: 10})
+			if err == nil {
+				t.Errorf("List() with sort %q succeeded, want error", sort)
+			}
+		})
+	}
+}
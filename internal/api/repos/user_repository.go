@@ -0,0 +1,76 @@
+package repos
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"streamkit/internal/api/models"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type UserRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func NewUserRepository(db *sql.DB, logger *zap.Logger) *UserRepository {
+	return &UserRepository{db: db, logger: logger}
+}
+
+// Create creates a new user
+func (r *UserRepository) Create(user *models.User) error {
+	r.logger.Info("Creating user", zap.String("email", user.Email))
+
+	user.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO users (organization_id, email, name, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	err := r.db.QueryRow(query, user.OrganizationID, user.Email, user.Name, user.CreatedAt).Scan(&user.ID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			r.logger.Warn("User already exists", zap.String("email", user.Email))
+			return errors.New("user already exists")
+		}
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			r.logger.Warn("Organization not found", zap.Int("organization_id", user.OrganizationID))
+			return errors.New("organization not found")
+		}
+		r.logger.Error("Error creating user", zap.String("email", user.Email), zap.Error(err))
+		return err
+	}
+
+	r.logger.Info("Successfully created user", zap.Int("id", user.ID))
+	return nil
+}
+
+// GetByID retrieves a user by ID
+func (r *UserRepository) GetByID(id int) (*models.User, error) {
+	user := &models.User{}
+	query := `SELECT id, organization_id, email, name, created_at FROM users WHERE id = $1`
+
+	err := r.db.QueryRow(query, id).Scan(
+		&user.ID,
+		&user.OrganizationID,
+		&user.Email,
+		&user.Name,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.logger.Warn("User not found", zap.Int("id", id))
+			return nil, errors.New("user not found")
+		}
+		r.logger.Error("Error getting user", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+
+	return user, nil
+}
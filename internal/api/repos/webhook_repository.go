@@ -0,0 +1,204 @@
+package repos
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"streamkit/internal/api/models"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type WebhookRepository struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func NewWebhookRepository(db *sql.DB, logger *zap.Logger) *WebhookRepository {
+	return &WebhookRepository{db: db, logger: logger}
+}
+
+// Create creates a new webhook subscription
+func (r *WebhookRepository) Create(subscription *models.WebhookSubscription) error {
+	r.logger.Info("Creating webhook subscription", zap.String("url", subscription.URL))
+
+	subscription.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO webhook_subscriptions (organization_id, url, secret, events, active, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	err := r.db.QueryRow(query,
+		subscription.OrganizationID,
+		subscription.URL,
+		subscription.Secret,
+		pq.Array(subscription.Events),
+		subscription.Active,
+		subscription.CreatedAt,
+	).Scan(&subscription.ID)
+	if err != nil {
+		r.logger.Error("Error creating webhook subscription", zap.Error(err))
+		return err
+	}
+
+	r.logger.Info("Successfully created webhook subscription", zap.Int("id", subscription.ID))
+	return nil
+}
+
+// GetByID retrieves one of an organization's webhook subscriptions by ID,
+// without its secret
+func (r *WebhookRepository) GetByID(id, orgID int) (*models.WebhookSubscription, error) {
+	r.logger.Info("Getting webhook subscription by ID", zap.Int("id", id))
+
+	subscription := &models.WebhookSubscription{}
+	query := `
+		SELECT id, organization_id, url, events, active, created_at
+		FROM webhook_subscriptions WHERE id = $1 AND organization_id = $2
+	`
+
+	err := r.db.QueryRow(query, id, orgID).Scan(
+		&subscription.ID,
+		&subscription.OrganizationID,
+		&subscription.URL,
+		pq.Array(&subscription.Events),
+		&subscription.Active,
+		&subscription.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.logger.Warn("Webhook subscription not found", zap.Int("id", id))
+			return nil, errors.New("webhook subscription not found")
+		}
+		r.logger.Error("Error getting webhook subscription", zap.Int("id", id), zap.Error(err))
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+// GetAll retrieves all webhook subscriptions of an organization, without
+// their secrets
+func (r *WebhookRepository) GetAll(orgID int) ([]*models.WebhookSubscription, error) {
+	r.logger.Info("Getting all webhook subscriptions", zap.Int("organization_id", orgID))
+
+	query := `
+		SELECT id, organization_id, url, events, active, created_at
+		FROM webhook_subscriptions WHERE organization_id = $1 ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(query, orgID)
+	if err != nil {
+		r.logger.Error("Error getting webhook subscriptions", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []*models.WebhookSubscription{}
+	for rows.Next() {
+		subscription := &models.WebhookSubscription{}
+		err := rows.Scan(
+			&subscription.ID,
+			&subscription.OrganizationID,
+			&subscription.URL,
+			pq.Array(&subscription.Events),
+			&subscription.Active,
+			&subscription.CreatedAt,
+		)
+		if err != nil {
+			r.logger.Error("Error scanning webhook subscription row", zap.Error(err))
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// Delete deletes one of an organization's webhook subscriptions and its
+// delivery log
+func (r *WebhookRepository) Delete(id, orgID int) error {
+	r.logger.Info("Deleting webhook subscription", zap.Int("id", id), zap.Int("organization_id", orgID))
+
+	result, err := r.db.Exec(
+		`DELETE FROM webhook_subscriptions WHERE id = $1 AND organization_id = $2`,
+		id, orgID,
+	)
+	if err != nil {
+		r.logger.Error("Error deleting webhook subscription", zap.Int("id", id), zap.Error(err))
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Error getting rows affected", zap.Error(err))
+		return err
+	}
+
+	if rowsAffected == 0 {
+		r.logger.Warn("No webhook subscription found to delete", zap.Int("id", id))
+		return errors.New("webhook subscription not found")
+	}
+
+	r.logger.Info("Successfully deleted webhook subscription", zap.Int("id", id))
+	return nil
+}
+
+// GetDeliveries retrieves the delivery log of a subscription, newest first.
+// An empty status returns deliveries in every status.
+func (r *WebhookRepository) GetDeliveries(
+	subscriptionID int,
+	status string,
+	limit int,
+) ([]*models.WebhookDelivery, error) {
+	r.logger.Info("Getting webhook deliveries",
+		zap.Int("subscription_id", subscriptionID),
+		zap.String("status", status),
+		zap.Int("limit", limit),
+	)
+
+	query := `
+		SELECT id, subscription_id, event_id, event_type, payload, status, attempts,
+			response_status, last_error, created_at, updated_at, next_attempt_at
+		FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(query, subscriptionID, status, limit)
+	if err != nil {
+		r.logger.Error("Error getting webhook deliveries", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery := &models.WebhookDelivery{}
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.SubscriptionID,
+			&delivery.EventID,
+			&delivery.EventType,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.ResponseStatus,
+			&delivery.LastError,
+			&delivery.CreatedAt,
+			&delivery.UpdatedAt,
+			&delivery.NextAttemptAt,
+		)
+		if err != nil {
+			r.logger.Error("Error scanning webhook delivery row", zap.Error(err))
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
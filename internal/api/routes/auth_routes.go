@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"streamkit/internal/api/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupAuthRoutes configures user and API key routes
+func SetupAuthRoutes(router *mux.Router, handler *handlers.AuthHandler) {
+	router.HandleFunc("/api/users", handler.CreateUser).Methods("POST")
+	router.HandleFunc("/api/me", handler.GetCurrentUser).Methods("GET")
+	router.HandleFunc("/api/keys", handler.CreateAPIKey).Methods("POST")
+	router.HandleFunc("/api/keys", handler.GetAPIKeys).Methods("GET")
+	router.HandleFunc("/api/keys/{id:[0-9]+}", handler.RevokeAPIKey).Methods("DELETE")
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"streamkit/internal/api/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupOrganizationRoutes configures organization routes
+func SetupOrganizationRoutes(router *mux.Router, handler *handlers.OrganizationHandler) {
+	router.HandleFunc("/api/organizations", handler.CreateOrganization).Methods("POST")
+	router.HandleFunc("/api/organization", handler.GetCurrentOrganization).Methods("GET")
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"streamkit/internal/api/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupProfileRoutes configures all encoding profile routes
+func SetupProfileRoutes(router *mux.Router, handler *handlers.ProfileHandler) {
+	router.HandleFunc("/api/profiles", handler.CreateProfile).Methods("POST")
+	router.HandleFunc("/api/profiles", handler.GetAllProfiles).Methods("GET")
+	router.HandleFunc("/api/profiles/{id:[0-9]+}", handler.GetProfile).Methods("GET")
+	router.HandleFunc("/api/profiles/{id:[0-9]+}", handler.UpdateProfile).Methods("PUT")
+	router.HandleFunc("/api/profiles/{id:[0-9]+}", handler.DeleteProfile).Methods("DELETE")
+}
@@ -17,4 +17,16 @@ func SetupStreamRoutes(router *mux.Router, handler *handlers.StreamHandler) {
 	router.HandleFunc("/api/streams/{id:[0-9]+}", handler.DeleteStream).Methods("DELETE")
 	router.HandleFunc("/api/streams/{id:[0-9]+}/status", handler.UpdateStreamStatus).
 		Methods("PATCH")
+	router.HandleFunc("/api/streams/{id:[0-9]+}/status-history", handler.GetStreamStatusHistory).
+		Methods("GET")
+	router.HandleFunc("/api/streams/{id:[0-9]+}/sessions", handler.GetStreamSessions).
+		Methods("GET")
+	router.HandleFunc("/api/streams/{id:[0-9]+}/recordings", handler.GetStreamRecordings).
+		Methods("GET")
+	router.HandleFunc("/api/streams/{id:[0-9]+}/playback-token", handler.CreatePlaybackToken).
+		Methods("POST")
+
+	// Key URIs of encrypted playlists, authenticated by their signature
+	// rather than an API key, so they are outside /api/
+	router.HandleFunc("/keys/{playbackId}/{keyId:[0-9]+}", handler.GetEncryptionKey).Methods("GET")
 }
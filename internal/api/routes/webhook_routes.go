@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"streamkit/internal/api/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupWebhookRoutes configures all webhook subscription routes
+func SetupWebhookRoutes(router *mux.Router, handler *handlers.WebhookHandler) {
+	router.HandleFunc("/api/webhooks", handler.CreateSubscription).Methods("POST")
+	router.HandleFunc("/api/webhooks", handler.GetAllSubscriptions).Methods("GET")
+	router.HandleFunc("/api/webhooks/{id:[0-9]+}", handler.GetSubscription).Methods("GET")
+	router.HandleFunc("/api/webhooks/{id:[0-9]+}", handler.DeleteSubscription).Methods("DELETE")
+	router.HandleFunc("/api/webhooks/{id:[0-9]+}/deliveries", handler.GetDeliveries).
+		Methods("GET")
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"streamkit/internal/api/models"
+	"streamkit/internal/api/repos"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidUser is returned when a user or API key fails validation
+var ErrInvalidUser = errors.New("invalid user")
+
+// ErrUnauthorized is returned when an API key is missing, unknown or revoked
+var ErrUnauthorized = errors.New("invalid or missing API key")
+
+// apiKeyPrefix marks StreamKit API keys so they are easy to spot in logs and
+// secret scanners
+const apiKeyPrefix = "sk_"
+
+type AuthService struct {
+	userRepo   *repos.UserRepository
+	apiKeyRepo *repos.APIKeyRepository
+	logger     *zap.Logger
+}
+
+func NewAuthService(
+	userRepo *repos.UserRepository,
+	apiKeyRepo *repos.APIKeyRepository,
+	logger *zap.Logger,
+) *AuthService {
+	logger.Info("Initializing AuthService")
+	return &AuthService{
+		userRepo:   userRepo,
+		apiKeyRepo: apiKeyRepo,
+		logger:     logger,
+	}
+}
+
+// CreateUser validates and creates a user in an existing organization,
+// together with its first API key
+func (s *AuthService) CreateUser(user *models.User) (*models.APIKey, error) {
+	s.logger.Info("Creating user", zap.String("email", user.Email))
+
+	user.Email = strings.TrimSpace(user.Email)
+	user.Name = strings.TrimSpace(user.Name)
+	if _, err := mail.ParseAddress(user.Email); err != nil {
+		return nil, fmt.Errorf("%w: email must be a valid address", ErrInvalidUser)
+	}
+	if user.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidUser)
+	}
+	if user.OrganizationID <= 0 {
+		return nil, fmt.Errorf("%w: organization_id is required", ErrInvalidUser)
+	}
+
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+
+	return s.CreateAPIKey(user.ID, "default")
+}
+
+// Authenticate returns the user an API key belongs to
+func (s *AuthService) Authenticate(key string) (*models.User, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrUnauthorized
+	}
+
+	user, err := s.apiKeyRepo.GetUserByKeyHash(hashAPIKey(key))
+	if err != nil {
+		if err.Error() == "api key not found" {
+			return nil, ErrUnauthorized
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateAPIKey generates a new API key for a user. The returned key is the
+// only copy of the secret; just its hash is stored.
+func (s *AuthService) CreateAPIKey(userID int, name string) (*models.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: api key name is required", ErrInvalidUser)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		s.logger.Error("Error generating API key", zap.Error(err))
+		return nil, err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+
+	apiKey := &models.APIKey{
+		UserID: userID,
+		Name:   name,
+		Prefix: key[:len(apiKeyPrefix)+8],
+	}
+	if err := s.apiKeyRepo.Create(apiKey, hashAPIKey(key)); err != nil {
+		s.logger.Error("Error creating API key", zap.Int("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	apiKey.Key = key
+
+	s.logger.Info("Successfully created API key",
+		zap.Int("id", apiKey.ID),
+		zap.Int("user_id", userID),
+	)
+	return apiKey, nil
+}
+
+// GetAPIKeys lists a user's active API keys, without their secrets
+func (s *AuthService) GetAPIKeys(userID int) ([]*models.APIKey, error) {
+	return s.apiKeyRepo.GetByUserID(userID)
+}
+
+// RevokeAPIKey revokes one of a user's API keys
+func (s *AuthService) RevokeAPIKey(userID, id int) error {
+	return s.apiKeyRepo.Revoke(id, userID)
+}
+
+// hashAPIKey returns the stored form of an API key. Keys are 256-bit random
+// values, so a fast unsalted hash is enough to make a leaked table useless.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/api/models"
+)
+
+var (
+	// ErrInvalidStreamEncryption is returned when a stream's encryption
+	// settings are invalid
+	ErrInvalidStreamEncryption = errors.New("invalid stream encryption settings")
+
+	// ErrEncryptionNotConfigured is returned when a key is requested but
+	// HLS_KEY_ENCRYPTION_KEY is not set
+	ErrEncryptionNotConfigured = errors.New("encryption is not configured")
+
+	// ErrInvalidPlaybackTokenTTL is returned when a playback token is
+	// requested with a lifetime out of range
+	ErrInvalidPlaybackTokenTTL = errors.New("ttl_seconds must be between 60 and 86400")
+)
+
+const (
+	// defaultPlaybackTokenTTL is the lifetime of playback tokens requested
+	// without one
+	defaultPlaybackTokenTTL = time.Hour
+
+	// minPlaybackTokenTTL and maxPlaybackTokenTTL bound the lifetime of
+	// playback tokens
+	minPlaybackTokenTTL = time.Minute
+	maxPlaybackTokenTTL = 24 * time.Hour
+)
+
+// checkEncryption validates a stream's encryption settings. Encryption needs
+// HLS_KEY_ENCRYPTION_KEY, without which the stream's keys could neither be
+// sealed by the encoder nor served. FFmpeg only encrypts MPEG-TS segments, so
+// encryption also needs hls packaging; it must run after checkEncodingProfile.
+func (s *StreamService) checkEncryption(stream *models.LiveStream) error {
+	if stream.KeyRotationSeconds != 0 &&
+		(stream.KeyRotationSeconds < 10 || stream.KeyRotationSeconds > 86400) {
+		return fmt.Errorf("%w: key_rotation_seconds must be 0 or between 10 and 86400", ErrInvalidStreamEncryption)
+	}
+	if stream.EncryptionEnabled && s.keyring == nil {
+		return fmt.Errorf("%w: encryption is not configured on this server", ErrInvalidStreamEncryption)
+	}
+	if stream.EncryptionEnabled && stream.Packaging != models.PackagingHLS {
+		return fmt.Errorf("%w: encryption requires an encoding profile with hls packaging", ErrInvalidStreamEncryption)
+	}
+	return nil
+}
+
+// CreatePlaybackToken issues a playback token for one of the streams a user
+// manages, valid for ttl, or defaultPlaybackTokenTTL when ttl is 0. Viewers
+// need one to play the stream's encrypted playlists: the encoder only signs
+// their key URIs for requests carrying a valid token.
+func (s *StreamService) CreatePlaybackToken(id int, user *models.User, ttl time.Duration) (*models.PlaybackToken, error) {
+	if s.keyring == nil {
+		return nil, ErrEncryptionNotConfigured
+	}
+	if ttl == 0 {
+		ttl = defaultPlaybackTokenTTL
+	}
+	if ttl < minPlaybackTokenTTL || ttl > maxPlaybackTokenTTL {
+		return nil, ErrInvalidPlaybackTokenTTL
+	}
+
+	stream, err := s.repo.GetByID(id, user)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	token := s.keyring.SignPlaybackToken(stream.PlaybackID, expires)
+	playbackURL := s.GetStreamWithFullURLs(stream).PlaybackURL + "?" + url.Values{"token": {token}}.Encode()
+
+	s.logger.Info("Issued playback token",
+		zap.Int("id", id),
+		zap.Time("expires_at", expires),
+	)
+
+	return &models.PlaybackToken{
+		Token:       token,
+		ExpiresAt:   expires.UTC(),
+		PlaybackURL: playbackURL,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/api/models"
+	"streamkit/internal/shared/keyseal"
+)
+
+func TestCheckEncryption(t *testing.T) {
+	keyring, err := keyseal.New(strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	configured := &StreamService{logger: zap.NewNop(), keyring: keyring}
+	unconfigured := &StreamService{logger: zap.NewNop()}
+
+	tests := []struct {
+		name    string
+		service *StreamService
+		stream  models.LiveStream
+		wantErr bool
+	}{
+		{"encrypted", configured, models.LiveStream{EncryptionEnabled: true, Packaging: models.PackagingHLS}, false},
+		{"rotated keys", configured, models.LiveStream{EncryptionEnabled: true, KeyRotationSeconds: 60, Packaging: models.PackagingHLS}, false},
+		{"rotation too short", configured, models.LiveStream{EncryptionEnabled: true, KeyRotationSeconds: 5, Packaging: models.PackagingHLS}, true},
+		{"rotation too long", configured, models.LiveStream{KeyRotationSeconds: 86401, Packaging: models.PackagingHLS}, true},
+		{"cmaf packaging", configured, models.LiveStream{EncryptionEnabled: true, Packaging: models.PackagingCMAF}, true},
+		{"no key encryption key", unconfigured, models.LiveStream{EncryptionEnabled: true, Packaging: models.PackagingHLS}, true},
+		{"unencrypted without a key encryption key", unconfigured, models.LiveStream{Packaging: models.PackagingCMAF}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.service.checkEncryption(&tt.stream)
+			if tt.wantErr && !errors.Is(err, ErrInvalidStreamEncryption) {
+				t.Errorf("checkEncryption() error = %v, want ErrInvalidStreamEncryption", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("checkEncryption() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestCreatePlaybackTokenRejects(t *testing.T) {
+	keyring, err := keyseal.New(strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{ID: 1, OrganizationID: 1}
+
+	// The checks run before the stream is read
+	tests := []struct {
+		name    string
+		service *StreamService
+		ttl     time.Duration
+		wantErr error
+	}{
+		{"too short", &StreamService{logger: zap.NewNop(), keyring: keyring}, 59 * time.Second, ErrInvalidPlaybackTokenTTL},
+		{"too long", &StreamService{logger: zap.NewNop(), keyring: keyring}, 25 * time.Hour, ErrInvalidPlaybackTokenTTL},
+		{"negative", &StreamService{logger: zap.NewNop(), keyring: keyring}, -time.Hour, ErrInvalidPlaybackTokenTTL},
+		{"no key encryption key", &StreamService{logger: zap.NewNop()}, 0, ErrEncryptionNotConfigured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.service.CreatePlaybackToken(1, user, tt.ttl); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CreatePlaybackToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"streamkit/internal/api/models"
+	"streamkit/internal/api/repos"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidOrganization is returned when an organization fails validation
+var ErrInvalidOrganization = errors.New("invalid organization")
+
+// organizationSlugPattern keeps slugs usable as a storage path segment
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+type OrganizationService struct {
+	repo   *repos.OrganizationRepository
+	logger *zap.Logger
+}
+
+func NewOrganizationService(repo *repos.OrganizationRepository, logger *zap.Logger) *OrganizationService {
+	logger.Info("Initializing OrganizationService")
+	return &OrganizationService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// CreateOrganization validates and creates an organization. Its storage
+// prefix is derived from the slug and cannot be chosen by the client.
+func (s *OrganizationService) CreateOrganization(organization *models.Organization) error {
+	s.logger.Info("Creating organization", zap.String("slug", organization.Slug))
+
+	organization.Name = strings.TrimSpace(organization.Name)
+	if organization.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidOrganization)
+	}
+	if !organizationSlugPattern.MatchString(organization.Slug) {
+		return fmt.Errorf(
+			"%w: slug must be 1-63 lowercase letters, digits or hyphens",
+			ErrInvalidOrganization,
+		)
+	}
+	organization.StoragePrefix = "tenants/" + organization.Slug
+
+	if err := s.repo.Create(organization); err != nil {
+		return err
+	}
+
+	s.logger.Info("Successfully created organization", zap.Int("id", organization.ID))
+	return nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *OrganizationService) GetOrganization(id int) (*models.Organization, error) {
+	return s.repo.GetByID(id)
+}
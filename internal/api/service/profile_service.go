@@ -0,0 +1,180 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"streamkit/internal/api/models"
+	"streamkit/internal/api/repos"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidProfile is returned when an encoding profile fails validation
+var ErrInvalidProfile = errors.New("invalid encoding profile")
+
+// validPresets are the libx264 presets accepted in a profile
+var validPresets = map[string]bool{
+	"ultrafast": true, "superfast": true, "veryfast": true, "faster": true, "fast": true,
+	"medium": true, "slow": true, "slower": true, "veryslow": true,
+}
+
+// validTunes are the libx264 tunings accepted in a profile; empty means none
+var validTunes = map[string]bool{
+	"": true, "film": true, "animation": true, "grain": true,
+	"stillimage": true, "fastdecode": true, "zerolatency": true,
+}
+
+// validPackagings are the output packagings a profile can select
+var validPackagings = map[string]bool{
+	models.PackagingHLS: true, models.PackagingCMAF: true,
+}
+
+// validRenditions are the ladder rungs the encoder knows how to produce
+var validRenditions = map[string]bool{
+	"1080p": true, "720p": true, "480p": true, "360p": true, "audio": true,
+}
+
+type ProfileService struct {
+	repo   *repos.ProfileRepository
+	logger *zap.Logger
+}
+
+func NewProfileService(repo *repos.ProfileRepository, logger *zap.Logger) *ProfileService {
+	logger.Info("Initializing ProfileService")
+	return &ProfileService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ValidateProfile checks that a profile only contains values FFmpeg accepts
+func (s *ProfileService) ValidateProfile(profile *models.EncodingProfile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidProfile)
+	}
+	if !validPresets[profile.Preset] {
+		return fmt.Errorf("%w: unsupported preset %q", ErrInvalidProfile, profile.Preset)
+	}
+	if !validTunes[profile.Tune] {
+		return fmt.Errorf("%w: unsupported tune %q", ErrInvalidProfile, profile.Tune)
+	}
+	if profile.SegmentDuration < 1 || profile.SegmentDuration > 10 {
+		return fmt.Errorf("%w: segment_duration must be between 1 and 10 seconds", ErrInvalidProfile)
+	}
+	if profile.PlaylistSize < 3 || profile.PlaylistSize > 1000 {
+		return fmt.Errorf("%w: playlist_size must be between 3 and 1000", ErrInvalidProfile)
+	}
+	// 0 keeps each rendition's own audio bitrate
+	if profile.AudioBitrate != 0 && (profile.AudioBitrate < 32 || profile.AudioBitrate > 320) {
+		return fmt.Errorf("%w: audio_bitrate must be 0 or between 32 and 320 kbps", ErrInvalidProfile)
+	}
+	if !validPackagings[profile.Packaging] {
+		return fmt.Errorf("%w: unsupported packaging %q", ErrInvalidProfile, profile.Packaging)
+	}
+	// Partial segments are the fragments of fMP4 segments
+	if profile.LowLatency && profile.Packaging != models.PackagingCMAF {
+		return fmt.Errorf("%w: low_latency requires cmaf packaging", ErrInvalidProfile)
+	}
+
+	seen := make(map[string]bool)
+	for _, rendition := range profile.Renditions {
+		if !validRenditions[rendition] {
+			return fmt.Errorf("%w: unknown rendition %q", ErrInvalidProfile, rendition)
+		}
+		if seen[rendition] {
+			return fmt.Errorf("%w: duplicate rendition %q", ErrInvalidProfile, rendition)
+		}
+		seen[rendition] = true
+	}
+
+	return nil
+}
+
+// CreateProfile validates and creates a new encoding profile
+func (s *ProfileService) CreateProfile(profile *models.EncodingProfile) error {
+	s.logger.Info("Creating encoding profile", zap.String("name", profile.Name))
+
+	if err := s.ValidateProfile(profile); err != nil {
+		s.logger.Warn("Encoding profile validation failed", zap.Error(err))
+		return err
+	}
+
+	if err := s.repo.Create(profile); err != nil {
+		s.logger.Error("Error creating encoding profile", zap.Error(err))
+		return err
+	}
+
+	s.logger.Info("Successfully created encoding profile", zap.Int("id", profile.ID))
+	return nil
+}
+
+// GetProfileByID retrieves one of an organization's encoding profiles by ID
+func (s *ProfileService) GetProfileByID(id, orgID int) (*models.EncodingProfile, error) {
+	s.logger.Info("Getting encoding profile by ID", zap.Int("id", id))
+
+	profile, err := s.repo.GetByID(id, orgID)
+	if err != nil {
+		s.logger.Error("Error getting encoding profile by ID",
+			zap.Int("id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// GetAllProfiles retrieves all encoding profiles of an organization
+func (s *ProfileService) GetAllProfiles(orgID int) ([]*models.EncodingProfile, error) {
+	s.logger.Info("Getting all encoding profiles")
+
+	profiles, err := s.repo.GetAll(orgID)
+	if err != nil {
+		s.logger.Error("Error getting all encoding profiles", zap.Error(err))
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// UpdateProfile validates and updates an encoding profile;
+// profile.OrganizationID must be the caller's
+func (s *ProfileService) UpdateProfile(profile *models.EncodingProfile) error {
+	s.logger.Info("Updating encoding profile", zap.Int("id", profile.ID))
+
+	if err := s.ValidateProfile(profile); err != nil {
+		s.logger.Warn("Encoding profile validation failed",
+			zap.Int("id", profile.ID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	if err := s.repo.Update(profile); err != nil {
+		s.logger.Error("Error updating encoding profile",
+			zap.Int("id", profile.ID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	s.logger.Info("Successfully updated encoding profile", zap.Int("id", profile.ID))
+	return nil
+}
+
+// DeleteProfile deletes one of an organization's encoding profiles by ID
+func (s *ProfileService) DeleteProfile(id, orgID int) error {
+	s.logger.Info("Deleting encoding profile", zap.Int("id", id))
+
+	if err := s.repo.Delete(id, orgID); err != nil {
+		s.logger.Error("Error deleting encoding profile",
+			zap.Int("id", id),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	s.logger.Info("Successfully deleted encoding profile", zap.Int("id", id))
+	return nil
+}
@@ -1,36 +1,126 @@
 package service
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"time"
 
 	"streamkit/internal/api/models"
 	"streamkit/internal/api/repos"
+	"streamkit/internal/shared/keyseal"
 
 	"go.uber.org/zap"
 )
 
+// ErrInvalidStreamQuery is returned when stream listing parameters are invalid
+var ErrInvalidStreamQuery = errors.New("invalid stream query")
+
+var (
+	// ErrInvalidStreamStatus is returned for a status that does not exist
+	ErrInvalidStreamStatus = errors.New("invalid stream status")
+
+	// ErrStreamStatusConflict is returned when a stream cannot move from its
+	// current status to the requested one
+	ErrStreamStatusConflict = errors.New("stream status conflict")
+)
+
+const (
+	// defaultStreamPageSize is used when a listing does not set a limit
+	defaultStreamPageSize = 50
+
+	// maxStreamPageSize caps the limit a listing may request
+	maxStreamPageSize = 200
+
+	// streamCursorTimeLayout formats created_at in cursors. The column is a
+	// timestamp without time zone with microsecond precision.
+	streamCursorTimeLayout = "2006-01-02 15:04:05.999999"
+)
+
+// manualStreamStatuses are the statuses that can be set through the API; the
+// others are set by the encoder as the stream key publishes
+var manualStreamStatuses = map[string]bool{
+	models.StreamStatusIdle:     true,
+	models.StreamStatusDisabled: true,
+}
+
 type StreamService struct {
-	repo   *repos.StreamRepository
-	logger *zap.Logger
+	repo          *repos.StreamRepository
+	profileRepo   *repos.ProfileRepository
+	recordingRepo *repos.RecordingRepository
+	sessionRepo   *repos.SessionRepository
+	keyRepo       *repos.KeyRepository
+	keyring       *keyseal.Keyring // nil if encryption is not configured
+	logger        *zap.Logger
 }
 
-func NewStreamService(repo *repos.StreamRepository, logger *zap.Logger) *StreamService {
+func NewStreamService(
+	repo *repos.StreamRepository,
+	profileRepo *repos.ProfileRepository,
+	recordingRepo *repos.RecordingRepository,
+	sessionRepo *repos.SessionRepository,
+	keyRepo *repos.KeyRepository,
+	keyring *keyseal.Keyring,
+	logger *zap.Logger,
+) *StreamService {
 	logger.Info("Initializing StreamService")
 	return &StreamService{
-		repo:   repo,
-		logger: logger,
+		repo:          repo,
+		profileRepo:   profileRepo,
+		recordingRepo: recordingRepo,
+		sessionRepo:   sessionRepo,
+		keyRepo:       keyRepo,
+		keyring:       keyring,
+		logger:        logger,
+	}
+}
+
+// checkEncodingProfile verifies that a referenced encoding profile exists in
+// the stream's organization and takes the stream's packaging from it
+func (s *StreamService) checkEncodingProfile(stream *models.LiveStream) error {
+	if stream.EncodingProfileID == nil {
+		stream.Packaging = models.PackagingHLS
+		return nil
+	}
+
+	profile, err := s.profileRepo.GetByID(*stream.EncodingProfileID, stream.OrganizationID)
+	if err != nil {
+		s.logger.Warn("Invalid encoding profile for stream",
+			zap.Int("encoding_profile_id", *stream.EncodingProfileID),
+			zap.Error(err),
+		)
+		return err
 	}
+	stream.Packaging = profile.Packaging
+
+	return nil
 }
 
-// CreateStream creates a new stream with auto-generated URLs
-func (s *StreamService) CreateStream(stream *models.LiveStream) error {
+// CreateStream creates a new stream owned by owner and their organization,
+// with auto-generated URLs
+func (s *StreamService) CreateStream(stream *models.LiveStream, owner *models.User) error {
 	s.logger.Info("Creating stream",
 		zap.String("title", stream.Title),
 		zap.String("stream_name", stream.StreamName),
-		zap.String("created_by", stream.StreamCreatedBy),
+		zap.Int("owner_id", owner.ID),
 	)
 
+	// Attribution comes from the authenticated user, never the request body
+	stream.OwnerID = &owner.ID
+	stream.OrganizationID = owner.OrganizationID
+	stream.StreamCreatedBy = owner.Email
+
+	if err := s.checkEncodingProfile(stream); err != nil {
+		return err
+	}
+	if err := s.checkEncryption(stream); err != nil {
+		return err
+	}
+
 	// Get host from environment variable
 	host := os.Getenv("RTMP_HOST")
 	if host == "" {
@@ -38,12 +128,12 @@ func (s *StreamService) CreateStream(stream *models.LiveStream) error {
 	}
 	s.logger.Info("Using RTMP_HOST", zap.String("host", host))
 
-	// Generate URLs based on stream key (will be set by repository)
+	// Generate URLs based on stream identifiers (will be set by repository)
 	// RTMP ingest URL - stream to RTMP server
 	stream.IngestURL = fmt.Sprintf("rtmp://%s:1935/live", host)
 
-	// HLS playback URL - served by RTMP server, encoded by separate service
-	stream.PlaybackURL = fmt.Sprintf("http://%s:8081/hls/{stream_key}/playlist.m3u8", host)
+	// HLS playback URL - keyed by the public playback ID, never the stream key
+	stream.PlaybackURL = playbackBaseURL(host) + "/hls/{playback_id}/master.m3u8"
 
 	s.logger.Info("Generated URLs",
 		zap.String("ingest_url", stream.IngestURL),
@@ -64,11 +154,11 @@ func (s *StreamService) CreateStream(stream *models.LiveStream) error {
 	return nil
 }
 
-// GetStreamByID retrieves a stream by ID
-func (s *StreamService) GetStreamByID(id int) (*models.LiveStream, error) {
+// GetStreamByID retrieves one of the streams a user manages by ID
+func (s *StreamService) GetStreamByID(id int, user *models.User) (*models.LiveStream, error) {
 	s.logger.Info("Getting stream by ID", zap.Int("id", id))
 
-	stream, err := s.repo.GetByID(id)
+	stream, err := s.repo.GetByID(id, user)
 	if err != nil {
 		s.logger.Error("Error getting stream by ID",
 			zap.Int("id", id),
@@ -81,11 +171,12 @@ func (s *StreamService) GetStreamByID(id int) (*models.LiveStream, error) {
 	return stream, nil
 }
 
-// GetStreamByStreamKey retrieves a stream by stream key
-func (s *StreamService) GetStreamByStreamKey(streamKey string) (*models.LiveStream, error) {
+// GetStreamByStreamKey retrieves one of the streams a user manages by stream
+// key
+func (s *StreamService) GetStreamByStreamKey(streamKey string, user *models.User) (*models.LiveStream, error) {
 	s.logger.Info("Getting stream by stream key", zap.String("stream_key", streamKey))
 
-	stream, err := s.repo.GetByStreamKey(streamKey)
+	stream, err := s.repo.GetByStreamKey(streamKey, user)
 	if err != nil {
 		s.logger.Error("Error getting stream by key",
 			zap.String("stream_key", streamKey),
@@ -98,28 +189,22 @@ func (s *StreamService) GetStreamByStreamKey(streamKey string) (*models.LiveStre
 	return stream, nil
 }
 
-// GetAllStreams retrieves all streams
-func (s *StreamService) GetAllStreams() ([]*models.LiveStream, error) {
-	s.logger.Info("Getting all streams")
-
-	streams, err := s.repo.GetAll()
-	if err != nil {
-		s.logger.Error("Error getting all streams", zap.Error(err))
-		return nil, err
-	}
-
-	s.logger.Info("Successfully retrieved streams", zap.Int("count", len(streams)))
-	return streams, nil
-}
-
-// UpdateStream updates a stream
-func (s *StreamService) UpdateStream(stream *models.LiveStream) error {
+// UpdateStream updates one of the streams a user manages; stream.ID selects
+// it and stream.OrganizationID must be the user's
+func (s *StreamService) UpdateStream(stream *models.LiveStream, user *models.User) error {
 	s.logger.Info("Updating stream",
 		zap.Int("id", stream.ID),
 		zap.String("title", stream.Title),
 	)
 
-	err := s.repo.Update(stream)
+	if err := s.checkEncodingProfile(stream); err != nil {
+		return err
+	}
+	if err := s.checkEncryption(stream); err != nil {
+		return err
+	}
+
+	err := s.repo.Update(stream, user)
 	if err != nil {
 		s.logger.Error("Error updating stream",
 			zap.Int("id", stream.ID),
@@ -132,11 +217,11 @@ func (s *StreamService) UpdateStream(stream *models.LiveStream) error {
 	return nil
 }
 
-// DeleteStream deletes a stream by ID
-func (s *StreamService) DeleteStream(id int) error {
+// DeleteStream deletes one of the streams a user manages by ID
+func (s *StreamService) DeleteStream(id int, user *models.User) error {
 	s.logger.Info("Deleting stream", zap.Int("id", id))
 
-	err := s.repo.Delete(id)
+	err := s.repo.Delete(id, user)
 	if err != nil {
 		s.logger.Error("Error deleting stream",
 			zap.Int("id", id),
@@ -149,15 +234,37 @@ func (s *StreamService) DeleteStream(id int) error {
 	return nil
 }
 
-// UpdateStreamStatus updates the status of a stream
-func (s *StreamService) UpdateStreamStatus(id int, status string) error {
+// UpdateStreamStatus moves one of the streams a user manages to a status
+// that can be set through the API, if the state machine allows it from the
+// stream's current status. The change is recorded with reason in the
+// stream's status history.
+func (s *StreamService) UpdateStreamStatus(id int, user *models.User, status, reason string) error {
 	s.logger.Info("Updating stream status",
 		zap.Int("id", id),
 		zap.String("status", status),
 	)
 
-	err := s.repo.UpdateStatus(id, status)
+	if !models.IsStreamStatus(status) {
+		return fmt.Errorf("%w: %q", ErrInvalidStreamStatus, status)
+	}
+	if !manualStreamStatuses[status] {
+		return fmt.Errorf("%w: %q is set by the encoder", ErrStreamStatusConflict, status)
+	}
+
+	stream, err := s.repo.GetByID(id, user)
+	if err != nil {
+		return err
+	}
+	if !models.CanTransitionStreamStatus(stream.Status, status) {
+		return fmt.Errorf("%w: cannot change from %q to %q",
+			ErrStreamStatusConflict, stream.Status, status)
+	}
+
+	err = s.repo.UpdateStatus(id, user, stream.Status, status, reason)
 	if err != nil {
+		if err.Error() == "stream status changed" {
+			return fmt.Errorf("%w: status changed while updating, retry", ErrStreamStatusConflict)
+		}
 		s.logger.Error("Error updating stream status",
 			zap.Int("id", id),
 			zap.String("status", status),
@@ -168,11 +275,34 @@ func (s *StreamService) UpdateStreamStatus(id int, status string) error {
 
 	s.logger.Info("Successfully updated stream status",
 		zap.Int("id", id),
+		zap.String("from_status", stream.Status),
 		zap.String("status", status),
 	)
 	return nil
 }
 
+// GetStreamStatusHistory returns the status changes of one of the streams a
+// user manages, newest first
+func (s *StreamService) GetStreamStatusHistory(id int, user *models.User, limit int) ([]*models.StreamStatusChange, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	// Make sure the stream is the user's so other IDs return 404
+	if _, err := s.repo.GetByID(id, user); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetStatusHistory(id, limit)
+}
+
+// playbackBaseURL returns the base URL of the encoder service's playback
+// endpoints on host, under which live playlists, thumbnails and recordings
+// are served
+func playbackBaseURL(host string) string {
+	return fmt.Sprintf("http://%s:8081", host)
+}
+
 // GetStreamWithFullURLs returns a stream with complete URLs (replacing placeholders)
 func (s *StreamService) GetStreamWithFullURLs(stream *models.LiveStream) *models.LiveStream {
 	s.logger.Debug("Getting stream with full URLs", zap.Int("id", stream.ID))
@@ -185,11 +315,20 @@ func (s *StreamService) GetStreamWithFullURLs(stream *models.LiveStream) *models
 	// Create a copy to avoid modifying the original
 	fullStream := *stream
 	fullStream.IngestURL = fmt.Sprintf("rtmp://%s:1935/live", host)
-	fullStream.PlaybackURL = fmt.Sprintf(
-		"http://%s:8081/hls/%s/playlist.m3u8",
-		host,
-		stream.StreamKey,
-	)
+	baseURL := playbackBaseURL(host)
+	fullStream.PlaybackURL = fmt.Sprintf("%s/hls/%s/master.m3u8", baseURL, stream.PlaybackID)
+	// CMAF output adds a DASH manifest next to the HLS playlists
+	fullStream.DashPlaybackURL = nil
+	if stream.Packaging == models.PackagingCMAF {
+		dashPlaybackURL := fmt.Sprintf("%s/hls/%s/manifest.mpd", baseURL, stream.PlaybackID)
+		fullStream.DashPlaybackURL = &dashPlaybackURL
+	}
+	// Thumbnails exist once the stream has been published
+	fullStream.ThumbnailURL = nil
+	if stream.StartedAt != nil {
+		thumbnailURL := fmt.Sprintf("%s/thumbnails/%s/latest.jpg", baseURL, stream.PlaybackID)
+		fullStream.ThumbnailURL = &thumbnailURL
+	}
 
 	s.logger.Debug("Generated full URLs",
 		zap.String("ingest_url", fullStream.IngestURL),
@@ -199,24 +338,253 @@ func (s *StreamService) GetStreamWithFullURLs(stream *models.LiveStream) *models
 	return &fullStream
 }
 
-// GetAllStreamsWithFullURLs returns all streams with complete URLs
-func (s *StreamService) GetAllStreamsWithFullURLs() ([]*models.LiveStream, error) {
-	s.logger.Info("Getting all streams with full URLs")
+// ListStreams returns a page of the streams a user manages with complete
+// URLs. Unset sort fields default to the best search matches first for
+// searches, and to the newest streams first otherwise.
+func (s *StreamService) ListStreams(user *models.User, query *models.StreamListQuery) (*models.StreamPage, error) {
+	s.logger.Info("Listing streams", zap.Int("user_id", user.ID))
+
+	if query.Sort == "" {
+		query.Sort = "created_at"
+		if query.Search != "" {
+			query.Sort = models.StreamSortRelevance
+		}
+	}
+	if query.Order == "" {
+		query.Order = "desc"
+	}
+	if _, ok := repos.StreamSortColumns[query.Sort]; !ok {
+		return nil, fmt.Errorf("%w: sort must be one of created_at, title, stream_name, relevance", ErrInvalidStreamQuery)
+	}
+	if query.Sort == models.StreamSortRelevance && query.Search == "" {
+		return nil, fmt.Errorf("%w: sort=relevance requires q", ErrInvalidStreamQuery)
+	}
+	if query.Order != "asc" && query.Order != "desc" {
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrInvalidStreamQuery)
+	}
+	if query.Status != "" && !models.IsStreamStatus(query.Status) {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidStreamQuery, query.Status)
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultStreamPageSize
+	} else if query.Limit > maxStreamPageSize {
+		query.Limit = maxStreamPageSize
+	}
+	if query.CreatedAfter != nil && query.CreatedBefore != nil &&
+		!query.CreatedAfter.Before(*query.CreatedBefore) {
+		return nil, fmt.Errorf("%w: created_after must be before created_before", ErrInvalidStreamQuery)
+	}
+	if query.After != nil && (query.After.Sort != query.Sort || query.After.Order != query.Order) {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidStreamQuery)
+	}
 
-	streams, err := s.repo.GetAll()
+	streams, err := s.repo.List(user, query)
 	if err != nil {
-		s.logger.Error("Error getting all streams", zap.Error(err))
+		s.logger.Error("Error listing streams", zap.Error(err))
 		return nil, err
 	}
 
-	var fullStreams []*models.LiveStream
+	page := &models.StreamPage{
+		Data: make([]*models.LiveStream, 0, len(streams)),
+		Paging: models.Paging{
+			Limit: query.Limit,
+			Sort:  query.Sort,
+			Order: query.Order,
+		},
+	}
+
+	// The repository fetches one extra row to detect a following page
+	if len(streams) > query.Limit {
+		streams = streams[:query.Limit]
+		last := streams[len(streams)-1]
+		page.Paging.HasMore = true
+		page.Paging.NextCursor, err = EncodeStreamCursor(&models.StreamCursor{
+			Sort:  query.Sort,
+			Order: query.Order,
+			Value: streamSortValue(last, query.Sort),
+			ID:    last.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	for _, stream := range streams {
-		fullStreams = append(fullStreams, s.GetStreamWithFullURLs(stream))
+		page.Data = append(page.Data, s.GetStreamWithFullURLs(stream))
 	}
 
-	s.logger.Info(
-		"Successfully generated full URLs for streams",
-		zap.Int("count", len(fullStreams)),
+	s.logger.Info("Successfully listed streams",
+		zap.Int("count", len(page.Data)),
+		zap.Bool("has_more", page.Paging.HasMore),
 	)
-	return fullStreams, nil
+	return page, nil
+}
+
+// streamSortValue returns a stream's value for a sort field, formatted the way
+// Postgres compares it
+func streamSortValue(stream *models.LiveStream, sort string) string {
+	switch sort {
+	case "title":
+		return stream.Title
+	case "stream_name":
+		return stream.StreamName
+	case models.StreamSortRelevance:
+		return strconv.FormatFloat(float64(stream.SearchRank), 'g', -1, 32)
+	default:
+		return stream.CreatedAt.Format(streamCursorTimeLayout)
+	}
+}
+
+// EncodeStreamCursor returns the opaque token for a listing position
+func EncodeStreamCursor(cursor *models.StreamCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeStreamCursor parses a token returned by EncodeStreamCursor
+func DecodeStreamCursor(token string) (*models.StreamCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidStreamQuery)
+	}
+
+	cursor := &models.StreamCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil || cursor.ID <= 0 {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidStreamQuery)
+	}
+	switch cursor.Sort {
+	case "created_at":
+		if _, err := time.Parse(streamCursorTimeLayout, cursor.Value); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidStreamQuery)
+		}
+	case models.StreamSortRelevance:
+		if _, err := strconv.ParseFloat(cursor.Value, 32); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidStreamQuery)
+		}
+	}
+
+	return cursor, nil
+}
+
+// GetStreamRecordings returns the recordings of one of the streams a user
+// manages with playback URLs
+func (s *StreamService) GetStreamRecordings(id int, user *models.User) ([]*models.Recording, error) {
+	s.logger.Info("Getting recordings for stream", zap.Int("id", id))
+
+	// Make sure the stream exists and is the user's, so other IDs return
+	// "stream not found"
+	stream, err := s.repo.GetByID(id, user)
+	if err != nil {
+		return nil, err
+	}
+
+	recordings, err := s.recordingRepo.GetByLiveStreamID(id)
+	if err != nil {
+		s.logger.Error("Error getting recordings",
+			zap.Int("id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	host := os.Getenv("RTMP_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+
+	// The storage prefix includes the organization's storage prefix, which
+	// the encoder resolves from the playback ID, so URLs are built without it
+	baseURL := playbackBaseURL(host)
+	for _, recording := range recordings {
+		if recording.StoragePrefix != "" {
+			recording.PlaybackURL = fmt.Sprintf(
+				"%s/recordings/%s/%d/master.m3u8",
+				baseURL,
+				stream.PlaybackID,
+				recording.ID,
+			)
+		}
+		if recording.StoragePrefix != "" && recording.SpriteSheets > 0 {
+			thumbnailsURL := fmt.Sprintf(
+				"%s/recordings/%s/%d/sprites/thumbnails.vtt",
+				baseURL,
+				stream.PlaybackID,
+				recording.ID,
+			)
+			recording.ThumbnailsURL = &thumbnailsURL
+		}
+	}
+
+	s.logger.Info("Successfully retrieved recordings",
+		zap.Int("id", id),
+		zap.Int("count", len(recordings)),
+	)
+	return recordings, nil
+}
+
+// GetEncryptionKey returns an AES-128 key of an encrypted stream, as
+// referenced by the EXT-X-KEY tags of its playlists. The encoder signs those
+// key URIs for the stream's playback ID whenever it serves a playlist; query
+// holds the URI's exp and sig parameters, which must be valid and unexpired.
+func (s *StreamService) GetEncryptionKey(playbackID string, keyID int64, query url.Values) ([]byte, error) {
+	if s.keyring == nil {
+		return nil, ErrEncryptionNotConfigured
+	}
+
+	if err := s.keyring.VerifyKeyURI(playbackID, query, time.Now()); err != nil {
+		return nil, err
+	}
+
+	liveStreamID, sealedKey, err := s.keyRepo.GetSealedKey(keyID, playbackID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.keyring.Open(liveStreamID, sealedKey)
+	if err != nil {
+		s.logger.Error("Error opening encryption key",
+			zap.Int("id", liveStreamID),
+			zap.Int64("key_id", keyID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GetStreamSessions returns the publish sessions of one of the streams a user
+// manages, newest first, optionally limited to those started in
+// [startedAfter, startedBefore)
+func (s *StreamService) GetStreamSessions(
+	id int,
+	user *models.User,
+	startedAfter, startedBefore *time.Time,
+	limit int,
+) ([]*models.StreamSession, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if startedAfter != nil && startedBefore != nil && !startedAfter.Before(*startedBefore) {
+		return nil, fmt.Errorf("%w: started_after must be before started_before", ErrInvalidStreamQuery)
+	}
+
+	// Make sure the stream is the user's so other IDs return 404
+	if _, err := s.repo.GetByID(id, user); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.sessionRepo.GetByLiveStreamID(id, startedAfter, startedBefore, limit)
+	if err != nil {
+		s.logger.Error("Error getting sessions",
+			zap.Int("id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	return sessions, nil
 }
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/api/models"
+	"streamkit/internal/api/repos"
+)
+
+func TestStreamCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor models.StreamCursor
+	}{
+		{"created_at", models.StreamCursor{Sort: "created_at", Order: "desc", Value: "2026-10-17 09:30:00.123456", ID: 42}},
+		{"title", models.StreamCursor{Sort: "title", Order: "asc", Value: `Launch "day" — ñ`, ID: 7}},
+		{"stream_name", models.StreamCursor{Sort: "stream_name", Order: "desc", Value: "", ID: 1}},
+		{"relevance", models.StreamCursor{Sort: models.StreamSortRelevance, Order: "desc", Value: "0.0607927", ID: 99}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := EncodeStreamCursor(&tt.cursor)
+			if err != nil {
+				t.Fatalf("EncodeStreamCursor() error = %v", err)
+			}
+			decoded, err := DecodeStreamCursor(token)
+			if err != nil {
+				t.Fatalf("DecodeStreamCursor(%q) error = %v", token, err)
+			}
+			if *decoded != tt.cursor {
+				t.Errorf("DecodeStreamCursor() = %+v, want %+v", *decoded, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeStreamCursorRejectsMalformed(t *testing.T) {
+	encode := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not base64", "%%%"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"title","o":"asc","v":"a","id":1}`)) + "="},
+		{"not json", encode("created_at,desc,1")},
+		{"missing id", encode(`{"s":"title","o":"asc","v":"a"}`)},
+		{"negative id", encode(`{"s":"title","o":"asc","v":"a","id":-3}`)},
+		{"bad created_at", encode(`{"s":"created_at","o":"desc","v":"yesterday","id":1}`)},
+		{"bad relevance", encode(`{"s":"relevance","o":"desc","v":"high","id":1}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeStreamCursor(tt.token)
+			if !errors.Is(err, ErrInvalidStreamQuery) {
+				t.Errorf("DecodeStreamCursor(%q) error = %v, want ErrInvalidStreamQuery", tt.token, err)
+			}
+		})
+	}
+}
+
+func TestStreamSortValueDecodes(t *testing.T) {
+	stream := &models.LiveStream{
+		ID:         5,
+		Title:      "Morning show",
+		StreamName: "morning",
+		CreatedAt:  time.Date(2026, 10, 17, 8, 0, 0, 500000000, time.UTC),
+		SearchRank: 0.25,
+	}
+
+	// Every sort field the repository accepts must produce a valid cursor
+	for sort := range repos.StreamSortColumns {
+		t.Run(sort, func(t *testing.T) {
+			token, err := EncodeStreamCursor(&models.StreamCursor{
+				Sort:  sort,
+				Order: "desc",
+				Value: streamSortValue(stream, sort),
+				ID:    stream.ID,
+			})
+			if err != nil {
+				t.Fatalf("EncodeStreamCursor() error = %v", err)
+			}
+			if _, err := DecodeStreamCursor(token); err != nil {
+				t.Errorf("DecodeStreamCursor() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestListStreamsRejectsInvalidQueries(t *testing.T) {
+	service := &StreamService{logger: zap.NewNop()}
+
+	tests := []struct {
+		name  string
+		query models.StreamListQuery
+	}{
+		{"sort outside the whitelist", models.StreamListQuery{Sort: "id"}},
+		{"sort with SQL", models.StreamListQuery{Sort: "created_at; DROP TABLE live_streams"}},
+		{"sort by search_rank column", models.StreamListQuery{Sort: "search_rank", Search: "news"}},
+		{"relevance without q", models.StreamListQuery{Sort: models.StreamSortRelevance}},
+		{"unknown order", models.StreamListQuery{Order: "sideways"}},
+		{"unknown status", models.StreamListQuery{Status: "paused"}},
+		{"cursor for another sort", models.StreamListQuery{
+			Sort:  "title",
+			After: &models.StreamCursor{Sort: "created_at", Order: "desc", Value: "2026-10-17 00:00:00", ID: 1},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.ListStreams(&models.User{ID: 1, OrganizationID: 1}, &tt.query)
+			if !errors.Is(err, ErrInvalidStreamQuery) {
+				t.Errorf("ListStreams() error = %v, want ErrInvalidStreamQuery", err)
+			}
+		})
+	}
+}
+
+func TestUpdateStreamStatusRejectsStatuses(t *testing.T) {
+	// Only idle and disabled are set through the API; the checks run before
+	// the stream is read
+	service := &StreamService{logger: zap.NewNop()}
+
+	tests := []struct {
+		status  string
+		wantErr error
+	}{
+		{"", ErrInvalidStreamStatus},
+		{"paused", ErrInvalidStreamStatus},
+		{models.StreamStatusCreated, ErrStreamStatusConflict},
+		{models.StreamStatusConnecting, ErrStreamStatusConflict},
+		{models.StreamStatusLive, ErrStreamStatusConflict},
+		{models.StreamStatusReconnecting, ErrStreamStatusConflict},
+		{models.StreamStatusEnded, ErrStreamStatusConflict},
+		{models.StreamStatusErrored, ErrStreamStatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			err := service.UpdateStreamStatus(1, &models.User{ID: 1, OrganizationID: 1}, tt.status, "test")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdateStreamStatus(%q) error = %v, want %v", tt.status, err, tt.wantErr)
+			}
+		})
+	}
+}
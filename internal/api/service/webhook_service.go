@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"streamkit/internal/api/models"
+	"streamkit/internal/api/repos"
+	"streamkit/internal/shared/netguard"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidWebhook is returned when a webhook subscription fails validation
+var ErrInvalidWebhook = errors.New("invalid webhook subscription")
+
+// webhookResolveTimeout bounds resolving a subscription URL's host
+const webhookResolveTimeout = 5 * time.Second
+
+// webhookEvents are the lifecycle events a subscription can receive
+var webhookEvents = map[string]bool{
+	"stream.started":  true,
+	"stream.ended":    true,
+	"stream.errored":  true,
+	"recording.ready": true,
+}
+
+// Delivery statuses that can be used to filter the delivery log
+var webhookDeliveryStatuses = map[string]bool{
+	"":          true,
+	"pending":   true,
+	"succeeded": true,
+	"failed":    true,
+}
+
+type WebhookService struct {
+	repo   *repos.WebhookRepository
+	logger *zap.Logger
+}
+
+func NewWebhookService(repo *repos.WebhookRepository, logger *zap.Logger) *WebhookService {
+	logger.Info("Initializing WebhookService")
+	return &WebhookService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// CreateSubscription validates and registers a webhook subscription for
+// subscription.OrganizationID. A signing secret is generated when none is
+// supplied.
+func (s *WebhookService) CreateSubscription(subscription *models.WebhookSubscription) error {
+	s.logger.Info("Creating webhook subscription", zap.String("url", subscription.URL))
+
+	// Deliveries must not reach the services' own network; the encoder
+	// checks every connection again, as DNS can change
+	ctx, cancel := context.WithTimeout(context.Background(), webhookResolveTimeout)
+	defer cancel()
+	if err := netguard.CheckURL(ctx, subscription.URL); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	if len(subscription.Events) == 0 {
+		return fmt.Errorf("%w: at least one event is required", ErrInvalidWebhook)
+	}
+	for _, event := range subscription.Events {
+		if !webhookEvents[event] {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+
+	if subscription.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			s.logger.Error("Error generating webhook secret", zap.Error(err))
+			return err
+		}
+		subscription.Secret = hex.EncodeToString(secret)
+	}
+	subscription.Active = true
+
+	if err := s.repo.Create(subscription); err != nil {
+		s.logger.Error("Error creating webhook subscription", zap.Error(err))
+		return err
+	}
+
+	s.logger.Info("Successfully created webhook subscription", zap.Int("id", subscription.ID))
+	return nil
+}
+
+// GetSubscription retrieves one of an organization's webhook subscriptions
+func (s *WebhookService) GetSubscription(id, orgID int) (*models.WebhookSubscription, error) {
+	return s.repo.GetByID(id, orgID)
+}
+
+// GetAllSubscriptions retrieves all webhook subscriptions of an organization
+func (s *WebhookService) GetAllSubscriptions(orgID int) ([]*models.WebhookSubscription, error) {
+	return s.repo.GetAll(orgID)
+}
+
+// DeleteSubscription deletes one of an organization's webhook subscriptions
+func (s *WebhookService) DeleteSubscription(id, orgID int) error {
+	return s.repo.Delete(id, orgID)
+}
+
+// GetDeliveries returns the delivery log of one of an organization's
+// subscriptions
+func (s *WebhookService) GetDeliveries(
+	subscriptionID, orgID int,
+	status string,
+	limit int,
+) ([]*models.WebhookDelivery, error) {
+	if !webhookDeliveryStatuses[status] {
+		return nil, fmt.Errorf("%w: unknown delivery status %q", ErrInvalidWebhook, status)
+	}
+
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	// Make sure the subscription exists in the organization so other IDs
+	// return 404
+	if _, err := s.repo.GetByID(subscriptionID, orgID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetDeliveries(subscriptionID, status, limit)
+}
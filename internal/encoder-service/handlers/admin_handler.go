@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/service"
+)
+
+// AdminHandler serves operator endpoints. They are served on the admin port
+// only, and require the admin token as a bearer token.
+type AdminHandler struct {
+	logger         *zap.Logger
+	encoderService *service.EncoderService
+	adminToken     string
+}
+
+// NewAdminHandler creates a new admin handler. An empty adminToken rejects
+// every request.
+func NewAdminHandler(logger *zap.Logger, encoderService *service.EncoderService, adminToken string) *AdminHandler {
+	return &AdminHandler{
+		logger:         logger,
+		encoderService: encoderService,
+		adminToken:     adminToken,
+	}
+}
+
+// StopStream handles POST /streams/stop?stream_key=, which ends a broadcast
+// and disconnects its publisher
+func (h *AdminHandler) StopStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(w, r) {
+		return
+	}
+
+	streamKey := r.URL.Query().Get("stream_key")
+	if streamKey == "" {
+		http.Error(w, "stream_key parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.encoderService.KillEncoding(streamKey); err != nil {
+		if errors.Is(err, service.ErrStreamNotActive) {
+			http.Error(w, "Stream is not being encoded", http.StatusNotFound)
+			return
+		}
+		h.logger.Error("Failed to stop stream", zap.String("stream_key", streamKey), zap.Error(err))
+		http.Error(w, "Failed to stop stream", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequireToken wraps a handler served on the admin port so it requires the
+// admin token
+func (h *AdminHandler) RequireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.authorized(w, r) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authorized checks the request's bearer token against the admin token,
+// writing 403 if it does not match
+func (h *AdminHandler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if h.adminToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+		h.logger.Warn("Rejected admin request without admin token",
+			zap.String("url", r.URL.Path),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
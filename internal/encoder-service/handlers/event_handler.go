@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"runtime/debug"
@@ -156,6 +157,15 @@ func (h *EventHandler) HandlePublishedEvent(w http.ResponseWriter, r *http.Reque
 	switch event.Action {
 	case "publish":
 		if err := h.encoderService.StartEncoding(event.StreamKey); err != nil {
+			// nginx-rtmp refuses the publish on any non-2xx response
+			if errors.Is(err, service.ErrStreamKeyRejected) {
+				h.logger.Warn("Rejected publish",
+					zap.String("stream_key", event.StreamKey),
+					zap.Error(err),
+				)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
 			h.logger.Error("Failed to start encoding",
 				zap.String("stream_key", event.StreamKey),
 				zap.Error(err),
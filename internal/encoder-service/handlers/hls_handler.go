@@ -1,135 +1,286 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"path"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
+	"streamkit/internal/encoder-service/metrics"
 	"streamkit/internal/encoder-service/models"
 	"streamkit/internal/encoder-service/service"
 )
 
-// HLSHandler handles HLS file serving from S3
+const (
+	// segmentCacheControl lets players and CDNs keep segments indefinitely
+	segmentCacheControl = "public, max-age=31536000, immutable"
+
+	// livePlaylistCacheControl keeps live playlists fresh to within a second
+	livePlaylistCacheControl = "public, max-age=1"
+
+	// recordingPlaylistCacheControl applies to VOD playlists, which do not
+	// change once a recording is ready
+	recordingPlaylistCacheControl = "public, max-age=3600"
+
+	// tokenPlaylistCacheControl applies to playlists served for a viewer's
+	// playback token: encrypted playlists, whose key URIs are signed for
+	// that viewer, and master playlists carrying the token. No shared cache
+	// may store or replay them.
+	tokenPlaylistCacheControl = "private, no-store"
+
+	// thumbnailCacheControl keeps thumbnails about as fresh as the encoder
+	// replaces them
+	thumbnailCacheControl = "public, max-age=10"
+)
+
+// HLSHandler handles HLS file serving from storage. Playback URLs only carry
+// the playback ID; the owning organization's storage prefix is resolved
+// through the tenant service. Low-latency streams this instance encodes are
+// served from its local output instead.
 type HLSHandler struct {
 	logger         *zap.Logger
-	storageService *service.StorageService
+	storage        service.Storage
+	tenantService  *service.TenantService
+	encoderService *service.EncoderService
 }
 
 // NewHLSHandler creates a new HLS handler
-func NewHLSHandler(logger *zap.Logger, storageService *service.StorageService) *HLSHandler {
+func NewHLSHandler(
+	logger *zap.Logger,
+	storage service.Storage,
+	tenantService *service.TenantService,
+	encoderService *service.EncoderService,
+) *HLSHandler {
 	return &HLSHandler{
 		logger:         logger,
-		storageService: storageService,
+		storage:        storage,
+		tenantService:  tenantService,
+		encoderService: encoderService,
 	}
 }
 
-// ServeHLSPlaylist serves the HLS playlist for a stream
+// ServeHLSPlaylist serves the master or a rendition playlist for a stream, or
+// its DASH manifest
 func (h *HLSHandler) ServeHLSPlaylist(w http.ResponseWriter, r *http.Request) {
-	// Extract stream key from URL path
-	// Expected format: /hls/{stream_key}/playlist.m3u8
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+	// Expected format: /hls/{playback_id}/master.m3u8,
+	// /hls/{playback_id}/{rendition}/playlist.m3u8
+	// or /hls/{playback_id}/manifest.mpd
+	playbackID, s3Key, ok := h.resolveHLSPath(w, r)
+	if !ok {
 		return
 	}
 
-	streamKey := pathParts[2]
-	fileName := pathParts[len(pathParts)-1]
-
 	h.logger.Info("Serving HLS file",
-		zap.String("stream_key", streamKey),
-		zap.String("file_name", fileName),
+		zap.String("playback_id", playbackID),
+		zap.String("s3_key", s3Key),
 		zap.String("user_agent", r.UserAgent()),
 	)
 
 	// Set CORS headers
 	h.setCORSHeaders(w)
 
-	// Get file content directly from storage
-	s3Key := fmt.Sprintf("hls/%s/%s", streamKey, fileName)
-	fileContent, err := h.storageService.GetFileContent(s3Key)
-	if err != nil {
-		h.logger.Error("Failed to get file content",
-			zap.String("stream_key", streamKey),
-			zap.String("file_name", fileName),
-			zap.Error(err),
-		)
-		http.Error(w, "File not found", http.StatusNotFound)
+	if h.serveLowLatencyPlaylist(w, r, playbackID, s3Key) {
 		return
 	}
 
-	// Set content type
-	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(fileContent)))
+	// Live playlists are rewritten in place, so read one consistent version
+	// rather than streaming an object that may change mid-response. They are
+	// only a few kilobytes.
+	body, err := h.storage.OpenFile(s3Key, 0)
+	if err == nil {
+		defer body.Close()
+		var fileContent []byte
+		fileContent, err = io.ReadAll(body)
+		if err == nil {
+			// Encrypted playlists' key URIs are signed for each response,
+			// for viewers with a playback token issued by the API
+			cacheControl := playlistCacheControl(r.URL.Path)
+			token := r.URL.Query().Get("token")
+			var signed bool
+			fileContent, signed, err = h.encoderService.SignKeyURIs(fileContent, playbackID, token)
+			if err != nil {
+				h.logger.Warn("Rejected encrypted playlist request",
+					zap.String("playback_id", playbackID),
+					zap.Error(err),
+				)
+				http.Error(w, "A valid playback token is required", http.StatusForbidden)
+				return
+			}
+			if token != "" {
+				fileContent = service.AddPlaybackToken(fileContent, token)
+			}
+			if signed || token != "" {
+				cacheControl = tokenPlaylistCacheControl
+			}
+
+			w.Header().Set("Content-Type", getContentType(r.URL.Path))
+			w.Header().Set("Cache-Control", cacheControl)
+			w.Header().Set("ETag", contentETag(fileContent))
 
-	// Serve file content directly
-	w.Write(fileContent)
+			// Handles HEAD, Range and If-None-Match
+			counter := &metrics.CountingWriter{ResponseWriter: w}
+			http.ServeContent(counter, r, "", time.Time{}, bytes.NewReader(fileContent))
+			metrics.AddHLSBytesServed(s3Key, counter.Bytes)
+			return
+		}
+	}
+
+	h.logger.Error("Failed to get file content",
+		zap.String("playback_id", playbackID),
+		zap.String("s3_key", s3Key),
+		zap.Error(err),
+	)
+	if errors.Is(err, service.ErrFileNotFound) {
+		http.Error(w, "File not found", http.StatusNotFound)
+	} else {
+		http.Error(w, "Failed to read from storage", http.StatusBadGateway)
+	}
 }
 
-// ServeHLSSegment serves an HLS segment file
+// ServeHLSSegment serves a media or initialization segment file, or an LL-HLS
+// partial segment
 func (h *HLSHandler) ServeHLSSegment(w http.ResponseWriter, r *http.Request) {
-	// Extract stream key and segment name from URL path
-	// Expected format: /hls/{stream_key}/segment_001.ts
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+	// Expected format: /hls/{playback_id}/{rendition}/segment_001.ts,
+	// /hls/{playback_id}/segment_{n}_0_00001.m4s, /hls/{playback_id}/init_{n}_0.mp4
+	// or /hls/{playback_id}/segment_{n}_0_00001.part0.m4s
+	playbackID, s3Key, ok := h.resolveHLSPath(w, r)
+	if !ok {
 		return
 	}
 
-	streamKey := pathParts[2]
-	segmentName := pathParts[len(pathParts)-1]
-
 	h.logger.Info("Serving HLS segment",
-		zap.String("stream_key", streamKey),
-		zap.String("segment_name", segmentName),
+		zap.String("playback_id", playbackID),
+		zap.String("s3_key", s3Key),
 	)
 
 	// Set CORS headers
 	h.setCORSHeaders(w)
 
-	// Get file content directly from storage
-	s3Key := fmt.Sprintf("hls/%s/%s", streamKey, segmentName)
-	fileContent, err := h.storageService.GetFileContent(s3Key)
+	if h.serveLowLatencyFile(w, r, playbackID, s3Key) {
+		return
+	}
+
+	file, err := h.storage.StatFile(s3Key)
 	if err != nil {
-		h.logger.Error("Failed to get file content for segment",
-			zap.String("stream_key", streamKey),
-			zap.String("segment_name", segmentName),
+		h.logger.Error("Failed to get file info for segment",
+			zap.String("playback_id", playbackID),
+			zap.String("s3_key", s3Key),
 			zap.Error(err),
 		)
-		http.Error(w, "Segment not found", http.StatusNotFound)
+		if errors.Is(err, service.ErrFileNotFound) {
+			http.Error(w, "Segment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to read from storage", http.StatusBadGateway)
+		}
+		return
+	}
+
+	// Segment names are unique per publish, so a segment never changes
+	w.Header().Set("Content-Type", getContentType(r.URL.Path))
+	w.Header().Set("Cache-Control", segmentCacheControl)
+	w.Header().Set("ETag", `"`+file.ETag+`"`)
+
+	// Stream from storage; handles HEAD, Range and If-None-Match
+	content := newStorageReadSeeker(h.storage, s3Key, file.Size)
+	defer content.Close()
+	counter := &metrics.CountingWriter{ResponseWriter: w}
+	http.ServeContent(counter, r, "", file.LastModified, content)
+	metrics.AddHLSBytesServed(s3Key, counter.Bytes)
+}
+
+// ServeThumbnail serves a stream's latest thumbnail
+func (h *HLSHandler) ServeThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Expected format: /thumbnails/{playback_id}/latest.jpg
+	h.serveStoredFile(w, r, "image/jpeg", thumbnailCacheControl)
+}
+
+// ServeSpriteFile serves a recording's seek preview sprite sheets and their
+// WebVTT track
+func (h *HLSHandler) ServeSpriteFile(w http.ResponseWriter, r *http.Request) {
+	// Expected format: /recordings/{playback_id}/{recording_id}/sprites/{file}
+	contentType := "image/jpeg"
+	if strings.HasSuffix(r.URL.Path, ".vtt") {
+		contentType = "text/vtt; charset=utf-8"
+	}
+	h.serveStoredFile(w, r, contentType, recordingPlaylistCacheControl)
+}
+
+// serveStoredFile streams the stored file at a playback request path
+func (h *HLSHandler) serveStoredFile(w http.ResponseWriter, r *http.Request, contentType, cacheControl string) {
+	playbackID, s3Key, ok := h.resolveHLSPath(w, r)
+	if !ok {
+		return
+	}
+
+	h.setCORSHeaders(w)
+
+	file, err := h.storage.StatFile(s3Key)
+	if err != nil {
+		if errors.Is(err, service.ErrFileNotFound) {
+			http.Error(w, "File not found", http.StatusNotFound)
+		} else {
+			h.logger.Error("Failed to get file info",
+				zap.String("playback_id", playbackID),
+				zap.String("s3_key", s3Key),
+				zap.Error(err),
+			)
+			http.Error(w, "Failed to read from storage", http.StatusBadGateway)
+		}
 		return
 	}
 
-	// Set content type
-	w.Header().Set("Content-Type", "video/mp2t")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(fileContent)))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", `"`+file.ETag+`"`)
 
-	// Serve file content directly
-	w.Write(fileContent)
+	content := newStorageReadSeeker(h.storage, s3Key, file.Size)
+	defer content.Close()
+	http.ServeContent(w, r, "", file.LastModified, content)
 }
 
 // GetStreamManifest returns stream manifest information
 func (h *HLSHandler) GetStreamManifest(w http.ResponseWriter, r *http.Request) {
-	// Extract stream key from query parameter
-	streamKey := r.URL.Query().Get("stream_key")
-	if streamKey == "" {
-		http.Error(w, "Missing stream_key parameter", http.StatusBadRequest)
+	// Extract playback ID from query parameter
+	playbackID := r.URL.Query().Get("playback_id")
+	if playbackID == "" {
+		http.Error(w, "Missing playback_id parameter", http.StatusBadRequest)
 		return
 	}
 
-	h.logger.Info("Getting stream manifest", zap.String("stream_key", streamKey))
+	h.logger.Info("Getting stream manifest", zap.String("playback_id", playbackID))
 
 	// Set CORS headers
 	h.setCORSHeaders(w)
 
+	tenantPrefix, err := h.tenantService.StoragePrefix(playbackID)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownPlaybackID) {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to get stream files", http.StatusInternalServerError)
+		}
+		return
+	}
+
 	// List files for the stream
-	files, err := h.storageService.ListStreamFiles(streamKey)
+	files, err := h.storage.ListFiles(service.StreamFilesPrefix(tenantPrefix, playbackID))
 	if err != nil {
 		h.logger.Error("Failed to list stream files",
-			zap.String("stream_key", streamKey),
+			zap.String("playback_id", playbackID),
 			zap.Error(err),
 		)
 		http.Error(w, "Failed to get stream files", http.StatusInternalServerError)
@@ -138,16 +289,18 @@ func (h *HLSHandler) GetStreamManifest(w http.ResponseWriter, r *http.Request) {
 
 	// Build manifest
 	manifest := &models.HLSManifest{
-		StreamKey:   streamKey,
-		PlaylistURL: h.storageService.GetPublicURL(fmt.Sprintf("hls/%s/playlist.m3u8", streamKey)),
+		PlaybackID:  playbackID,
+		PlaylistURL: h.storage.GetPublicURL(tenantPrefix, fmt.Sprintf("hls/%s/master.m3u8", playbackID)),
 		Segments:    make([]models.HLSSegment, 0),
 	}
 
-	// Add segments
+	// Add segments. Listed keys include the tenant prefix, which public URLs
+	// take separately.
+	tenantRoot := service.TenantKey(tenantPrefix, "")
 	for _, file := range files {
-		if strings.HasSuffix(file.Key, ".ts") {
+		if strings.HasSuffix(file.Key, ".ts") || strings.HasSuffix(file.Key, ".m4s") {
 			segment := models.HLSSegment{
-				URL:  h.storageService.GetPublicURL(file.Key),
+				URL:  h.storage.GetPublicURL(tenantPrefix, strings.TrimPrefix(file.Key, tenantRoot)),
 				Size: file.Size,
 			}
 			manifest.Segments = append(manifest.Segments, segment)
@@ -158,11 +311,106 @@ func (h *HLSHandler) GetStreamManifest(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(manifest)
 }
 
-// setCORSHeaders sets CORS headers for HLS serving
+// resolveHLSPath parses a playback request path and returns the storage key
+// under the owning organization's prefix, writing an error response if the
+// path is invalid or the playback ID is unknown
+func (h *HLSHandler) resolveHLSPath(w http.ResponseWriter, r *http.Request) (playbackID, s3Key string, ok bool) {
+	playbackID, relKey, ok := parseHLSPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		return "", "", false
+	}
+
+	tenantPrefix, err := h.tenantService.StoragePrefix(playbackID)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownPlaybackID) {
+			http.Error(w, "File not found", http.StatusNotFound)
+		} else {
+			h.logger.Error("Failed to resolve playback ID",
+				zap.String("playback_id", playbackID),
+				zap.Error(err),
+			)
+			http.Error(w, "Failed to resolve stream", http.StatusInternalServerError)
+		}
+		return "", "", false
+	}
+
+	return playbackID, service.TenantKey(tenantPrefix, relKey), true
+}
+
+// parseHLSPath extracts the playback ID and storage key, relative to the
+// tenant's prefix, from a playback request path and rejects any path
+// traversal. It accepts live paths
+// /hls/{playback_id}/{file} and /hls/{playback_id}/{rendition}/{file},
+// recording paths /recordings/{playback_id}/{recording_id}/{file} and
+// /recordings/{playback_id}/{recording_id}/{rendition}/{file}, and
+// thumbnail paths /thumbnails/{playback_id}/{file}.
+func parseHLSPath(urlPath string) (playbackID, s3Key string, ok bool) {
+	var root string
+	var minParts, maxParts int
+	switch {
+	case strings.HasPrefix(urlPath, "/hls/"):
+		root, minParts, maxParts = "hls", 2, 3
+	case strings.HasPrefix(urlPath, "/recordings/"):
+		root, minParts, maxParts = "recordings", 3, 4
+	case strings.HasPrefix(urlPath, "/thumbnails/"):
+		root, minParts, maxParts = "thumbnails", 2, 2
+	default:
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(urlPath, "/"+root+"/"), "/")
+	if len(parts) < minParts || len(parts) > maxParts {
+		return "", "", false
+	}
+
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return "", "", false
+		}
+	}
+
+	return parts[0], root + "/" + strings.Join(parts, "/"), true
+}
+
+// getContentType returns the MIME type of a playlist, manifest or segment
+// request path
+func getContentType(urlPath string) string {
+	switch path.Ext(urlPath) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".mpd":
+		return "application/dash+xml"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".mp4":
+		// CMAF initialization segments
+		return "video/mp4"
+	default:
+		return "video/mp2t"
+	}
+}
+
+// playlistCacheControl returns the caching policy for a playlist request path
+func playlistCacheControl(urlPath string) string {
+	if strings.HasPrefix(urlPath, "/recordings/") {
+		return recordingPlaylistCacheControl
+	}
+	return livePlaylistCacheControl
+}
+
+// contentETag returns a strong ETag for in-memory content
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// setCORSHeaders sets CORS headers for HLS serving. Responses are not
+// cacheable unless the handler sets its own Cache-Control on success.
 func (h *HLSHandler) setCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Range, Accept-Ranges, Content-Range")
-	w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Range, Accept-Ranges, Content-Range, If-None-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, Accept-Ranges, ETag")
 	w.Header().Set("Cache-Control", "no-cache")
 }
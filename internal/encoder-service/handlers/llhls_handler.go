@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/metrics"
+	"streamkit/internal/encoder-service/service"
+)
+
+// lowLatencyPlaylistCacheControl applies to LL-HLS playlists requested
+// without blocking, which change with every part
+const lowLatencyPlaylistCacheControl = "no-cache"
+
+// lowLatencyOutput returns the LL-HLS output and requested file name for a
+// live request path of a stream this instance encodes in low-latency mode.
+// CMAF output is flat, so only /hls/{playback_id}/{file} paths qualify.
+func (h *HLSHandler) lowLatencyOutput(r *http.Request, playbackID string) (*service.LLHLSOutput, string, bool) {
+	if h.encoderService == nil || !strings.HasPrefix(r.URL.Path, "/hls/") {
+		return nil, "", false
+	}
+	rel := strings.TrimPrefix(r.URL.Path, "/hls/"+playbackID+"/")
+	if rel == r.URL.Path || strings.Contains(rel, "/") {
+		return nil, "", false
+	}
+
+	output := h.encoderService.LowLatencyOutput(playbackID)
+	if output == nil {
+		return nil, "", false
+	}
+	return output, rel, true
+}
+
+// serveLowLatencyPlaylist serves the LL-HLS version of a media playlist,
+// holding the request while it asks for a segment or part that is not
+// available yet. It reports false if the request should be served from
+// storage instead.
+func (h *HLSHandler) serveLowLatencyPlaylist(w http.ResponseWriter, r *http.Request, playbackID, s3Key string) bool {
+	output, name, ok := h.lowLatencyOutput(r, playbackID)
+	if !ok {
+		return false
+	}
+
+	// Blocking reloads: _HLS_msn, optionally with _HLS_part
+	query := r.URL.Query()
+	msn, part := int64(-1), int64(-1)
+	if value := query.Get("_HLS_msn"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid _HLS_msn", http.StatusBadRequest)
+			return true
+		}
+		msn = n
+	}
+	if value := query.Get("_HLS_part"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 || msn < 0 {
+			http.Error(w, "Invalid _HLS_part", http.StatusBadRequest)
+			return true
+		}
+		part = n
+	}
+
+	content, err := output.Playlist(r.Context(), name, msn, part)
+	switch {
+	case errors.Is(err, service.ErrFileNotFound):
+		return false
+	case errors.Is(err, service.ErrBlockingRequestTooFar):
+		http.Error(w, "Requested segment is too far ahead", http.StatusBadRequest)
+		return true
+	case errors.Is(err, service.ErrPlaylistNotReady):
+		http.Error(w, "Playlist not updated in time", http.StatusServiceUnavailable)
+		return true
+	case errors.Is(err, context.Canceled):
+		// The player went away
+		return true
+	case err != nil:
+		h.logger.Error("Failed to build low-latency playlist",
+			zap.String("playback_id", playbackID),
+			zap.String("playlist", name),
+			zap.Error(err),
+		)
+		return false
+	}
+
+	cacheControl := lowLatencyPlaylistCacheControl
+	if msn >= 0 {
+		// A blocking request names the playlist version it waited for
+		cacheControl = livePlaylistCacheControl
+	}
+	w.Header().Set("Content-Type", getContentType(r.URL.Path))
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", contentETag(content))
+
+	counter := &metrics.CountingWriter{ResponseWriter: w}
+	http.ServeContent(counter, r, "", time.Time{}, bytes.NewReader(content))
+	metrics.AddHLSBytesServed(s3Key, counter.Bytes)
+	return true
+}
+
+// serveLowLatencyFile serves a part, segment or initialization segment of a
+// low-latency stream from the encoder's disk, holding the request for a part
+// that is still being written. Segments are listed in LL-HLS playlists before
+// they reach storage. It reports false if the request should be served from
+// storage instead.
+func (h *HLSHandler) serveLowLatencyFile(w http.ResponseWriter, r *http.Request, playbackID, s3Key string) bool {
+	output, name, ok := h.lowLatencyOutput(r, playbackID)
+	if !ok {
+		return false
+	}
+
+	file, err := output.OpenFile(r.Context(), name)
+	switch {
+	case errors.Is(err, service.ErrFileNotFound):
+		return false
+	case errors.Is(err, context.Canceled):
+		return true
+	case err != nil:
+		h.logger.Error("Failed to open low-latency file",
+			zap.String("playback_id", playbackID),
+			zap.String("file", name),
+			zap.Error(err),
+		)
+		return false
+	}
+	defer file.Close()
+
+	// Part and segment names are unique per publish, so they never change
+	w.Header().Set("Content-Type", getContentType(r.URL.Path))
+	w.Header().Set("Cache-Control", segmentCacheControl)
+
+	counter := &metrics.CountingWriter{ResponseWriter: w}
+	http.ServeContent(counter, r, "", time.Time{}, file)
+	metrics.AddHLSBytesServed(s3Key, counter.Bytes)
+	return true
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+
+	"streamkit/internal/encoder-service/service"
+)
+
+// storageReadSeeker adapts a stored file to io.ReadSeeker for
+// http.ServeContent. Nothing is fetched until the first Read, and each Read
+// after a Seek opens a new stream at the requested offset, so a byte range
+// request only transfers that range from storage.
+type storageReadSeeker struct {
+	storage service.Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+// newStorageReadSeeker creates a reader over a stored file of known size
+func newStorageReadSeeker(storage service.Storage, key string, size int64) *storageReadSeeker {
+	return &storageReadSeeker{
+		storage: storage,
+		key:     key,
+		size:    size,
+	}
+}
+
+// Read reads from the current offset, opening the stored file if needed
+func (r *storageReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.storage.OpenFile(r.key, r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek moves the offset; an open stream is dropped if the offset changes
+func (r *storageReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if abs != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+// Close closes the open stream, if any
+func (r *storageReadSeeker) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
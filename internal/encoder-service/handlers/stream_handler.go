@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/service"
+)
+
+// logKeepAliveInterval is how often an idle log tail sends a comment, so
+// proxies do not close the connection
+const logKeepAliveInterval = 15 * time.Second
+
+// StreamHandler serves per-stream resources under /streams/{stream_key}/.
+// Snapshots are public; logs are served on the admin port only.
+type StreamHandler struct {
+	logger         *zap.Logger
+	encoderService *service.EncoderService
+}
+
+// NewStreamHandler creates a new stream handler
+func NewStreamHandler(logger *zap.Logger, encoderService *service.EncoderService) *StreamHandler {
+	return &StreamHandler{
+		logger:         logger,
+		encoderService: encoderService,
+	}
+}
+
+// ServeStream routes the public /streams/{stream_key}/{resource} requests.
+// A snapshot only shows what viewers of the stream already see.
+func (h *StreamHandler) ServeStream(w http.ResponseWriter, r *http.Request) {
+	streamKey, resource, ok := parseStreamPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch resource {
+	case "snapshot":
+		h.ServeStreamSnapshot(w, r, streamKey)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ServeAdminStream routes the /streams/{stream_key}/{resource} requests of
+// the admin port. FFmpeg logs hold the stream's input and output details,
+// so they are not served publicly.
+func (h *StreamHandler) ServeAdminStream(w http.ResponseWriter, r *http.Request) {
+	streamKey, resource, ok := parseStreamPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch resource {
+	case "logs":
+		h.ServeStreamLogs(w, r, streamKey)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// parseStreamPath splits a /streams/{stream_key}/{resource} path
+func parseStreamPath(urlPath string) (streamKey, resource string, ok bool) {
+	streamKey, resource, ok = strings.Cut(strings.TrimPrefix(urlPath, "/streams/"), "/")
+	return streamKey, resource, ok && streamKey != ""
+}
+
+// ServeStreamSnapshot serves a JPEG of the latest frame encoded for a stream
+// encoded by this instance
+func (h *StreamHandler) ServeStreamSnapshot(w http.ResponseWriter, r *http.Request, streamKey string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	image, err := h.encoderService.Snapshot(streamKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrStreamNotActive):
+			http.Error(w, "Stream is not being encoded", http.StatusNotFound)
+		case errors.Is(err, service.ErrNoFrame):
+			http.Error(w, "No video frame has been encoded yet", http.StatusServiceUnavailable)
+		case errors.Is(err, service.ErrStreamEncrypted):
+			http.Error(w, "Snapshots are not available for encrypted streams", http.StatusConflict)
+		default:
+			h.logger.Error("Failed to take snapshot",
+				zap.String("stream_key", streamKey),
+				zap.Error(err),
+			)
+			http.Error(w, "Failed to take snapshot", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(image)
+}
+
+// ServeStreamLogs serves a stream's FFmpeg log as text: the live log of a
+// stream encoded by this instance, or else the log stored with its latest
+// ended session. session_id selects an ended session instead. With
+// follow=true, or an Accept header of text/event-stream, the live log is
+// tailed over server-sent events until the stream ends.
+func (h *StreamHandler) ServeStreamLogs(w http.ResponseWriter, r *http.Request, streamKey string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var sessionID int64
+	if value := r.URL.Query().Get("session_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid session_id", http.StatusBadRequest)
+			return
+		}
+		sessionID = id
+	}
+
+	follow := r.URL.Query().Get("follow") == "true" ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+	if sessionID == 0 {
+		if logs := h.encoderService.StreamLogs(streamKey); logs != nil {
+			if follow {
+				h.tailStreamLogs(w, r, streamKey)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte(logs.String()))
+			return
+		}
+	}
+
+	if follow {
+		http.Error(w, "Stream is not being encoded", http.StatusNotFound)
+		return
+	}
+
+	session, err := h.encoderService.GetEndedSession(streamKey, sessionID)
+	if err != nil {
+		http.Error(w, "Failed to get session log", http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		http.Error(w, "No session log found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Session-ID", strconv.FormatInt(session.ID, 10))
+	w.Write([]byte(session.FFmpegLog))
+}
+
+// tailStreamLogs sends the buffered log lines of a stream encoded by this
+// instance, then every new line, as server-sent events. An end event is sent
+// when the stream stops being encoded.
+func (h *StreamHandler) tailStreamLogs(w http.ResponseWriter, r *http.Request, streamKey string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	logs := h.encoderService.StreamLogs(streamKey)
+	if logs == nil {
+		http.Error(w, "Stream is not being encoded", http.StatusNotFound)
+		return
+	}
+	lines, updates, unsubscribe := logs.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	for _, line := range lines {
+		fmt.Fprintf(w, "data: %s\n\n", line)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(logKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case line, ok := <-updates:
+			if !ok {
+				fmt.Fprint(w, "event: end\ndata: stream ended\n\n")
+				flusher.Flush()
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", line)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
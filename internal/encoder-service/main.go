@@ -7,15 +7,19 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 
 	"streamkit/internal/encoder-service/handlers"
+	"streamkit/internal/encoder-service/metrics"
 	"streamkit/internal/encoder-service/models"
 	"streamkit/internal/encoder-service/repos"
 	"streamkit/internal/encoder-service/service"
+	"streamkit/internal/shared/keyseal"
 )
 
 func main() {
@@ -34,6 +38,15 @@ func main() {
 		port = "8082"
 	}
 
+	// Operator endpoints are served on their own port, which must not be
+	// exposed publicly, and require ENCODER_ADMIN_TOKEN as a bearer token.
+	// They reject every request when it is unset.
+	adminPort := os.Getenv("ADMIN_PORT")
+	if adminPort == "" {
+		adminPort = "8084"
+	}
+	adminToken := os.Getenv("ENCODER_ADMIN_TOKEN")
+
 	rtmpServer := os.Getenv("RTMP_SERVER")
 	if rtmpServer == "" {
 		rtmpServer = "rtmp"
@@ -44,11 +57,39 @@ func main() {
 		rtmpPort = "1935"
 	}
 
+	// nginx-rtmp's HTTP server, for its /stat and /control endpoints
+	rtmpHTTPURL := os.Getenv("RTMP_HTTP_URL")
+	if rtmpHTTPURL == "" {
+		rtmpHTTPURL = "http://" + rtmpServer
+	}
+
+	// Identifies this instance's streams, sessions and encryption keys in the
+	// database shared with other instances, so that startup cleanup only ends
+	// what this instance was encoding. It must be unique and stay the same
+	// across restarts.
+	instanceID := os.Getenv("ENCODER_INSTANCE_ID")
+	if instanceID == "" {
+		instanceID, err = os.Hostname()
+		if err != nil {
+			logger.Fatal("ENCODER_INSTANCE_ID is unset and the hostname is unknown", zap.Error(err))
+		}
+	}
+
 	outputDir := os.Getenv("HLS_OUTPUT_DIR")
 	if outputDir == "" {
 		outputDir = "/tmp/hls"
 	}
 
+	ladderSpec := os.Getenv("HLS_RENDITIONS")
+	if ladderSpec == "" {
+		ladderSpec = models.DefaultLadderSpec
+	}
+
+	ladder, err := models.ParseLadder(ladderSpec)
+	if err != nil {
+		logger.Fatal("Invalid HLS_RENDITIONS", zap.String("spec", ladderSpec), zap.Error(err))
+	}
+
 	// Database configuration
 	dbHost := os.Getenv("DB_HOST")
 	if dbHost == "" {
@@ -75,6 +116,17 @@ func main() {
 		dbName = "streamkit"
 	}
 
+	// Storage configuration
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = service.StorageBackendS3
+	}
+
+	storageLocalPath := os.Getenv("STORAGE_LOCAL_PATH")
+	if storageLocalPath == "" {
+		storageLocalPath = "/var/lib/streamkit/storage"
+	}
+
 	// MinIO/S3 configuration
 	minioEndpoint := os.Getenv("MINIO_ENDPOINT")
 	if minioEndpoint == "" {
@@ -105,6 +157,35 @@ func main() {
 
 	cdnBaseURL := os.Getenv("CDN_BASE_URL")
 
+	// Seconds between thumbnails of live streams; 0 disables them
+	thumbnailIntervalSpec := os.Getenv("THUMBNAIL_INTERVAL")
+	if thumbnailIntervalSpec == "" {
+		thumbnailIntervalSpec = "10"
+	}
+
+	thumbnailSeconds, err := strconv.Atoi(thumbnailIntervalSpec)
+	if err != nil || thumbnailSeconds < 0 {
+		logger.Fatal("Invalid THUMBNAIL_INTERVAL", zap.String("interval", thumbnailIntervalSpec))
+	}
+	thumbnailInterval := time.Duration(thumbnailSeconds) * time.Second
+
+	// Key encryption key shared with the API, as 64 hex characters. Streams
+	// with encryption enabled are refused when it is unset.
+	var keyring *keyseal.Keyring
+	if keyEncryptionKey := os.Getenv("HLS_KEY_ENCRYPTION_KEY"); keyEncryptionKey != "" {
+		keyring, err = keyseal.New(keyEncryptionKey)
+		if err != nil {
+			logger.Fatal("Invalid HLS_KEY_ENCRYPTION_KEY", zap.Error(err))
+		}
+	}
+
+	// The API's public base URL, which encrypted playlists' EXT-X-KEY URIs
+	// point at. Players fetch keys from it, so there is no usable default.
+	keyBaseURL := strings.TrimSuffix(os.Getenv("HLS_KEY_BASE_URL"), "/")
+	if keyring != nil && keyBaseURL == "" {
+		logger.Fatal("HLS_KEY_BASE_URL is required when HLS_KEY_ENCRYPTION_KEY is set")
+	}
+
 	// Connect to database
 	dbURL := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		dbHost, dbPort, dbUser, dbPassword, dbName)
@@ -124,9 +205,33 @@ func main() {
 
 	// Create stream repository
 	streamRepo := repos.NewStreamRepo(db, logger)
+	recordingRepo := repos.NewRecordingRepo(db, logger)
+	sessionRepo := repos.NewSessionRepo(db, logger)
+	webhookRepo := repos.NewWebhookRepo(db, logger)
+	keyRepo := repos.NewKeyRepo(db, logger)
+
+	// Streams this instance was encoding when it last stopped have no FFmpeg
+	// process anymore; their publishers reconnect as new publishes
+	if ended, err := streamRepo.EndOrphanedStreams(instanceID, "encoder service restarted"); err != nil {
+		logger.Error("Failed to end orphaned streams", zap.Error(err))
+	} else if ended > 0 {
+		logger.Warn("Ended streams left active by the previous run", zap.Int("count", ended))
+	}
+	if closed, err := sessionRepo.CloseOpenSessions(instanceID, models.SessionEndEncoderRestart); err != nil {
+		logger.Error("Failed to close open sessions", zap.Error(err))
+	} else if closed > 0 {
+		logger.Warn("Closed sessions left open by the previous run", zap.Int64("count", closed))
+	}
+	if deleted, err := keyRepo.DeleteUnrecordedKeys(instanceID); err != nil {
+		logger.Error("Failed to delete encryption keys of unrecorded publishes", zap.Error(err))
+	} else if deleted > 0 {
+		logger.Warn("Deleted encryption keys left by the previous run", zap.Int64("count", deleted))
+	}
 
-	// Create storage service
+	// Create storage backend
 	storageConfig := &models.StorageConfig{
+		Backend:         storageBackend,
+		LocalPath:       storageLocalPath,
 		Endpoint:        minioEndpoint,
 		AccessKeyID:     minioAccessKey,
 		SecretAccessKey: minioSecretKey,
@@ -135,50 +240,94 @@ func main() {
 		Region:          minioRegion,
 	}
 
-	storageService, err := service.NewStorageService(logger, storageConfig, cdnBaseURL)
+	storage, err := service.NewStorage(logger, storageConfig, cdnBaseURL)
 	if err != nil {
-		logger.Fatal("Failed to create storage service", zap.Error(err))
+		logger.Fatal("Failed to create storage backend",
+			zap.String("backend", storageBackend),
+			zap.Error(err),
+		)
 	}
 
-	logger.Info("Connected to MinIO/S3 successfully")
+	logger.Info("Storage backend ready", zap.String("backend", storageBackend))
 
 	logger.Info("Encoder service configuration",
+		zap.String("instance_id", instanceID),
 		zap.String("port", port),
+		zap.String("admin_port", adminPort),
+		zap.Bool("admin_token_configured", adminToken != ""),
 		zap.String("rtmp_server", rtmpServer),
 		zap.String("rtmp_port", rtmpPort),
 		zap.String("output_dir", outputDir),
+		zap.String("renditions", ladderSpec),
+		zap.Duration("thumbnail_interval", thumbnailInterval),
 		zap.String("db_host", dbHost),
 		zap.String("db_name", dbName),
+		zap.String("storage_backend", storageBackend),
 		zap.String("minio_endpoint", minioEndpoint),
 		zap.String("minio_bucket", minioBucket),
 		zap.String("cdn_base_url", cdnBaseURL),
+		zap.Bool("encryption_configured", keyring != nil),
+		zap.String("key_base_url", keyBaseURL),
 	)
 
+	// Create webhook service for outbound lifecycle events
+	webhookService := service.NewWebhookService(logger, webhookRepo)
+
+	// Retry failed deliveries, including those pending from before a restart
+	go webhookService.RetryDeliveries(time.Second)
+
 	// Create encoder service
 	encoderService := service.NewEncoderService(
 		logger,
+		instanceID,
 		rtmpServer,
 		rtmpPort,
+		rtmpHTTPURL,
 		outputDir,
+		ladder,
+		thumbnailInterval,
 		streamRepo,
-		storageService,
+		recordingRepo,
+		sessionRepo,
+		storage,
+		webhookService,
+		keyRepo,
+		keyring,
+		keyBaseURL,
 	)
 
+	// No FFmpeg process survives the service, so nothing writes the output
+	// left by the previous run anymore
+	if err := encoderService.RemoveStaleOutput(); err != nil {
+		logger.Error("Failed to remove stale output", zap.String("output_dir", outputDir), zap.Error(err))
+	}
+
+	// Sample the bytes each publisher has sent for its session
+	go encoderService.MonitorIngest(10 * time.Second)
+
+	// Delete the stored files of streams deleted through the API
+	go encoderService.CleanUpDeletedStreams(time.Minute)
+
 	// Create handlers
 	eventHandler := handlers.NewEventHandler(logger, encoderService)
-	hlsHandler := handlers.NewHLSHandler(logger, storageService)
+	tenantService := service.NewTenantService(logger, streamRepo)
+	hlsHandler := handlers.NewHLSHandler(logger, storage, tenantService, encoderService)
+	streamHandler := handlers.NewStreamHandler(logger, encoderService)
 
-	// Setup routes
-	http.HandleFunc("/events/published", eventHandler.HandlePublishedEvent)
+	// Setup routes, recording request metrics under each route's pattern
+	handle := func(pattern string, handler http.HandlerFunc) {
+		http.HandleFunc(pattern, metrics.Instrument(pattern, handler))
+	}
+	handle("/events/published", eventHandler.HandlePublishedEvent)
 
 	// Health check endpoint
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	handle("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"status": "healthy"}`))
 	})
 
 	// Stats endpoint
-	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+	handle("/stats", func(w http.ResponseWriter, r *http.Request) {
 		stats, err := encoderService.GetStreamStats()
 		if err != nil {
 			logger.Error("Failed to get stream stats", zap.Error(err))
@@ -191,7 +340,7 @@ func main() {
 	})
 
 	// Active streams endpoint
-	http.HandleFunc("/streams/active", func(w http.ResponseWriter, r *http.Request) {
+	handle("/streams/active", func(w http.ResponseWriter, r *http.Request) {
 		streams, err := encoderService.GetActiveStreams()
 		if err != nil {
 			logger.Error("Failed to get active streams", zap.Error(err))
@@ -203,20 +352,77 @@ func main() {
 		json.NewEncoder(w).Encode(streams)
 	})
 
-	// HLS serving endpoints
-	http.HandleFunc("/hls/", func(w http.ResponseWriter, r *http.Request) {
+	// Single stream status endpoint, including FFmpeg restart tracking
+	handle("/streams/status", func(w http.ResponseWriter, r *http.Request) {
+		playbackID := r.URL.Query().Get("playback_id")
+		if playbackID == "" {
+			http.Error(w, "playback_id parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		stream, err := encoderService.GetStream(playbackID)
+		if err != nil {
+			logger.Error("Failed to get stream", zap.String("playback_id", playbackID), zap.Error(err))
+			http.Error(w, "Failed to get stream", http.StatusInternalServerError)
+			return
+		}
+		if stream == nil {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stream)
+	})
+
+	// Public per-stream endpoints: /streams/{stream_key}/snapshot
+	handle("/streams/", streamHandler.ServeStream)
+
+	// HLS serving endpoints for live streams and recordings
+	serveHLS := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
 		// Route to appropriate handler based on file type
-		if strings.HasSuffix(r.URL.Path, ".m3u8") {
+		if strings.HasSuffix(r.URL.Path, ".m3u8") || strings.HasSuffix(r.URL.Path, ".mpd") {
 			hlsHandler.ServeHLSPlaylist(w, r)
-		} else if strings.HasSuffix(r.URL.Path, ".ts") {
+		} else if strings.HasSuffix(r.URL.Path, ".ts") || strings.HasSuffix(r.URL.Path, ".m4s") ||
+			strings.HasSuffix(r.URL.Path, ".mp4") {
 			hlsHandler.ServeHLSSegment(w, r)
+		} else if strings.HasPrefix(r.URL.Path, "/recordings/") &&
+			(strings.HasSuffix(r.URL.Path, ".jpg") || strings.HasSuffix(r.URL.Path, ".vtt")) {
+			hlsHandler.ServeSpriteFile(w, r)
 		} else {
 			http.NotFound(w, r)
 		}
-	})
+	}
+	handle("/hls/", serveHLS)
+	handle("/recordings/", serveHLS)
+	handle("/thumbnails/", hlsHandler.ServeThumbnail)
+
+	// Prometheus metrics
+	metrics.RegisterActiveEncoders(encoderService.GetActiveStreamsCount)
+	http.Handle("/metrics", metrics.Handler())
 
 	// Stream manifest endpoint
-	http.HandleFunc("/manifest", hlsHandler.GetStreamManifest)
+	handle("/manifest", hlsHandler.GetStreamManifest)
+
+	// Operator endpoints, on the admin port only
+	adminHandler := handlers.NewAdminHandler(logger, encoderService, adminToken)
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/streams/stop", metrics.Instrument("/streams/stop", adminHandler.StopStream))
+	// Per-stream operator endpoints: /streams/{stream_key}/logs
+	adminMux.HandleFunc("/streams/", metrics.Instrument("/streams/",
+		adminHandler.RequireToken(streamHandler.ServeAdminStream)))
+
+	go func() {
+		logger.Info("Starting encoder admin server", zap.String("port", adminPort))
+		if err := http.ListenAndServe(":"+adminPort, adminMux); err != nil {
+			logger.Fatal("Failed to start admin server", zap.Error(err))
+		}
+	}()
 
 	// Start server
 	logger.Info("Starting encoder service server", zap.String("port", port))
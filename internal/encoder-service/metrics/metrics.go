@@ -0,0 +1,252 @@
+// Package metrics defines the encoder service's Prometheus metrics, served
+// at /metrics
+package metrics
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"streamkit/internal/encoder-service/models"
+	"streamkit/internal/shared/httpmetrics"
+)
+
+// FFmpeg exit reasons
+const (
+	FFmpegExitCompleted   = "completed"    // the input ended
+	FFmpegExitStopped     = "stopped"      // killed because the stream stopped
+	FFmpegExitCrashed     = "crashed"      // non-zero exit status
+	FFmpegExitSignaled    = "signaled"     // killed by a signal the encoder did not send
+	FFmpegExitStartFailed = "start_failed" // the process could not be started
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "streamkit",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	ffmpegRestarts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "ffmpeg",
+		Name:      "restarts_total",
+		Help:      "FFmpeg processes restarted after a crash.",
+	})
+
+	ffmpegExits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "ffmpeg",
+		Name:      "exits_total",
+		Help:      "FFmpeg process exits by reason.",
+	}, []string{"reason"})
+
+	uploadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "streamkit",
+		Subsystem: "storage",
+		Name:      "upload_duration_seconds",
+		Help:      "Storage upload latency by file kind.",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"kind"})
+
+	uploadBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "storage",
+		Name:      "upload_bytes_total",
+		Help:      "Bytes uploaded to storage by file kind.",
+	}, []string{"kind"})
+
+	uploadFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "storage",
+		Name:      "upload_failures_total",
+		Help:      "Failed storage uploads by file kind.",
+	}, []string{"kind"})
+
+	hlsBytesServed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "hls",
+		Name:      "served_bytes_total",
+		Help:      "HLS response body bytes served by file kind.",
+	}, []string{"kind"})
+
+	// Progress metrics have no per-stream label, which would create series
+	// for every playback ID ever encoded. Per-stream values are served by
+	// /streams/active.
+	ffmpegFPS = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "streamkit",
+		Subsystem: "ffmpeg",
+		Name:      "fps",
+		Help:      "Output frame rate in FFmpeg progress reports.",
+		Buckets:   []float64{5, 10, 15, 20, 24, 25, 30, 48, 50, 60},
+	})
+
+	ffmpegBitrate = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "streamkit",
+		Subsystem: "ffmpeg",
+		Name:      "bitrate_bits_per_second",
+		Help:      "Output bitrate in FFmpeg progress reports.",
+		Buckets:   prometheus.ExponentialBuckets(250e3, 2, 7),
+	})
+
+	ffmpegSpeed = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "streamkit",
+		Subsystem: "ffmpeg",
+		Name:      "speed_ratio",
+		Help:      "Encoding speed relative to real time in FFmpeg progress reports; below 1 the encoder falls behind.",
+		Buckets:   []float64{0.5, 0.8, 0.9, 0.95, 1, 1.05, 1.1, 1.5, 2},
+	})
+
+	ffmpegFrames = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "ffmpeg",
+		Name:      "frames_total",
+		Help:      "Frames encoded.",
+	})
+
+	ffmpegDroppedFrames = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "ffmpeg",
+		Name:      "dropped_frames_total",
+		Help:      "Frames dropped by FFmpeg.",
+	})
+
+	ffmpegDuplicatedFrames = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "ffmpeg",
+		Name:      "duplicated_frames_total",
+		Help:      "Frames duplicated by FFmpeg.",
+	})
+
+	tenantCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "streamkit",
+		Subsystem: "tenant_cache",
+		Name:      "lookups_total",
+		Help:      "Playback ID to storage prefix lookups by result (hit or miss).",
+	}, []string{"result"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterActiveEncoders exposes the number of running encoders, read from
+// count at scrape time
+func RegisterActiveEncoders(count func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "streamkit",
+		Subsystem: "encoder",
+		Name:      "active_streams",
+		Help:      "Streams being encoded.",
+	}, func() float64 {
+		return float64(count())
+	})
+}
+
+// Instrument records the latency and status code of the requests handled by
+// handler under route, the pattern it is registered with
+func Instrument(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := httpmetrics.NewStatusRecorder(w)
+
+		handler(recorder, r)
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(recorder.Status())).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// FFmpegRestarted counts an FFmpeg restart
+func FFmpegRestarted() {
+	ffmpegRestarts.Inc()
+}
+
+// FFmpegExited counts an FFmpeg exit with one of the FFmpegExit reasons
+func FFmpegExited(reason string) {
+	ffmpegExits.WithLabelValues(reason).Inc()
+}
+
+// FFmpegProgress records a progress report of an FFmpeg process. previous is
+// the process's preceding report, nil for its first, so the frame counters
+// only grow by the frames encoded since.
+func FFmpegProgress(previous, current *models.EncoderProgress) {
+	ffmpegFPS.Observe(current.FPS)
+	ffmpegBitrate.Observe(current.BitrateKbps * 1000)
+	ffmpegSpeed.Observe(current.Speed)
+
+	var frames, dropped, duplicated int64
+	if previous != nil {
+		frames, dropped, duplicated = previous.Frames, previous.DroppedFrames, previous.DuplicatedFrames
+	}
+	ffmpegFrames.Add(float64(max(current.Frames-frames, 0)))
+	ffmpegDroppedFrames.Add(float64(max(current.DroppedFrames-dropped, 0)))
+	ffmpegDuplicatedFrames.Add(float64(max(current.DuplicatedFrames-duplicated, 0)))
+}
+
+// ObserveUpload records the upload of a file of size bytes stored under key
+func ObserveUpload(key string, size int64, duration time.Duration, err error) {
+	kind := FileKind(key)
+	uploadDuration.WithLabelValues(kind).Observe(duration.Seconds())
+	if err != nil {
+		uploadFailures.WithLabelValues(kind).Inc()
+		return
+	}
+	uploadBytes.WithLabelValues(kind).Add(float64(size))
+}
+
+// AddHLSBytesServed counts n response bytes served for the HLS file name
+func AddHLSBytesServed(name string, n int64) {
+	hlsBytesServed.WithLabelValues(FileKind(name)).Add(float64(n))
+}
+
+// TenantCacheLookup counts a tenant cache lookup
+func TenantCacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	tenantCacheLookups.WithLabelValues(result).Inc()
+}
+
+// FileKind labels an HLS or DASH file by its extension: playlist, segment or
+// other. DASH manifests count as playlists and initialization segments as
+// segments.
+func FileKind(name string) string {
+	switch path.Ext(name) {
+	case ".m3u8", ".mpd":
+		return "playlist"
+	case ".ts", ".m4s", ".mp4":
+		return "segment"
+	default:
+		return "other"
+	}
+}
+
+// CountingWriter counts the body bytes written to a response
+type CountingWriter struct {
+	http.ResponseWriter
+	Bytes int64
+}
+
+// Write counts and writes p
+func (w *CountingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.Bytes += int64(n)
+	return n, err
+}
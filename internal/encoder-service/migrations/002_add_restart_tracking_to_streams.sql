@@ -0,0 +1,3 @@
+-- Track FFmpeg restarts for the current publish of each stream
+ALTER TABLE streams ADD COLUMN IF NOT EXISTS restart_count INT NOT NULL DEFAULT 0;
+ALTER TABLE streams ADD COLUMN IF NOT EXISTS last_exit_reason TEXT;
@@ -0,0 +1,5 @@
+-- Record which encoder instance runs each stream's current publish, so an
+-- instance that restarts only ends the streams it was encoding
+ALTER TABLE streams ADD COLUMN IF NOT EXISTS encoder_instance VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_streams_encoder_instance ON streams(encoder_instance);
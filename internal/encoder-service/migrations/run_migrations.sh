@@ -10,7 +10,10 @@ echo "Database is ready!"
 
 # Run migrations
 echo "Running database migrations..."
-psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f /app/migrations/001_create_streams_table.sql
+for migration in "$(dirname "$0")"/*.sql; do
+  echo "Applying $migration"
+  psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f "$migration"
+done
 
 echo "Migrations completed!"
 
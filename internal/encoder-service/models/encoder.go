@@ -2,16 +2,52 @@ package models
 
 import (
 	"context"
-	"os/exec"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 )
 
 // StreamEncoder represents an active encoding process for a stream
 type StreamEncoder struct {
-	StreamKey string
-	Cmd       *exec.Cmd
-	Ctx       context.Context
-	Cancel    context.CancelFunc
-	Logger    *zap.Logger
+	StreamKey    string
+	LiveStreamID int
+	PlaybackID   string // public identifier used for storage keys and playback URLs
+	// OrganizationID and StoragePrefix identify the tenant that owns the stream
+	OrganizationID int
+	StoragePrefix  string
+	Ctx            context.Context
+	Cancel         context.CancelFunc
+	Logger         *zap.Logger
+	Recording      *Recording     // nil unless the stream is being archived
+	Session        *StreamSession // nil if the session could not be recorded
+	// Encrypted is set when the stream's segments are encrypted with
+	// AES-128; KeyRotation is how often its key changes, 0 for never
+	Encrypted   bool
+	KeyRotation time.Duration
+	// BytesIngested is the publisher's byte count last reported by the RTMP server
+	BytesIngested atomic.Int64
+	// Progress is the FFmpeg process's latest progress report, nil until the
+	// first one arrives
+	Progress atomic.Pointer[EncoderProgress]
+	// Logs holds the last lines FFmpeg wrote to stderr during the session
+	Logs *LogBuffer
+	// VideoPlaylist is the media playlist of the tallest video rendition,
+	// which snapshots are taken from. It is set, under the encoder service's
+	// lock, when encoding starts and again when the ladder is fitted to the
+	// input, before the first FFmpeg process, and stays empty for audio-only
+	// ladders.
+	VideoPlaylist string
+	// EndReason is set, under the encoder service's lock, when the stream is
+	// stopped for a reason other than the publisher leaving
+	EndReason SessionEndReason
+}
+
+// EventData returns the webhook payload describing this stream
+func (s *StreamEncoder) EventData(errMessage string) *StreamEventData {
+	return &StreamEventData{
+		LiveStreamID: s.LiveStreamID,
+		PlaybackID:   s.PlaybackID,
+		Error:        errMessage,
+	}
 }
@@ -0,0 +1,60 @@
+package models
+
+import "fmt"
+
+// Output packagings of an encoding profile
+const (
+	PackagingHLS  = "hls"  // MPEG-TS segments with HLS playlists
+	PackagingCMAF = "cmaf" // fMP4 segments with HLS playlists and a DASH manifest
+)
+
+// EncodingProfile holds the FFmpeg settings for a stream, managed through
+// the API's /api/profiles resource
+type EncodingProfile struct {
+	ID              int      `json:"id"               db:"id"`
+	Name            string   `json:"name"             db:"name"`
+	Preset          string   `json:"preset"           db:"preset"`
+	Tune            string   `json:"tune"             db:"tune"`
+	SegmentDuration int      `json:"segment_duration" db:"segment_duration"`
+	PlaylistSize    int      `json:"playlist_size"    db:"playlist_size"`
+	AudioBitrate    int      `json:"audio_bitrate"    db:"audio_bitrate"` // kbps, 0 keeps each rendition's default
+	Renditions      []string `json:"renditions"       db:"renditions"`    // empty uses the configured ladder
+	Packaging       string   `json:"packaging"        db:"packaging"`
+	LowLatency      bool     `json:"low_latency"      db:"low_latency"` // LL-HLS parts, CMAF only
+}
+
+// DefaultEncodingProfile returns the settings used for streams without a profile
+func DefaultEncodingProfile() *EncodingProfile {
+	return &EncodingProfile{
+		Name:            "default",
+		Preset:          "ultrafast",
+		Tune:            "zerolatency",
+		SegmentDuration: 3,
+		PlaylistSize:    60,
+		Packaging:       PackagingHLS,
+	}
+}
+
+// Validate rejects profiles FFmpeg could not run with, guarding against rows
+// edited outside the API
+func (p *EncodingProfile) Validate() error {
+	if p.Preset == "" {
+		return fmt.Errorf("profile %q: preset is required", p.Name)
+	}
+	if p.SegmentDuration < 1 || p.SegmentDuration > 10 {
+		return fmt.Errorf("profile %q: segment_duration %d out of range", p.Name, p.SegmentDuration)
+	}
+	if p.PlaylistSize < 3 {
+		return fmt.Errorf("profile %q: playlist_size %d out of range", p.Name, p.PlaylistSize)
+	}
+	if p.AudioBitrate < 0 || p.AudioBitrate > 320 {
+		return fmt.Errorf("profile %q: audio_bitrate %d out of range", p.Name, p.AudioBitrate)
+	}
+	if p.Packaging != PackagingHLS && p.Packaging != PackagingCMAF {
+		return fmt.Errorf("profile %q: unsupported packaging %q", p.Name, p.Packaging)
+	}
+	if p.LowLatency && p.Packaging != PackagingCMAF {
+		return fmt.Errorf("profile %q: low_latency requires cmaf packaging", p.Name)
+	}
+	return nil
+}
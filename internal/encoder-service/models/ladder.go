@@ -0,0 +1,98 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultLadderSpec is the rendition ladder used when none is configured
+const DefaultLadderSpec = "1080p,720p,480p,audio"
+
+// Rendition represents one variant of the adaptive bitrate ladder
+type Rendition struct {
+	Name         string `json:"name"`
+	Height       int    `json:"height"`        // 0 for audio-only renditions
+	VideoBitrate int    `json:"video_bitrate"` // kbps
+	AudioBitrate int    `json:"audio_bitrate"` // kbps
+}
+
+// IsAudioOnly reports whether the rendition carries no video
+func (r Rendition) IsAudioOnly() bool {
+	return r.Height == 0
+}
+
+// renditionPresets are the named renditions a ladder can be built from
+var renditionPresets = map[string]Rendition{
+	"1080p": {Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 128},
+	"720p":  {Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	"480p":  {Name: "480p", Height: 480, VideoBitrate: 1400, AudioBitrate: 96},
+	"360p":  {Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+	"audio": {Name: "audio", AudioBitrate: 64},
+}
+
+// ParseLadder builds a ladder from a comma-separated list of preset names,
+// e.g. "1080p,720p,480p,audio"
+func ParseLadder(spec string) ([]Rendition, error) {
+	var ladder []Rendition
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		rendition, ok := renditionPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown rendition %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate rendition %q", name)
+		}
+		seen[name] = true
+
+		ladder = append(ladder, rendition)
+	}
+
+	if len(ladder) == 0 {
+		return nil, fmt.Errorf("ladder must contain at least one rendition")
+	}
+
+	return ladder, nil
+}
+
+// FitLadder drops the video renditions taller than a source of sourceHeight,
+// so the source is never upscaled. If none would be left, the shortest video
+// rendition is kept at the source height. A sourceHeight of 0 leaves the
+// ladder unchanged.
+func FitLadder(ladder []Rendition, sourceHeight int) []Rendition {
+	if sourceHeight <= 0 {
+		return ladder
+	}
+
+	var fitted []Rendition
+	var shortest *Rendition
+	hasVideo := false
+	for i, rendition := range ladder {
+		if rendition.IsAudioOnly() {
+			fitted = append(fitted, rendition)
+			continue
+		}
+		if shortest == nil || rendition.Height < shortest.Height {
+			shortest = &ladder[i]
+		}
+		if rendition.Height <= sourceHeight {
+			fitted = append(fitted, rendition)
+			hasVideo = true
+		}
+	}
+
+	if !hasVideo && shortest != nil {
+		rendition := *shortest
+		// libx264 needs even dimensions
+		rendition.Height = sourceHeight &^ 1
+		fitted = append([]Rendition{rendition}, fitted...)
+	}
+
+	return fitted
+}
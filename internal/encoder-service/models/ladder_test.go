@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// ladderSummary describes a ladder as name:height pairs
+func ladderSummary(ladder []Rendition) []string {
+	summary := []string{}
+	for _, rendition := range ladder {
+		summary = append(summary, fmt.Sprintf("%s:%d", rendition.Name, rendition.Height))
+	}
+	return summary
+}
+
+func TestFitLadder(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec         string
+		sourceHeight int
+		want         []string
+	}{
+		{"unknown source height", "1080p,720p,480p,audio", 0, []string{"1080p:1080", "720p:720", "480p:480", "audio:0"}},
+		{"source as tall as the ladder", "1080p,720p,480p,audio", 1080, []string{"1080p:1080", "720p:720", "480p:480", "audio:0"}},
+		{"taller source", "1080p,720p", 2160, []string{"1080p:1080", "720p:720"}},
+		{"720p source", "1080p,720p,480p,audio", 720, []string{"720p:720", "480p:480", "audio:0"}},
+		{"between renditions", "1080p,720p,480p,360p", 600, []string{"480p:480", "360p:360"}},
+		{"shorter than every rendition", "1080p,720p,audio", 400, []string{"720p:400", "audio:0"}},
+		{"odd source height", "720p,480p", 241, []string{"480p:240"}},
+		{"audio-only ladder", "audio", 720, []string{"audio:0"}},
+		{"audio listed first", "audio,720p,480p", 360, []string{"480p:360", "audio:0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ladder, err := ParseLadder(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseLadder(%q) error = %v", tt.spec, err)
+			}
+			original := ladderSummary(ladder)
+
+			got := ladderSummary(FitLadder(ladder, tt.sourceHeight))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FitLadder(%q, %d) = %v, want %v", tt.spec, tt.sourceHeight, got, tt.want)
+			}
+			// The ladder is shared across streams, so it must not change
+			if after := ladderSummary(ladder); !reflect.DeepEqual(after, original) {
+				t.Errorf("FitLadder modified its input: %v, was %v", after, original)
+			}
+		})
+	}
+}
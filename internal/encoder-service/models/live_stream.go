@@ -0,0 +1,33 @@
+package models
+
+// Statuses of the API's live streams. The API owns the state machine; the
+// encoder moves a stream through connecting, live, reconnecting, ended and
+// errored as its key publishes, and leaves the other statuses to the API.
+const (
+	LiveStreamStatusCreated      = "created"
+	LiveStreamStatusIdle         = "idle"
+	LiveStreamStatusConnecting   = "connecting"
+	LiveStreamStatusLive         = "live"
+	LiveStreamStatusReconnecting = "reconnecting"
+	LiveStreamStatusEnded        = "ended"
+	LiveStreamStatusErrored      = "errored"
+	// LiveStreamStatusDisabled blocks a stream key from publishing
+	LiveStreamStatusDisabled = "disabled"
+)
+
+// LiveStream represents the API-owned record for an issued stream key
+type LiveStream struct {
+	ID                int    `json:"id"                  db:"id"`
+	StreamKey         string `json:"stream_key"          db:"stream_key"`
+	PlaybackID        string `json:"playback_id"         db:"playback_id"`
+	OrganizationID    int    `json:"organization_id"     db:"organization_id"`
+	StoragePrefix     string `json:"storage_prefix"      db:"-"` // the organization's, empty for the default tenant
+	Status            string `json:"status"              db:"status"`
+	EncodingProfileID *int   `json:"encoding_profile_id" db:"encoding_profile_id"`
+	RecordingEnabled  bool   `json:"recording_enabled"   db:"recording_enabled"`
+
+	// EncryptionEnabled has the stream's segments encrypted with AES-128,
+	// with a new key every KeyRotationSeconds, or one key per publish for 0
+	EncryptionEnabled  bool `json:"encryption_enabled"   db:"encryption_enabled"`
+	KeyRotationSeconds int  `json:"key_rotation_seconds" db:"key_rotation_seconds"`
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	// logLineMaxLength is the longest line a LogBuffer keeps; longer lines
+	// are truncated
+	logLineMaxLength = 4096
+
+	// logSubscriberBuffer is the number of lines a subscriber may fall behind
+	// by before lines are dropped for it
+	logSubscriberBuffer = 256
+)
+
+// LogBuffer keeps the last lines written to it, up to a fixed number, and
+// passes every new line on to its subscribers. A stream encoder's FFmpeg
+// stderr is written to one, across restarts.
+type LogBuffer struct {
+	mu       sync.Mutex
+	lines    []string // ring of up to maxLines lines, oldest at start
+	start    int
+	maxLines int
+	partial  []byte // an incomplete last line
+	// subscribers is nil once the buffer is closed
+	subscribers map[chan string]struct{}
+}
+
+// NewLogBuffer creates a buffer that keeps the last maxLines lines
+func NewLogBuffer(maxLines int) *LogBuffer {
+	return &LogBuffer{
+		maxLines:    maxLines,
+		subscribers: make(map[chan string]struct{}),
+	}
+}
+
+// Write splits p into lines and appends the complete ones. FFmpeg ends lines
+// with either \n or \r.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range p {
+		if c == '\n' || c == '\r' {
+			if len(b.partial) > 0 {
+				b.appendLocked(string(b.partial))
+				b.partial = b.partial[:0]
+			}
+			continue
+		}
+		if len(b.partial) < logLineMaxLength {
+			b.partial = append(b.partial, c)
+		}
+	}
+	return len(p), nil
+}
+
+// Append adds a line of its own, such as a note from the encoder service
+func (b *LogBuffer) Append(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.appendLocked(line)
+}
+
+func (b *LogBuffer) appendLocked(line string) {
+	if len(line) > logLineMaxLength {
+		line = line[:logLineMaxLength]
+	}
+
+	if len(b.lines) < b.maxLines {
+		b.lines = append(b.lines, line)
+	} else {
+		b.lines[b.start] = line
+		b.start = (b.start + 1) % b.maxLines
+	}
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- line:
+		default: // the subscriber is too slow; drop the line for it
+		}
+	}
+}
+
+// Lines returns the buffered lines, oldest first
+func (b *LogBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.linesLocked()
+}
+
+func (b *LogBuffer) linesLocked() []string {
+	lines := make([]string, 0, len(b.lines))
+	lines = append(lines, b.lines[b.start:]...)
+	return append(lines, b.lines[:b.start]...)
+}
+
+// String returns the buffered lines as text
+func (b *LogBuffer) String() string {
+	lines := b.Lines()
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Subscribe returns the buffered lines and a channel that receives every line
+// added after them. The channel is closed when the buffer is closed or the
+// returned unsubscribe function is called.
+func (b *LogBuffer) Subscribe() ([]string, <-chan string, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscriber := make(chan string, logSubscriberBuffer)
+	if b.subscribers == nil {
+		close(subscriber)
+		return b.linesLocked(), subscriber, func() {}
+	}
+	b.subscribers[subscriber] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, exists := b.subscribers[subscriber]; exists {
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	return b.linesLocked(), subscriber, unsubscribe
+}
+
+// Close adds any incomplete last line and ends all subscriptions. Nothing
+// should be written to the buffer afterwards.
+func (b *LogBuffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.partial) > 0 {
+		b.appendLocked(string(b.partial))
+		b.partial = nil
+	}
+	for subscriber := range b.subscribers {
+		close(subscriber)
+	}
+	b.subscribers = nil
+}
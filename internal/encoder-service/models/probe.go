@@ -0,0 +1,18 @@
+package models
+
+// InputProbe describes the media a publisher sends, probed from the RTMP input
+// when a publish starts. Fields of a missing video or audio stream are empty.
+type InputProbe struct {
+	VideoCodec string  `json:"video_codec"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	FrameRate  float64 `json:"frame_rate"`
+	// KeyframeInterval is the longest time between keyframes seen while
+	// probing, in seconds, or 0 if fewer than two keyframes were seen
+	KeyframeInterval float64 `json:"keyframe_interval_seconds"`
+	AudioCodec       string  `json:"audio_codec"`
+	AudioSampleRate  int     `json:"audio_sample_rate"`
+	AudioChannels    int     `json:"audio_channels"`
+	// Warnings describe publisher settings that hurt playback
+	Warnings []string `json:"warnings"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// EncoderProgress is the latest progress report of a stream's FFmpeg process.
+// Frame counts start again from zero when the process is restarted.
+type EncoderProgress struct {
+	Frames int64 `json:"frames"`
+	// FPS is the output frame rate; Speed is encoding time relative to real
+	// time, so a speed below 1 means the encoder is falling behind the input
+	FPS         float64 `json:"fps"`
+	BitrateKbps float64 `json:"bitrate_kbps"`
+	Speed       float64 `json:"speed"`
+	// DroppedFrames and DuplicatedFrames count the frames FFmpeg dropped or
+	// repeated to keep the output frame rate constant
+	DroppedFrames    int64     `json:"dropped_frames"`
+	DuplicatedFrames int64     `json:"duplicated_frames"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// RecordingStatus represents the status of a live-to-VOD recording
+type RecordingStatus string
+
+const (
+	RecordingStatusRecording RecordingStatus = "recording"
+	RecordingStatusReady     RecordingStatus = "ready"
+	RecordingStatusFailed    RecordingStatus = "failed"
+)
+
+// Recording represents an archived broadcast stored as a VOD asset
+type Recording struct {
+	ID              int64           `json:"id"               db:"id"`
+	LiveStreamID    int             `json:"live_stream_id"   db:"live_stream_id"`
+	StreamKey       string          `json:"stream_key"       db:"stream_key"`
+	PlaybackID      string          `json:"playback_id"      db:"-"`
+	Status          RecordingStatus `json:"status"           db:"status"`
+	StoragePrefix   string          `json:"storage_prefix"   db:"storage_prefix"`
+	DurationSeconds float64         `json:"duration_seconds" db:"duration_seconds"`
+	SegmentCount    int             `json:"segment_count"    db:"segment_count"`
+	StartedAt       time.Time       `json:"started_at"       db:"started_at"`
+	EndedAt         *time.Time      `json:"ended_at"         db:"ended_at"`
+	// SpriteSheets is the number of seek preview sprite sheets, 0 if the
+	// recording has no previews
+	SpriteSheets int `json:"sprite_sheets" db:"sprite_sheets"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// SessionEndReason records why a publish session ended
+type SessionEndReason string
+
+const (
+	SessionEndPublisherLeft SessionEndReason = "publisher_left"
+	SessionEndFFmpegCrash   SessionEndReason = "ffmpeg_crash"
+	SessionEndAdminKill     SessionEndReason = "admin_kill"
+	// SessionEndEncoderRestart closes sessions that were live when the
+	// encoder service stopped
+	SessionEndEncoderRestart SessionEndReason = "encoder_restart"
+)
+
+// StreamSession is one publish of a stream key, from publish to unpublish
+type StreamSession struct {
+	ID               int64            `json:"id"                db:"id"`
+	LiveStreamID     int              `json:"live_stream_id"    db:"live_stream_id"`
+	StartedAt        time.Time        `json:"started_at"        db:"started_at"`
+	EndedAt          *time.Time       `json:"ended_at"          db:"ended_at"`
+	DurationSeconds  float64          `json:"duration_seconds"  db:"duration_seconds"`
+	EndReason        SessionEndReason `json:"end_reason"        db:"end_reason"`
+	BytesIngested    int64            `json:"bytes_ingested"    db:"bytes_ingested"`
+	SegmentsProduced int              `json:"segments_produced" db:"segments_produced"`
+	// Input is the probed source media, nil if the input was not probed
+	Input *InputProbe `json:"input"`
+	// FFmpegLog is the end of FFmpeg's stderr, stored when the session ends
+	FFmpegLog string `json:"-" db:"ffmpeg_log"`
+}
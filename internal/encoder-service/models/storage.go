@@ -2,8 +2,11 @@ package models
 
 import "time"
 
-// StorageConfig represents MinIO/S3 storage configuration
+// StorageConfig represents storage backend configuration. Backend is one of
+// "s3" (MinIO or any S3-compatible store), "local" or "memory".
 type StorageConfig struct {
+	Backend         string `json:"backend"`
+	LocalPath       string `json:"local_path"`
 	Endpoint        string `json:"endpoint"`
 	AccessKeyID     string `json:"access_key_id"`
 	SecretAccessKey string `json:"secret_access_key"`
@@ -12,7 +15,7 @@ type StorageConfig struct {
 	Region          string `json:"region"`
 }
 
-// StorageFile represents a file stored in MinIO/S3
+// StorageFile represents a file held by a storage backend
 type StorageFile struct {
 	Key          string    `json:"key"`
 	Size         int64     `json:"size"`
@@ -21,9 +24,18 @@ type StorageFile struct {
 	ContentType  string    `json:"content_type"`
 }
 
+// StorageCleanup is a deleted stream whose files are still to be deleted
+// from storage
+type StorageCleanup struct {
+	ID            int64     `json:"id"             db:"id"`
+	StoragePrefix string    `json:"storage_prefix" db:"storage_prefix"`
+	PlaybackID    string    `json:"playback_id"    db:"playback_id"`
+	CreatedAt     time.Time `json:"created_at"     db:"created_at"`
+}
+
 // HLSManifest represents HLS playlist structure
 type HLSManifest struct {
-	StreamKey     string       `json:"stream_key"`
+	PlaybackID    string       `json:"playback_id"`
 	PlaylistURL   string       `json:"playlist_url"`
 	Segments      []HLSSegment `json:"segments"`
 	TotalDuration float64      `json:"total_duration"`
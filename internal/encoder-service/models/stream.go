@@ -13,21 +13,42 @@ const (
 	StreamStatusError    StreamStatus = "error"
 )
 
-// Stream represents a stream in the database
+// Stream represents a stream in the database. The secret stream key is never
+// serialized; streams are identified by their public playback ID.
 type Stream struct {
-	ID        int64        `json:"id"         db:"id"`
-	StreamKey string       `json:"stream_key" db:"stream_key"`
-	Status    StreamStatus `json:"status"     db:"status"`
-	StartedAt *time.Time   `json:"started_at" db:"started_at"`
-	StoppedAt *time.Time   `json:"stopped_at" db:"stopped_at"`
-	CreatedAt time.Time    `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
+	ID         int64        `json:"id"          db:"id"`
+	StreamKey  string       `json:"-"           db:"stream_key"`
+	PlaybackID string       `json:"playback_id" db:"playback_id"`
+	Status     StreamStatus `json:"status"      db:"status"`
+	// RestartCount is the number of FFmpeg restarts in the current publish
+	RestartCount   int        `json:"restart_count"    db:"restart_count"`
+	LastExitReason *string    `json:"last_exit_reason" db:"last_exit_reason"`
+	StartedAt      *time.Time `json:"started_at"       db:"started_at"`
+	StoppedAt      *time.Time `json:"stopped_at"       db:"stopped_at"`
+	CreatedAt      time.Time  `json:"created_at"       db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"       db:"updated_at"`
+	// Progress is the encoder's latest FFmpeg progress, set only for streams
+	// encoded by this instance
+	Progress *EncoderProgress `json:"progress,omitempty" db:"-"`
 }
 
 // StreamStats represents stream statistics
 type StreamStats struct {
-	TotalStreams    int64 `json:"total_streams"`
-	ActiveStreams   int64 `json:"active_streams"`
-	InactiveStreams int64 `json:"inactive_streams"`
-	ErrorStreams    int64 `json:"error_streams"`
+	TotalStreams    int64          `json:"total_streams"`
+	ActiveStreams   int64          `json:"active_streams"`
+	InactiveStreams int64          `json:"inactive_streams"`
+	ErrorStreams    int64          `json:"error_streams"`
+	Tenants         []*TenantStats `json:"tenants"`
+}
+
+// TenantStats represents the stream statistics of one organization. It only
+// identifies the organization by ID, since /stats is not authenticated.
+type TenantStats struct {
+	OrganizationID int   `json:"organization_id"`
+	TotalStreams   int64 `json:"total_streams"` // stream keys issued by the API
+	ActiveStreams  int64 `json:"active_streams"`
+	ErrorStreams   int64 `json:"error_streams"`
+	Recordings     int64 `json:"recordings"`
+	// EncodingStreams counts the FFmpeg processes running on this encoder
+	EncodingStreams int `json:"encoding_streams"`
 }
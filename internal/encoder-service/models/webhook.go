@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// Webhook event types emitted by the encoder
+const (
+	WebhookEventStreamStarted  = "stream.started"
+	WebhookEventStreamEnded    = "stream.ended"
+	WebhookEventStreamErrored  = "stream.errored"
+	WebhookEventRecordingReady = "recording.ready"
+)
+
+// WebhookDeliveryStatus represents the state of a webhook delivery
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookSubscription is a URL registered through the API to receive events
+type WebhookSubscription struct {
+	ID     int    `json:"id"     db:"id"`
+	URL    string `json:"url"    db:"url"`
+	Secret string `json:"-"      db:"secret"`
+}
+
+// WebhookEvent is the JSON body sent to subscribers
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// StreamEventData is the payload of stream.* events. The secret stream key is
+// never included.
+type StreamEventData struct {
+	LiveStreamID int    `json:"live_stream_id"`
+	PlaybackID   string `json:"playback_id"`
+	Error        string `json:"error,omitempty"`
+}
+
+// RecordingEventData is the payload of recording.* events
+type RecordingEventData struct {
+	RecordingID     int64   `json:"recording_id"`
+	LiveStreamID    int     `json:"live_stream_id"`
+	PlaybackID      string  `json:"playback_id"`
+	StoragePrefix   string  `json:"storage_prefix"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// WebhookDelivery tracks one event sent to one subscription
+type WebhookDelivery struct {
+	ID             int64                 `json:"id"              db:"id"`
+	SubscriptionID int                   `json:"subscription_id" db:"subscription_id"`
+	EventID        string                `json:"event_id"        db:"event_id"`
+	EventType      string                `json:"event_type"      db:"event_type"`
+	Payload        []byte                `json:"-"               db:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"          db:"status"`
+	Attempts       int                   `json:"attempts"        db:"attempts"`
+	ResponseStatus *int                  `json:"response_status" db:"response_status"`
+	LastError      *string               `json:"last_error"      db:"last_error"`
+	// NextAttemptAt is when a pending delivery is next attempted
+	NextAttemptAt *time.Time `json:"next_attempt_at" db:"next_attempt_at"`
+	// Subscription is the delivery's target
+	Subscription *WebhookSubscription `json:"-"`
+}
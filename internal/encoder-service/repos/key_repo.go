@@ -0,0 +1,73 @@
+package repos
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// KeyRepo handles database operations for streams' HLS encryption keys. Keys
+// are stored sealed; the API opens them to serve them to players.
+type KeyRepo struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewKeyRepo creates a new encryption key repository
+func NewKeyRepo(db *sql.DB, logger *zap.Logger) *KeyRepo {
+	return &KeyRepo{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateKey stores a sealed encryption key of a stream, issued by the encoder
+// instance instanceID, and returns its ID. recordingID is the recording the
+// key's segments are archived in, or 0 if the publish is not recorded.
+func (r *KeyRepo) CreateKey(liveStreamID int, recordingID int64, instanceID string, sealedKey []byte) (int64, error) {
+	query := `
+		INSERT INTO stream_encryption_keys (live_stream_id, recording_id, encoder_instance, sealed_key)
+		VALUES ($1, NULLIF($2, 0), $3, $4)
+		RETURNING id
+	`
+
+	var id int64
+	if err := r.db.QueryRow(query, liveStreamID, recordingID, instanceID, sealedKey).Scan(&id); err != nil {
+		r.logger.Error("Failed to create encryption key",
+			zap.Int("live_stream_id", liveStreamID),
+			zap.Error(err),
+		)
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// DeleteKeys deletes stored encryption keys by ID
+func (r *KeyRepo) DeleteKeys(ids []int64) error {
+	query := `DELETE FROM stream_encryption_keys WHERE id = ANY($1)`
+
+	if _, err := r.db.Exec(query, pq.Array(ids)); err != nil {
+		r.logger.Error("Failed to delete encryption keys", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUnrecordedKeys deletes the stored keys the encoder instance
+// instanceID issued for publishes that were not recorded. Called at startup,
+// before the instance encodes any stream, for the keys of publishes it was
+// still encoding when it last stopped. Other instances' keys are left alone.
+func (r *KeyRepo) DeleteUnrecordedKeys(instanceID string) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM stream_encryption_keys
+		WHERE recording_id IS NULL AND encoder_instance = $1
+	`, instanceID)
+	if err != nil {
+		r.logger.Error("Failed to delete unrecorded encryption keys", zap.Error(err))
+		return 0, err
+	}
+	return result.RowsAffected()
+}
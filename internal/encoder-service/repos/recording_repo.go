@@ -0,0 +1,107 @@
+package repos
+
+import (
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+// RecordingRepo handles database operations for recordings
+type RecordingRepo struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewRecordingRepo creates a new recording repository
+func NewRecordingRepo(db *sql.DB, logger *zap.Logger) *RecordingRepo {
+	return &RecordingRepo{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateRecording creates a recording record for a new broadcast
+func (r *RecordingRepo) CreateRecording(
+	liveStreamID int,
+	streamKey, playbackID string,
+) (*models.Recording, error) {
+	now := time.Now()
+
+	query := `
+		INSERT INTO recordings (live_stream_id, stream_key, status, started_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+
+	recording := &models.Recording{
+		LiveStreamID: liveStreamID,
+		StreamKey:    streamKey,
+		PlaybackID:   playbackID,
+		Status:       models.RecordingStatusRecording,
+		StartedAt:    now,
+	}
+
+	err := r.db.QueryRow(
+		query,
+		liveStreamID,
+		streamKey,
+		recording.Status,
+		now,
+		now,
+	).Scan(&recording.ID)
+	if err != nil {
+		r.logger.Error("Failed to create recording",
+			zap.String("stream_key", streamKey),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	r.logger.Info("Created recording record",
+		zap.String("stream_key", streamKey),
+		zap.Int64("recording_id", recording.ID),
+	)
+
+	return recording, nil
+}
+
+// FinishRecording stores the final status, VOD details and sprite sheet
+// count of a recording
+func (r *RecordingRepo) FinishRecording(recording *models.Recording) error {
+	now := time.Now()
+	recording.EndedAt = &now
+
+	query := `
+		UPDATE recordings
+		SET status = $1, storage_prefix = $2, duration_seconds = $3, segment_count = $4,
+			sprite_sheets = $5, ended_at = $6
+		WHERE id = $7
+	`
+
+	_, err := r.db.Exec(
+		query,
+		recording.Status,
+		recording.StoragePrefix,
+		recording.DurationSeconds,
+		recording.SegmentCount,
+		recording.SpriteSheets,
+		now,
+		recording.ID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to finish recording",
+			zap.Int64("recording_id", recording.ID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	r.logger.Info("Finished recording",
+		zap.Int64("recording_id", recording.ID),
+		zap.String("status", string(recording.Status)),
+	)
+	return nil
+}
@@ -0,0 +1,200 @@
+package repos
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+// SessionRepo handles database operations for publish sessions
+type SessionRepo struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewSessionRepo creates a new session repository
+func NewSessionRepo(db *sql.DB, logger *zap.Logger) *SessionRepo {
+	return &SessionRepo{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateSession creates the session record for a new publish encoded by the
+// encoder instance instanceID
+func (r *SessionRepo) CreateSession(liveStreamID int, instanceID string) (*models.StreamSession, error) {
+	now := time.Now()
+
+	query := `
+		INSERT INTO stream_sessions (live_stream_id, encoder_instance, started_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+
+	session := &models.StreamSession{
+		LiveStreamID: liveStreamID,
+		StartedAt:    now,
+	}
+
+	err := r.db.QueryRow(query, liveStreamID, instanceID, now).Scan(&session.ID)
+	if err != nil {
+		r.logger.Error("Failed to create session",
+			zap.Int("live_stream_id", liveStreamID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	r.logger.Info("Created session record",
+		zap.Int("live_stream_id", liveStreamID),
+		zap.Int64("session_id", session.ID),
+	)
+
+	return session, nil
+}
+
+// SetInputProbe stores the probed source media of a session
+func (r *SessionRepo) SetInputProbe(sessionID int64, probe *models.InputProbe) error {
+	query := `
+		UPDATE stream_sessions
+		SET input_probed_at = $1, input_video_codec = NULLIF($2::text, ''),
+			input_width = NULLIF($3::integer, 0), input_height = NULLIF($4::integer, 0),
+			input_frame_rate = NULLIF($5::double precision, 0),
+			input_keyframe_interval = NULLIF($6::double precision, 0),
+			input_audio_codec = NULLIF($7::text, ''),
+			input_audio_sample_rate = NULLIF($8::integer, 0),
+			input_audio_channels = NULLIF($9::integer, 0), input_warnings = $10
+		WHERE id = $11
+	`
+
+	_, err := r.db.Exec(
+		query,
+		time.Now(),
+		probe.VideoCodec,
+		probe.Width,
+		probe.Height,
+		probe.FrameRate,
+		probe.KeyframeInterval,
+		probe.AudioCodec,
+		probe.AudioSampleRate,
+		probe.AudioChannels,
+		pq.Array(probe.Warnings),
+		sessionID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to store session input probe",
+			zap.Int64("session_id", sessionID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// FinishSession stores the end time, duration, end reason, totals and FFmpeg
+// log of a session
+func (r *SessionRepo) FinishSession(session *models.StreamSession) error {
+	now := time.Now()
+	session.EndedAt = &now
+	session.DurationSeconds = now.Sub(session.StartedAt).Seconds()
+
+	query := `
+		UPDATE stream_sessions
+		SET ended_at = $1, duration_seconds = $2, end_reason = $3,
+			bytes_ingested = $4, segments_produced = $5, ffmpeg_log = $6
+		WHERE id = $7
+	`
+
+	_, err := r.db.Exec(
+		query,
+		now,
+		session.DurationSeconds,
+		session.EndReason,
+		session.BytesIngested,
+		session.SegmentsProduced,
+		session.FFmpegLog,
+		session.ID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to finish session",
+			zap.Int64("session_id", session.ID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	r.logger.Info("Finished session",
+		zap.Int64("session_id", session.ID),
+		zap.String("end_reason", string(session.EndReason)),
+		zap.Float64("duration_seconds", session.DurationSeconds),
+	)
+	return nil
+}
+
+// CloseOpenSessions ends the sessions of the encoder instance instanceID that
+// are still open with reason. It is called at startup, when none of the
+// instance's sessions can still be live; other instances' sessions are left
+// alone. Their duration is left NULL: when they really ended is unknown. It
+// returns the number of sessions closed.
+func (r *SessionRepo) CloseOpenSessions(instanceID string, reason models.SessionEndReason) (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE stream_sessions SET ended_at = $1, end_reason = $2
+		WHERE ended_at IS NULL AND encoder_instance = $3
+	`, time.Now(), reason, instanceID)
+	if err != nil {
+		r.logger.Error("Failed to close open sessions", zap.Error(err))
+		return 0, err
+	}
+
+	closed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return closed, nil
+}
+
+// GetEndedSession returns an ended session of a stream key with its FFmpeg
+// log: the one with sessionID, or the latest when sessionID is 0. It returns
+// nil if there is none.
+func (r *SessionRepo) GetEndedSession(streamKey string, sessionID int64) (*models.StreamSession, error) {
+	query := `
+		SELECT s.id, s.live_stream_id, s.started_at, s.ended_at, s.duration_seconds,
+			s.end_reason, s.bytes_ingested, s.segments_produced, COALESCE(s.ffmpeg_log, '')
+		FROM stream_sessions s
+		JOIN live_streams ls ON ls.id = s.live_stream_id
+		WHERE ls.stream_key = $1 AND s.ended_at IS NOT NULL
+			AND ($2::bigint = 0 OR s.id = $2)
+		ORDER BY s.started_at DESC
+		LIMIT 1
+	`
+
+	session := &models.StreamSession{}
+	err := r.db.QueryRow(query, streamKey, sessionID).Scan(
+		&session.ID,
+		&session.LiveStreamID,
+		&session.StartedAt,
+		&session.EndedAt,
+		&session.DurationSeconds,
+		&session.EndReason,
+		&session.BytesIngested,
+		&session.SegmentsProduced,
+		&session.FFmpegLog,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		r.logger.Error("Failed to get session",
+			zap.String("stream_key", streamKey),
+			zap.Int64("session_id", sessionID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	return session, nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 
 	"streamkit/internal/encoder-service/models"
@@ -30,7 +31,7 @@ func (r *StreamRepo) CreateStream(streamKey string) (*models.Stream, error) {
 	query := `
 		INSERT INTO streams (stream_key, status, created_at, updated_at)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, stream_key, status, started_at, stopped_at, created_at, updated_at
+		RETURNING id, stream_key, status, restart_count, last_exit_reason, started_at, stopped_at, created_at, updated_at
 	`
 
 	stream := &models.Stream{}
@@ -44,6 +45,8 @@ func (r *StreamRepo) CreateStream(streamKey string) (*models.Stream, error) {
 		&stream.ID,
 		&stream.StreamKey,
 		&stream.Status,
+		&stream.RestartCount,
+		&stream.LastExitReason,
 		&stream.StartedAt,
 		&stream.StoppedAt,
 		&stream.CreatedAt,
@@ -65,17 +68,39 @@ func (r *StreamRepo) CreateStream(streamKey string) (*models.Stream, error) {
 	return stream, nil
 }
 
-// StartStream marks a stream as active
-func (r *StreamRepo) StartStream(streamKey string) error {
+// StartStream marks a stream as active on the encoder instance instanceID and
+// resets its restart tracking. The API's live stream for the key moves to
+// connecting in the same transaction.
+func (r *StreamRepo) StartStream(streamKey, instanceID string) error {
 	now := time.Now()
 
-	query := `
-		UPDATE streams 
-		SET status = $1, started_at = $2, updated_at = $3
-		WHERE stream_key = $4
-	`
+	err := r.inTx(func(tx *sql.Tx) error {
+		// First publish for an API-issued key creates its record
+		_, err := tx.Exec(`
+			INSERT INTO streams (stream_key, status, encoder_instance, started_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $4, $4)
+			ON CONFLICT (stream_key) DO UPDATE
+			SET status = EXCLUDED.status, encoder_instance = EXCLUDED.encoder_instance,
+				started_at = EXCLUDED.started_at, updated_at = EXCLUDED.updated_at,
+				restart_count = 0, last_exit_reason = NULL
+		`, streamKey, models.StreamStatusActive, instanceID, now)
+		if err != nil {
+			return err
+		}
+
+		changed, err := transitionLiveStream(tx, streamKey, models.LiveStreamStatusConnecting,
+			"publish started", now,
+			models.LiveStreamStatusCreated, models.LiveStreamStatusIdle,
+			models.LiveStreamStatusEnded, models.LiveStreamStatusErrored)
+		if err != nil || !changed {
+			return err
+		}
 
-	result, err := r.db.Exec(query, models.StreamStatusActive, now, now, streamKey)
+		_, err = tx.Exec(`
+			UPDATE live_streams SET started_at = $1, stopped_at = NULL WHERE stream_key = $2
+		`, now, streamKey)
+		return err
+	})
 	if err != nil {
 		r.logger.Error("Failed to start stream",
 			zap.String("stream_key", streamKey),
@@ -84,35 +109,35 @@ func (r *StreamRepo) StartStream(streamKey string) error {
 		return err
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		// Stream doesn't exist, create it
-		_, err = r.CreateStream(streamKey)
-		if err != nil {
-			return err
-		}
-		// Try to start it again
-		_, err = r.db.Exec(query, models.StreamStatusActive, now, now, streamKey)
-		if err != nil {
-			return err
-		}
-	}
-
 	r.logger.Info("Started stream", zap.String("stream_key", streamKey))
 	return nil
 }
 
-// StopStream marks a stream as inactive
-func (r *StreamRepo) StopStream(streamKey string) error {
-	now := time.Now()
+// MarkStreamLive moves the API's live stream for a key to live once its
+// FFmpeg process is running, after a publish or a restart
+func (r *StreamRepo) MarkStreamLive(streamKey, reason string) error {
+	err := r.inTx(func(tx *sql.Tx) error {
+		_, err := transitionLiveStream(tx, streamKey, models.LiveStreamStatusLive,
+			reason, time.Now(),
+			models.LiveStreamStatusConnecting, models.LiveStreamStatusReconnecting)
+		return err
+	})
+	if err != nil {
+		r.logger.Error("Failed to mark stream as live",
+			zap.String("stream_key", streamKey),
+			zap.Error(err),
+		)
+		return err
+	}
 
-	query := `
-		UPDATE streams 
-		SET status = $1, stopped_at = $2, updated_at = $3
-		WHERE stream_key = $4
-	`
+	return nil
+}
 
-	_, err := r.db.Exec(query, models.StreamStatusInactive, now, now, streamKey)
+// StopStream marks a stream as inactive and the API's live stream for its
+// key as ended, giving reason in its status history
+func (r *StreamRepo) StopStream(streamKey, reason string) error {
+	err := r.endStream(streamKey, models.StreamStatusInactive,
+		models.LiveStreamStatusEnded, reason, nil)
 	if err != nil {
 		r.logger.Error("Failed to stop stream",
 			zap.String("stream_key", streamKey),
@@ -125,13 +150,239 @@ func (r *StreamRepo) StopStream(streamKey string) error {
 	return nil
 }
 
+// RecordRestart increments a stream's restart count and stores the exit
+// reason of the FFmpeg process that is being restarted. The API's live
+// stream for the key moves to reconnecting.
+func (r *StreamRepo) RecordRestart(streamKey, exitReason string) error {
+	now := time.Now()
+
+	err := r.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE streams 
+			SET restart_count = restart_count + 1, last_exit_reason = $1, updated_at = $2
+			WHERE stream_key = $3
+		`, exitReason, now, streamKey)
+		if err != nil {
+			return err
+		}
+
+		_, err = transitionLiveStream(tx, streamKey, models.LiveStreamStatusReconnecting,
+			exitReason, now, models.LiveStreamStatusLive)
+		return err
+	})
+	if err != nil {
+		r.logger.Error("Failed to record stream restart",
+			zap.String("stream_key", streamKey),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// MarkStreamError marks a stream as errored, and the API's live stream for
+// its key, after FFmpeg failed repeatedly or could not be started
+func (r *StreamRepo) MarkStreamError(streamKey, exitReason string) error {
+	err := r.endStream(streamKey, models.StreamStatusError,
+		models.LiveStreamStatusErrored, exitReason, &exitReason)
+	if err != nil {
+		r.logger.Error("Failed to mark stream as errored",
+			zap.String("stream_key", streamKey),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	r.logger.Warn("Marked stream as errored",
+		zap.String("stream_key", streamKey),
+		zap.String("exit_reason", exitReason),
+	)
+	return nil
+}
+
+// EndOrphanedStreams marks the streams last published on the encoder
+// instance instanceID that are still active, or whose API live stream is
+// still connecting, live or reconnecting, as errored with reason. It is
+// called at startup, before the instance accepts any publish: no FFmpeg
+// process survives the encoder, so such streams were left behind by a crash.
+// Streams of other instances, and those a publisher has since moved to
+// another instance, are left alone. It returns the number of streams ended.
+func (r *StreamRepo) EndOrphanedStreams(instanceID, reason string) (int, error) {
+	rows, err := r.db.Query(`
+		SELECT s.stream_key FROM streams s
+		LEFT JOIN live_streams ls ON ls.stream_key = s.stream_key
+		WHERE s.encoder_instance = $1
+			AND (s.status = $2 OR ls.status IN ($3, $4, $5))
+	`, instanceID, models.StreamStatusActive, models.LiveStreamStatusConnecting,
+		models.LiveStreamStatusLive, models.LiveStreamStatusReconnecting)
+	if err != nil {
+		r.logger.Error("Failed to get orphaned streams", zap.Error(err))
+		return 0, err
+	}
+
+	var streamKeys []string
+	for rows.Next() {
+		var streamKey string
+		if err := rows.Scan(&streamKey); err != nil {
+			rows.Close()
+			r.logger.Error("Failed to scan orphaned stream", zap.Error(err))
+			return 0, err
+		}
+		streamKeys = append(streamKeys, streamKey)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Failed to get orphaned streams", zap.Error(err))
+		return 0, err
+	}
+
+	for _, streamKey := range streamKeys {
+		err := r.endStream(streamKey, models.StreamStatusError,
+			models.LiveStreamStatusErrored, reason, &reason)
+		if err != nil {
+			r.logger.Error("Failed to end orphaned stream",
+				zap.String("stream_key", streamKey),
+				zap.Error(err),
+			)
+			return 0, err
+		}
+	}
+
+	return len(streamKeys), nil
+}
+
+// endStream records the end of a publish with its final status on both the
+// encoder's stream and the API's live stream. A nil exitReason keeps the
+// last one recorded. A live stream disabled while it was live stays disabled.
+func (r *StreamRepo) endStream(
+	streamKey string,
+	status models.StreamStatus,
+	liveStatus, reason string,
+	exitReason *string,
+) error {
+	now := time.Now()
+
+	return r.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE streams
+			SET status = $1, last_exit_reason = COALESCE($2, last_exit_reason),
+				stopped_at = $3, updated_at = $3
+			WHERE stream_key = $4
+		`, status, exitReason, now, streamKey)
+		if err != nil {
+			return err
+		}
+
+		changed, err := transitionLiveStream(tx, streamKey, liveStatus, reason, now,
+			models.LiveStreamStatusConnecting, models.LiveStreamStatusLive,
+			models.LiveStreamStatusReconnecting)
+		if err != nil || !changed {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE live_streams SET stopped_at = $1 WHERE stream_key = $2`,
+			now, streamKey)
+		return err
+	})
+}
+
+// transitionLiveStream moves the API's live stream for a key to status and
+// records the change in its status history, if the stream is in one of the
+// from statuses. It reports whether the stream changed; keys without a live
+// stream and streams in any other status, such as disabled, are left as is.
+func transitionLiveStream(
+	tx *sql.Tx,
+	streamKey, status, reason string,
+	at time.Time,
+	from ...string,
+) (bool, error) {
+	var id int
+	var current string
+	err := tx.QueryRow(`SELECT id, status FROM live_streams WHERE stream_key = $1 FOR UPDATE`,
+		streamKey).Scan(&id, &current)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	allowed := false
+	for _, s := range from {
+		if s == current {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`UPDATE live_streams SET status = $1 WHERE id = $2`, status, id); err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO stream_status_history (live_stream_id, from_status, to_status, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, id, current, status, reason, at)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// inTx runs fn in a transaction that is committed if fn succeeds
+func (r *StreamRepo) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// streamColumns are the columns scanStream reads, from streams s joined with
+// the API's live_streams ls for the playback ID. Keys whose live stream was
+// deleted have an empty playback ID.
+const streamColumns = `s.id, s.stream_key, COALESCE(ls.playback_id, ''), s.status, s.restart_count,
+	s.last_exit_reason, s.started_at, s.stopped_at, s.created_at, s.updated_at`
+
+// scanStream scans a row of streamColumns
+func scanStream(row interface{ Scan(...interface{}) error }) (*models.Stream, error) {
+	stream := &models.Stream{}
+	err := row.Scan(
+		&stream.ID,
+		&stream.StreamKey,
+		&stream.PlaybackID,
+		&stream.Status,
+		&stream.RestartCount,
+		&stream.LastExitReason,
+		&stream.StartedAt,
+		&stream.StoppedAt,
+		&stream.CreatedAt,
+		&stream.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
 // GetActiveStreams returns all active streams
 func (r *StreamRepo) GetActiveStreams() ([]*models.Stream, error) {
 	query := `
-		SELECT id, stream_key, status, started_at, stopped_at, created_at, updated_at
-		FROM streams 
-		WHERE status = $1
-		ORDER BY updated_at DESC
+		SELECT ` + streamColumns + `
+		FROM streams s
+		LEFT JOIN live_streams ls ON ls.stream_key = s.stream_key
+		WHERE s.status = $1
+		ORDER BY s.updated_at DESC
 	`
 
 	rows, err := r.db.Query(query, models.StreamStatusActive)
@@ -143,16 +394,7 @@ func (r *StreamRepo) GetActiveStreams() ([]*models.Stream, error) {
 
 	var streams []*models.Stream
 	for rows.Next() {
-		stream := &models.Stream{}
-		err := rows.Scan(
-			&stream.ID,
-			&stream.StreamKey,
-			&stream.Status,
-			&stream.StartedAt,
-			&stream.StoppedAt,
-			&stream.CreatedAt,
-			&stream.UpdatedAt,
-		)
+		stream, err := scanStream(rows)
 		if err != nil {
 			r.logger.Error("Failed to scan stream", zap.Error(err))
 			continue
@@ -194,30 +436,70 @@ func (r *StreamRepo) GetStreamStats() (*models.StreamStats, error) {
 	return stats, nil
 }
 
-// GetStreamByKey returns a stream by stream key
-func (r *StreamRepo) GetStreamByKey(streamKey string) (*models.Stream, error) {
+// GetTenantStats returns stream statistics per organization
+func (r *StreamRepo) GetTenantStats() ([]*models.TenantStats, error) {
 	query := `
-		SELECT id, stream_key, status, started_at, stopped_at, created_at, updated_at
-		FROM streams 
-		WHERE stream_key = $1
+		SELECT
+			o.id,
+			COUNT(ls.id) as total_streams,
+			COUNT(CASE WHEN s.status = $1 THEN 1 END) as active_streams,
+			COUNT(CASE WHEN s.status = $2 THEN 1 END) as error_streams,
+			(
+				SELECT COUNT(*) FROM recordings rec
+				JOIN live_streams rls ON rls.id = rec.live_stream_id
+				WHERE rls.organization_id = o.id
+			) as recordings
+		FROM organizations o
+		LEFT JOIN live_streams ls ON ls.organization_id = o.id
+		LEFT JOIN streams s ON s.stream_key = ls.stream_key
+		GROUP BY o.id
+		ORDER BY o.id
 	`
 
-	stream := &models.Stream{}
-	err := r.db.QueryRow(query, streamKey).Scan(
-		&stream.ID,
-		&stream.StreamKey,
-		&stream.Status,
-		&stream.StartedAt,
-		&stream.StoppedAt,
-		&stream.CreatedAt,
-		&stream.UpdatedAt,
-	)
+	rows, err := r.db.Query(query, models.StreamStatusActive, models.StreamStatusError)
+	if err != nil {
+		r.logger.Error("Failed to get tenant stats", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []*models.TenantStats{}
+	for rows.Next() {
+		tenant := &models.TenantStats{}
+		err := rows.Scan(
+			&tenant.OrganizationID,
+			&tenant.TotalStreams,
+			&tenant.ActiveStreams,
+			&tenant.ErrorStreams,
+			&tenant.Recordings,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan tenant stats", zap.Error(err))
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	return tenants, nil
+}
+
+// GetStreamByPlaybackID returns the stream of a playback ID, or nil if its
+// key has never been published
+func (r *StreamRepo) GetStreamByPlaybackID(playbackID string) (*models.Stream, error) {
+	query := `
+		SELECT ` + streamColumns + `
+		FROM streams s
+		JOIN live_streams ls ON ls.stream_key = s.stream_key
+		WHERE ls.playback_id = $1
+	`
+
+	stream, err := scanStream(r.db.QueryRow(query, playbackID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		r.logger.Error("Failed to get stream by key",
-			zap.String("stream_key", streamKey),
+		r.logger.Error("Failed to get stream by playback ID",
+			zap.String("playback_id", playbackID),
 			zap.Error(err),
 		)
 		return nil, err
@@ -225,3 +507,151 @@ func (r *StreamRepo) GetStreamByKey(streamKey string) (*models.Stream, error) {
 
 	return stream, nil
 }
+
+// GetLiveStreamByKey returns the API-issued stream for a stream key, or nil if
+// the key was never issued or has been deleted
+func (r *StreamRepo) GetLiveStreamByKey(streamKey string) (*models.LiveStream, error) {
+	liveStream, err := r.getLiveStream("ls.stream_key = $1", streamKey)
+	if err != nil {
+		r.logger.Error("Failed to get live stream by key",
+			zap.String("stream_key", streamKey),
+			zap.Error(err),
+		)
+	}
+	return liveStream, err
+}
+
+// GetLiveStreamByPlaybackID returns the API-issued stream for a playback ID,
+// or nil if there is none
+func (r *StreamRepo) GetLiveStreamByPlaybackID(playbackID string) (*models.LiveStream, error) {
+	liveStream, err := r.getLiveStream("ls.playback_id = $1", playbackID)
+	if err != nil {
+		r.logger.Error("Failed to get live stream by playback ID",
+			zap.String("playback_id", playbackID),
+			zap.Error(err),
+		)
+	}
+	return liveStream, err
+}
+
+// getLiveStream returns the live stream matching condition together with its
+// organization's storage prefix, or nil if none matches. Streams created
+// before organizations existed have no organization and an empty prefix.
+func (r *StreamRepo) getLiveStream(condition string, arg interface{}) (*models.LiveStream, error) {
+	query := `
+		SELECT ls.id, ls.stream_key, ls.playback_id, COALESCE(ls.organization_id, 0),
+			COALESCE(o.storage_prefix, ''), ls.status, ls.encoding_profile_id, ls.recording_enabled,
+			ls.encryption_enabled, ls.key_rotation_seconds
+		FROM live_streams ls
+		LEFT JOIN organizations o ON o.id = ls.organization_id
+		WHERE ` + condition
+
+	liveStream := &models.LiveStream{}
+	var status sql.NullString
+	err := r.db.QueryRow(query, arg).Scan(
+		&liveStream.ID,
+		&liveStream.StreamKey,
+		&liveStream.PlaybackID,
+		&liveStream.OrganizationID,
+		&liveStream.StoragePrefix,
+		&status,
+		&liveStream.EncodingProfileID,
+		&liveStream.RecordingEnabled,
+		&liveStream.EncryptionEnabled,
+		&liveStream.KeyRotationSeconds,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	liveStream.Status = status.String
+
+	return liveStream, nil
+}
+
+// GetEncodingProfile returns one of an organization's encoding profiles by
+// ID, or nil if it does not exist in that organization
+func (r *StreamRepo) GetEncodingProfile(id, organizationID int) (*models.EncodingProfile, error) {
+	query := `
+		SELECT id, name, preset, tune, segment_duration, playlist_size, audio_bitrate, renditions, packaging,
+			low_latency
+		FROM encoding_profiles
+		WHERE id = $1 AND organization_id = $2
+	`
+
+	profile := &models.EncodingProfile{}
+	err := r.db.QueryRow(query, id, organizationID).Scan(
+		&profile.ID,
+		&profile.Name,
+		&profile.Preset,
+		&profile.Tune,
+		&profile.SegmentDuration,
+		&profile.PlaylistSize,
+		&profile.AudioBitrate,
+		pq.Array(&profile.Renditions),
+		&profile.Packaging,
+		&profile.LowLatency,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get encoding profile",
+			zap.Int("encoding_profile_id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// GetStorageCleanups returns up to limit deleted streams whose files are
+// still to be deleted from storage, oldest first
+func (r *StreamRepo) GetStorageCleanups(limit int) ([]*models.StorageCleanup, error) {
+	query := `
+		SELECT id, storage_prefix, playback_id, created_at
+		FROM storage_cleanups
+		ORDER BY id
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		r.logger.Error("Failed to get storage cleanups", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cleanups []*models.StorageCleanup
+	for rows.Next() {
+		cleanup := &models.StorageCleanup{}
+		if err := rows.Scan(
+			&cleanup.ID,
+			&cleanup.StoragePrefix,
+			&cleanup.PlaybackID,
+			&cleanup.CreatedAt,
+		); err != nil {
+			r.logger.Error("Failed to scan storage cleanup", zap.Error(err))
+			continue
+		}
+		cleanups = append(cleanups, cleanup)
+	}
+
+	return cleanups, nil
+}
+
+// DeleteStorageCleanup removes a storage cleanup once the stream's files
+// have been deleted
+func (r *StreamRepo) DeleteStorageCleanup(id int64) error {
+	if _, err := r.db.Exec(`DELETE FROM storage_cleanups WHERE id = $1`, id); err != nil {
+		r.logger.Error("Failed to delete storage cleanup",
+			zap.Int64("storage_cleanup_id", id),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
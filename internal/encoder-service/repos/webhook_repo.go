@@ -0,0 +1,200 @@
+package repos
+
+import (
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+// WebhookRepo handles database operations for webhook subscriptions and deliveries
+type WebhookRepo struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// NewWebhookRepo creates a new webhook repository
+func NewWebhookRepo(db *sql.DB, logger *zap.Logger) *WebhookRepo {
+	return &WebhookRepo{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// GetSubscriptionsForEvent returns an organization's active subscriptions for
+// an event type
+func (r *WebhookRepo) GetSubscriptionsForEvent(
+	organizationID int,
+	eventType string,
+) ([]*models.WebhookSubscription, error) {
+	query := `
+		SELECT id, url, secret
+		FROM webhook_subscriptions
+		WHERE organization_id = $1 AND active = TRUE AND $2 = ANY(events)
+	`
+
+	rows, err := r.db.Query(query, organizationID, eventType)
+	if err != nil {
+		r.logger.Error("Failed to get webhook subscriptions",
+			zap.Int("organization_id", organizationID),
+			zap.String("event_type", eventType),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*models.WebhookSubscription
+	for rows.Next() {
+		subscription := &models.WebhookSubscription{}
+		if err := rows.Scan(&subscription.ID, &subscription.URL, &subscription.Secret); err != nil {
+			r.logger.Error("Failed to scan webhook subscription", zap.Error(err))
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// CreateDelivery records a pending delivery of an event to a subscription.
+// Its first attempt is due at nextAttemptAt.
+func (r *WebhookRepo) CreateDelivery(
+	subscription *models.WebhookSubscription,
+	event *models.WebhookEvent,
+	payload []byte,
+	nextAttemptAt time.Time,
+) (*models.WebhookDelivery, error) {
+	now := time.Now()
+
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status,
+			next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+
+	delivery := &models.WebhookDelivery{
+		SubscriptionID: subscription.ID,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Payload:        payload,
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  &nextAttemptAt,
+		Subscription:   subscription,
+	}
+	err := r.db.QueryRow(
+		query,
+		subscription.ID,
+		event.ID,
+		event.Type,
+		string(payload),
+		delivery.Status,
+		nextAttemptAt,
+		now,
+		now,
+	).Scan(&delivery.ID)
+	if err != nil {
+		r.logger.Error("Failed to create webhook delivery",
+			zap.Int("subscription_id", subscription.ID),
+			zap.String("event_type", event.Type),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries of active
+// subscriptions whose next attempt is due, with their subscriptions, and
+// pushes their next attempt back by lease so no other instance claims them
+// while they are attempted. A delivery whose attempt is never recorded, such
+// as when the service stops mid-attempt, is claimed again once lease passes.
+func (r *WebhookRepo) ClaimDueDeliveries(limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	now := time.Now()
+
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = $1, updated_at = $2
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id AND d.id IN (
+			SELECT pd.id
+			FROM webhook_deliveries pd
+			JOIN webhook_subscriptions ps ON ps.id = pd.subscription_id
+			WHERE pd.status = $3 AND pd.next_attempt_at <= $2 AND ps.active = TRUE
+			ORDER BY pd.next_attempt_at
+			LIMIT $4
+			FOR UPDATE OF pd SKIP LOCKED
+		)
+		RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts,
+			d.next_attempt_at, s.url, s.secret
+	`
+
+	rows, err := r.db.Query(query, now.Add(lease), now, models.WebhookDeliveryPending, limit)
+	if err != nil {
+		r.logger.Error("Failed to claim due webhook deliveries", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery := &models.WebhookDelivery{
+			Status:       models.WebhookDeliveryPending,
+			Subscription: &models.WebhookSubscription{},
+		}
+		var payload string
+		if err := rows.Scan(
+			&delivery.ID,
+			&delivery.SubscriptionID,
+			&delivery.EventID,
+			&delivery.EventType,
+			&payload,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.Subscription.URL,
+			&delivery.Subscription.Secret,
+		); err != nil {
+			r.logger.Error("Failed to scan webhook delivery", zap.Error(err))
+			continue
+		}
+		delivery.Payload = []byte(payload)
+		delivery.Subscription.ID = delivery.SubscriptionID
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// UpdateDelivery stores the outcome of the latest delivery attempt
+func (r *WebhookRepo) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, response_status = $3, last_error = $4, next_attempt_at = $5,
+			updated_at = $6
+		WHERE id = $7
+	`
+
+	_, err := r.db.Exec(
+		query,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseStatus,
+		delivery.LastError,
+		delivery.NextAttemptAt,
+		time.Now(),
+		delivery.ID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to update webhook delivery",
+			zap.Int64("delivery_id", delivery.ID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	return nil
+}
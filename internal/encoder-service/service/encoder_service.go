@@ -2,10 +2,13 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,35 +16,82 @@ import (
 
 	"streamkit/internal/encoder-service/models"
 	"streamkit/internal/encoder-service/repos"
+	"streamkit/internal/shared/keyseal"
 )
 
+// ErrStreamKeyRejected is returned when a publish uses a stream key that is
+// unknown, deleted or disabled in the API
+var ErrStreamKeyRejected = errors.New("stream key rejected")
+
+// ErrStreamNotActive is returned when a stream that is not being encoded is
+// asked to stop
+var ErrStreamNotActive = errors.New("stream is not being encoded")
+
 // EncoderService handles stream encoding operations
 type EncoderService struct {
-	logger          *zap.Logger
-	rtmpServer      string
-	rtmpPort        string
-	outputDir       string
-	streamRepo      *repos.StreamRepo
-	storageService  *StorageService
-	activeProcesses map[string]*models.StreamEncoder
-	mu              sync.RWMutex
+	logger *zap.Logger
+	// instanceID identifies this instance's streams, sessions and encryption
+	// keys in the shared database
+	instanceID  string
+	rtmpServer  string
+	rtmpPort    string
+	rtmpHTTPURL string
+	outputDir   string
+	ladder      []models.Rendition
+	// thumbnailInterval is how often live streams' thumbnails are replaced;
+	// 0 disables thumbnails
+	thumbnailInterval time.Duration
+	streamRepo        *repos.StreamRepo
+	recordingRepo     *repos.RecordingRepo
+	sessionRepo       *repos.SessionRepo
+	storage           Storage
+	webhookService    *WebhookService
+	keyRepo           *repos.KeyRepo
+	keyring           *keyseal.Keyring // nil if encryption is not configured
+	keyBaseURL        string           // the API's base URL, for EXT-X-KEY URIs
+	activeProcesses   map[string]*models.StreamEncoder
+	// lowLatencyOutputs holds the LL-HLS output of active low-latency streams
+	lowLatencyOutputs map[*models.StreamEncoder]*LLHLSOutput
+	keyRotators       map[*models.StreamEncoder]*keyRotator // of active encrypted streams
+	mu                sync.RWMutex
 }
 
 // NewEncoderService creates a new encoder service
 func NewEncoderService(
 	logger *zap.Logger,
-	rtmpServer, rtmpPort, outputDir string,
+	instanceID string,
+	rtmpServer, rtmpPort, rtmpHTTPURL, outputDir string,
+	ladder []models.Rendition,
+	thumbnailInterval time.Duration,
 	streamRepo *repos.StreamRepo,
-	storageService *StorageService,
+	recordingRepo *repos.RecordingRepo,
+	sessionRepo *repos.SessionRepo,
+	storage Storage,
+	webhookService *WebhookService,
+	keyRepo *repos.KeyRepo,
+	keyring *keyseal.Keyring,
+	keyBaseURL string,
 ) *EncoderService {
 	return &EncoderService{
-		logger:          logger,
-		rtmpServer:      rtmpServer,
-		rtmpPort:        rtmpPort,
-		outputDir:       outputDir,
-		streamRepo:      streamRepo,
-		storageService:  storageService,
-		activeProcesses: make(map[string]*models.StreamEncoder),
+		logger:            logger,
+		instanceID:        instanceID,
+		rtmpServer:        rtmpServer,
+		rtmpPort:          rtmpPort,
+		rtmpHTTPURL:       rtmpHTTPURL,
+		outputDir:         outputDir,
+		ladder:            ladder,
+		thumbnailInterval: thumbnailInterval,
+		streamRepo:        streamRepo,
+		recordingRepo:     recordingRepo,
+		sessionRepo:       sessionRepo,
+		storage:           storage,
+		webhookService:    webhookService,
+		keyRepo:           keyRepo,
+		keyring:           keyring,
+		keyBaseURL:        keyBaseURL,
+		activeProcesses:   make(map[string]*models.StreamEncoder),
+		lowLatencyOutputs: make(map[*models.StreamEncoder]*LLHLSOutput),
+		keyRotators:       make(map[*models.StreamEncoder]*keyRotator),
 	}
 }
 
@@ -56,21 +106,27 @@ func (e *EncoderService) StartEncoding(streamKey string) error {
 		return nil
 	}
 
-	e.logger.Info("Starting encoding for stream", zap.String("stream_key", streamKey))
+	// Only accept stream keys issued by the API
+	liveStream, err := e.authorizeStreamKey(streamKey)
+	if err != nil {
+		return err
+	}
 
-	// Update database status
-	if err := e.streamRepo.StartStream(streamKey); err != nil {
-		e.logger.Error("Failed to update stream status in database",
+	// Resolve the stream's encoding profile before anything is started
+	profile, ladder, err := e.resolveEncoding(liveStream)
+	if err != nil {
+		e.logger.Error("Invalid encoding settings for stream",
 			zap.String("stream_key", streamKey),
 			zap.Error(err),
 		)
 		return err
 	}
 
-	// Create output directory
-	streamOutputDir := filepath.Join(e.outputDir, streamKey)
-	if err := os.MkdirAll(streamOutputDir, 0o755); err != nil {
-		e.logger.Error("Failed to create output directory",
+	e.logger.Info("Starting encoding for stream", zap.String("stream_key", streamKey))
+
+	// Update database status
+	if err := e.streamRepo.StartStream(streamKey, e.instanceID); err != nil {
+		e.logger.Error("Failed to update stream status in database",
 			zap.String("stream_key", streamKey),
 			zap.Error(err),
 		)
@@ -80,162 +136,434 @@ func (e *EncoderService) StartEncoding(streamKey string) error {
 	// RTMP input URL
 	rtmpURL := fmt.Sprintf("rtmp://%s:%s/live/%s", e.rtmpServer, e.rtmpPort, streamKey)
 
-	// HLS output files
-	playlistFile := filepath.Join(streamOutputDir, "playlist.m3u8")
-	segmentPattern := filepath.Join(streamOutputDir, "segment_%03d.ts")
+	// Archive the broadcast if the stream has recording enabled
+	var recording *models.Recording
+	if liveStream.RecordingEnabled {
+		recording, err = e.recordingRepo.CreateRecording(
+			liveStream.ID,
+			streamKey,
+			liveStream.PlaybackID,
+		)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Create context for this stream
 	streamCtx, cancel := context.WithCancel(context.Background())
 
-	// FFmpeg command for HLS encoding
-	cmd := exec.CommandContext(streamCtx, "ffmpeg",
-		"-i", rtmpURL,
-		"-c:v", "libx264",
-		"-preset", "ultrafast",
-		"-tune", "zerolatency",
-		"-c:a", "aac",
-		"-b:a", "128k",
-		"-f", "hls",
-		"-hls_time", "3",
-		"-hls_list_size", "60",
-		"-hls_flags", "delete_segments",
-		"-hls_segment_filename", segmentPattern,
-		playlistFile,
-	)
-
-	// Set up logging
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
 	// Create stream encoder
 	streamEncoder := &models.StreamEncoder{
-		StreamKey: streamKey,
-		Cmd:       cmd,
-		Ctx:       streamCtx,
-		Cancel:    cancel,
-		Logger:    e.logger,
+		StreamKey:      streamKey,
+		LiveStreamID:   liveStream.ID,
+		PlaybackID:     liveStream.PlaybackID,
+		OrganizationID: liveStream.OrganizationID,
+		StoragePrefix:  liveStream.StoragePrefix,
+		Ctx:            streamCtx,
+		Cancel:         cancel,
+		Logger:         e.logger,
+		Recording:      recording,
+		Encrypted:      liveStream.EncryptionEnabled,
+		KeyRotation:    time.Duration(liveStream.KeyRotationSeconds) * time.Second,
+		Logs:           models.NewLogBuffer(ffmpegLogLines),
 	}
 
-	// Add to active processes
-	e.activeProcesses[streamKey] = streamEncoder
+	// Each publish is encoded to its own directory, so a republish never
+	// touches the output of a previous publish that is still being finished
+	publishedAt := time.Now()
+	streamOutputDir := filepath.Join(e.outputDir, streamKey, strconv.FormatInt(publishedAt.UnixNano(), 10))
+
+	// HLS output has a directory per rendition; CMAF output is written flat.
+	// Directories of renditions taller than the input are removed once it
+	// has been probed, before FFmpeg starts.
+	var renditionDirs []string
+	if profile.Packaging != models.PackagingCMAF {
+		for _, rendition := range ladder {
+			renditionDirs = append(renditionDirs, filepath.Join(streamOutputDir, rendition.Name))
+		}
+	}
+
+	if err := prepareOutputDirs(streamOutputDir, renditionDirs); err != nil {
+		e.logger.Error("Failed to create output directories",
+			zap.String("stream_key", streamKey),
+			zap.Error(err),
+		)
+		e.abortEncoding(streamEncoder, nil, err)
+		return err
+	}
+
+	// Encrypted streams get their first key before FFmpeg starts
+	var rotator *keyRotator
+	var keyInfoPath string
+	if streamEncoder.Encrypted {
+		rotator = e.newKeyRotator(streamEncoder, streamOutputDir)
+		if err := rotator.rotate(); err != nil {
+			e.logger.Error("Failed to issue stream encryption key",
+				zap.String("stream_key", streamKey),
+				zap.Error(err),
+			)
+			e.abortEncoding(streamEncoder, rotator, err)
+			return err
+		}
+		keyInfoPath = rotator.infoPath()
+	}
+
+	// FFmpeg arguments for adaptive bitrate encoding, built for every process.
+	// Numbering segments from the publish time keeps their names unique
+	// across publishes, so they can be cached as immutable; a restarted HLS
+	// process continues the numbering. The DASH muxer cannot continue an
+	// earlier process's output, so with CMAF packaging each process numbers
+	// from its own start. ladder only changes in the supervising goroutine,
+	// when it is fitted to the probed input before the first process.
+	ffmpegArgs := func() []string {
+		startNumber := publishedAt.Unix()
+		if profile.Packaging == models.PackagingCMAF {
+			startNumber = time.Now().Unix()
+		}
+		return buildFFmpegArgs(rtmpURL, streamOutputDir, profile, ladder,
+			startNumber, streamEncoder.Recording != nil, keyInfoPath)
+	}
 
-	e.logger.Info("Started encoding process",
+	e.logger.Info("Starting encoding process",
 		zap.String("stream_key", streamKey),
 		zap.String("rtmp_url", rtmpURL),
 		zap.String("output_dir", streamOutputDir),
+		zap.String("profile", profile.Name),
+		zap.String("packaging", profile.Packaging),
+		zap.Bool("low_latency", profile.LowLatency),
+		zap.Int("renditions", len(ladder)),
+		zap.Bool("recording", streamEncoder.Recording != nil),
+		zap.Bool("encrypted", streamEncoder.Encrypted),
 	)
 
-	// Start the process
-	if err := cmd.Start(); err != nil {
-		e.logger.Error("Failed to start FFmpeg",
-			zap.String("stream_key", streamKey),
-			zap.Error(err),
-		)
-		delete(e.activeProcesses, streamKey)
-		return err
+	// A missing session record must not interrupt the broadcast
+	if session, err := e.sessionRepo.CreateSession(liveStream.ID, e.instanceID); err == nil {
+		streamEncoder.Session = session
+	}
+
+	// Add to active processes
+	e.activeProcesses[streamKey] = streamEncoder
+	streamEncoder.VideoPlaylist = tallestVideoPlaylist(streamOutputDir, profile, ladder)
+	if rotator != nil {
+		e.keyRotators[streamEncoder] = rotator
+		if streamEncoder.KeyRotation > 0 {
+			go rotator.run(streamEncoder.Ctx, streamEncoder.KeyRotation)
+		}
 	}
 
-	// Start file upload monitoring in separate goroutine
-	go e.monitorAndUploadFiles(streamKey, streamOutputDir)
+	// Low-latency playlists and parts are served from the local output
+	if profile.LowLatency {
+		e.lowLatencyOutputs[streamEncoder] = newLLHLSOutput(streamOutputDir, profile.SegmentDuration)
+	}
 
-	// Monitor process completion in separate goroutine
-	go func() {
-		if err := cmd.Wait(); err != nil {
-			e.logger.Error("FFmpeg process failed",
+	e.webhookService.Emit(streamEncoder.OrganizationID, models.WebhookEventStreamStarted,
+		streamEncoder.EventData(""))
+
+	// Thumbnails would publish encrypted streams' frames in the clear
+	if streamEncoder.VideoPlaylist != "" && e.storage != nil && e.thumbnailInterval > 0 &&
+		!streamEncoder.Encrypted {
+		go e.captureThumbnails(streamEncoder, streamOutputDir, e.thumbnailInterval)
+	}
+
+	// Upload segments to the tenant's storage prefix as FFmpeg completes them
+	var uploader *segmentUploader
+	if e.storage != nil {
+		keyPrefix := StreamFilesPrefix(streamEncoder.StoragePrefix, streamEncoder.PlaybackID)
+		uploader = newSegmentUploader(e.logger, e.storage,
+			streamKey, keyPrefix, streamOutputDir, renditionDirs)
+		if err := uploader.Start(); err != nil {
+			e.logger.Error("Failed to start segment upload",
 				zap.String("stream_key", streamKey),
 				zap.Error(err),
 			)
-		} else {
-			e.logger.Info("FFmpeg process completed",
-				zap.String("stream_key", streamKey),
+			uploader = nil
+		}
+	}
+
+	// The publisher sends nothing until this publish callback returns, so the
+	// input is probed, and FFmpeg started, in the background. FFmpeg starts
+	// with the ladder fitted to the input as soon as its streams are known,
+	// so no rendition is ever replaced mid-stream; the probe goes on to
+	// measure the keyframe interval.
+	inputStreams := make(chan *models.InputProbe, 1)
+	go e.probeStreamInput(streamEncoder, rtmpURL, inputStreams)
+	go func() {
+		fitted := fitLadderToInput(streamEncoder, inputStreams, ladder)
+		if !slices.Equal(fitted, ladder) {
+			removeUnfittedDirs(streamOutputDir, profile, ladder, fitted)
+			ladder = fitted
+
+			e.mu.Lock()
+			streamEncoder.VideoPlaylist = tallestVideoPlaylist(streamOutputDir, profile, fitted)
+			e.mu.Unlock()
+		}
+
+		e.superviseEncoding(streamEncoder, ffmpegArgs, streamOutputDir, uploader)
+	}()
+
+	return nil
+}
+
+// abortEncoding cleans up after a publish whose encoding could not be
+// started. The stream has not been added to the active set yet.
+func (e *EncoderService) abortEncoding(
+	streamEncoder *models.StreamEncoder,
+	rotator *keyRotator,
+	err error,
+) {
+	if rotator != nil {
+		rotator.stop()
+	}
+	streamEncoder.Cancel()
+	streamEncoder.Logs.Close()
+
+	if recording := streamEncoder.Recording; recording != nil {
+		recording.Status = models.RecordingStatusFailed
+		if err := e.recordingRepo.FinishRecording(recording); err != nil {
+			e.logger.Error("Failed to update recording in database",
+				zap.Int64("recording_id", recording.ID),
+				zap.Error(err),
 			)
 		}
+	}
 
-		// Remove from active processes and update database
-		e.mu.Lock()
-		delete(e.activeProcesses, streamKey)
-		e.mu.Unlock()
+	if err := e.streamRepo.MarkStreamError(streamEncoder.StreamKey, err.Error()); err != nil {
+		e.logger.Error("Failed to update stream status in database",
+			zap.String("stream_key", streamEncoder.StreamKey),
+			zap.Error(err),
+		)
+	}
+}
 
-		// Update database status
-		if err := e.streamRepo.StopStream(streamKey); err != nil {
-			e.logger.Error("Failed to update stream status in database",
+// tallestVideoPlaylist returns the media playlist of a ladder's tallest video
+// rendition, which snapshots and sprites are taken from, or "" for audio-only
+// ladders
+func tallestVideoPlaylist(outputDir string, profile *models.EncodingProfile, ladder []models.Rendition) string {
+	var videoPlaylist string
+	tallest, videoIndex := 0, 0
+	for _, rendition := range ladder {
+		if rendition.IsAudioOnly() {
+			continue
+		}
+		if rendition.Height > tallest {
+			tallest = rendition.Height
+			videoPlaylist = videoPlaylistPath(outputDir, profile, rendition, videoIndex)
+		}
+		videoIndex++
+	}
+	return videoPlaylist
+}
+
+// removeUnfittedDirs removes the directories of the HLS renditions a fitted
+// ladder drops, before FFmpeg has written to them. CMAF output has no
+// rendition directories.
+func removeUnfittedDirs(
+	outputDir string,
+	profile *models.EncodingProfile,
+	ladder, fitted []models.Rendition,
+) {
+	if profile.Packaging == models.PackagingCMAF {
+		return
+	}
+
+	kept := make(map[string]bool, len(fitted))
+	for _, rendition := range fitted {
+		kept[rendition.Name] = true
+	}
+	for _, rendition := range ladder {
+		if !kept[rendition.Name] {
+			os.RemoveAll(filepath.Join(outputDir, rendition.Name))
+		}
+	}
+}
+
+// fitLadderToInput waits for the probed streams of a stream's input and
+// returns ladder without the renditions taller than its video. The full
+// ladder is returned if the streams could not be probed within
+// inputStreamsTimeout, or if the stream is stopped meanwhile.
+func fitLadderToInput(
+	streamEncoder *models.StreamEncoder,
+	inputStreams <-chan *models.InputProbe,
+	ladder []models.Rendition,
+) []models.Rendition {
+	timer := time.NewTimer(inputStreamsTimeout)
+	defer timer.Stop()
+
+	select {
+	case streams := <-inputStreams:
+		if streams != nil {
+			return models.FitLadder(ladder, streams.Height)
+		}
+	case <-timer.C:
+		streamEncoder.Logs.Append(fmt.Sprintf(
+			"streamkit: input streams not probed within %s, encoding the full ladder", inputStreamsTimeout))
+	case <-streamEncoder.Ctx.Done():
+	}
+	return ladder
+}
+
+// probeStreamInput probes a stream's input and stores the result on its
+// session. Warnings go to the stream's log. The description of the input's
+// streams is sent on inputStreams as soon as it is known, or nil if the
+// input could not be probed; exactly one value is sent.
+func (e *EncoderService) probeStreamInput(
+	streamEncoder *models.StreamEncoder,
+	rtmpURL string,
+	inputStreams chan<- *models.InputProbe,
+) {
+	var sendStreams sync.Once
+	onStreams := func(streams *models.InputProbe) {
+		sendStreams.Do(func() { inputStreams <- streams })
+	}
+	defer onStreams(nil)
+
+	streamKey := streamEncoder.StreamKey
+
+	probe, err := probeInput(streamEncoder.Ctx, rtmpURL, onStreams)
+	if err != nil {
+		if streamEncoder.Ctx.Err() == nil {
+			e.logger.Warn("Failed to probe stream input",
 				zap.String("stream_key", streamKey),
 				zap.Error(err),
 			)
+			streamEncoder.Logs.Append(fmt.Sprintf("streamkit: failed to probe input: %v", err))
 		}
+		return
+	}
 
-		// Clean up storage files
-		if e.storageService != nil {
-			if err := e.storageService.DeleteStreamFiles(streamKey); err != nil {
-				e.logger.Error("Failed to delete stream files from storage",
-					zap.String("stream_key", streamKey),
-					zap.Error(err),
-				)
-			}
+	e.logger.Info("Probed stream input",
+		zap.String("stream_key", streamKey),
+		zap.String("video_codec", probe.VideoCodec),
+		zap.Int("width", probe.Width),
+		zap.Int("height", probe.Height),
+		zap.Float64("frame_rate", probe.FrameRate),
+		zap.Float64("keyframe_interval", probe.KeyframeInterval),
+		zap.String("audio_codec", probe.AudioCodec),
+		zap.Strings("warnings", probe.Warnings),
+	)
+	for _, warning := range probe.Warnings {
+		streamEncoder.Logs.Append("streamkit: warning: " + warning)
+	}
+
+	if streamEncoder.Session != nil {
+		streamEncoder.Session.Input = probe
+		e.sessionRepo.SetInputProbe(streamEncoder.Session.ID, probe)
+	}
+}
+
+// prepareOutputDirs creates a publish's output directory and its rendition
+// directories
+func prepareOutputDirs(outputDir string, renditionDirs []string) error {
+	for _, dir := range append([]string{outputDir}, renditionDirs...) {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
 		}
-	}()
+	}
+	return nil
+}
 
+// RemoveStaleOutput deletes the output directories left by publishes that
+// were being encoded when the service last stopped. It is called at startup,
+// before any publish is accepted; the output directory belongs to this
+// instance alone.
+func (e *EncoderService) RemoveStaleOutput() error {
+	entries, err := os.ReadDir(e.outputDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(e.outputDir, entry.Name())); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// monitorAndUploadFiles monitors HLS files and uploads them to storage
-func (e *EncoderService) monitorAndUploadFiles(streamKey, outputDir string) {
-	// Wait a bit for FFmpeg to create the first files
-	time.Sleep(3 * time.Second)
-
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	// Create a context for this monitoring goroutine
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	for {
-		select {
-		case <-ticker.C:
-			// Check if process is still active
-			e.mu.RLock()
-			_, exists := e.activeProcesses[streamKey]
-			e.mu.RUnlock()
-
-			if !exists {
-				e.logger.Info("Stream process stopped, ending file upload monitoring",
-					zap.String("stream_key", streamKey))
-				return // Process stopped
-			}
-
-			// Upload files to storage
-			if e.storageService != nil {
-				if err := e.storageService.UploadHLSFiles(streamKey, outputDir); err != nil {
-					e.logger.Error("Failed to upload HLS files",
-						zap.String("stream_key", streamKey),
-						zap.Error(err),
-					)
-				}
-			}
-		case <-ctx.Done():
-			e.logger.Info("File upload monitoring cancelled",
-				zap.String("stream_key", streamKey))
-			return
+// authorizeStreamKey checks a stream key against the API's live_streams table
+func (e *EncoderService) authorizeStreamKey(streamKey string) (*models.LiveStream, error) {
+	liveStream, err := e.streamRepo.GetLiveStreamByKey(streamKey)
+	if err != nil {
+		e.logger.Error("Failed to look up stream key",
+			zap.String("stream_key", streamKey),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if liveStream == nil {
+		e.logger.Warn("Rejecting publish for unknown stream key",
+			zap.String("stream_key", streamKey),
+		)
+		return nil, fmt.Errorf("%w: unknown stream key", ErrStreamKeyRejected)
+	}
+
+	if liveStream.Status == models.LiveStreamStatusDisabled {
+		e.logger.Warn("Rejecting publish for disabled stream key",
+			zap.String("stream_key", streamKey),
+			zap.Int("live_stream_id", liveStream.ID),
+		)
+		return nil, fmt.Errorf("%w: stream is disabled", ErrStreamKeyRejected)
+	}
+
+	return liveStream, nil
+}
+
+// resolveEncoding returns the encoding profile and rendition ladder for a
+// stream, falling back to the service defaults when no profile is set
+func (e *EncoderService) resolveEncoding(
+	liveStream *models.LiveStream,
+) (*models.EncodingProfile, []models.Rendition, error) {
+	profile := models.DefaultEncodingProfile()
+
+	if liveStream.EncodingProfileID != nil {
+		stored, err := e.streamRepo.GetEncodingProfile(*liveStream.EncodingProfileID,
+			liveStream.OrganizationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if stored == nil {
+			return nil, nil, fmt.Errorf("encoding profile %d not found", *liveStream.EncodingProfileID)
+		}
+		profile = stored
+	}
+
+	if err := profile.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	// Encrypted streams are never encoded in the clear
+	if liveStream.EncryptionEnabled {
+		if e.keyring == nil {
+			return nil, nil, fmt.Errorf("stream is encrypted but HLS_KEY_ENCRYPTION_KEY is not set")
+		}
+		if profile.Packaging != models.PackagingHLS {
+			return nil, nil, fmt.Errorf("profile %q: encryption requires hls packaging", profile.Name)
 		}
 	}
+
+	if len(profile.Renditions) == 0 {
+		return profile, e.ladder, nil
+	}
+
+	ladder, err := models.ParseLadder(strings.Join(profile.Renditions, ","))
+	if err != nil {
+		return nil, nil, fmt.Errorf("profile %q: %w", profile.Name, err)
+	}
+
+	return profile, ladder, nil
 }
 
 // StopEncoding stops encoding for a specific stream
 func (e *EncoderService) StopEncoding(streamKey string) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	if streamEncoder, exists := e.activeProcesses[streamKey]; exists {
-		e.logger.Info("Stopping encoding for stream", zap.String("stream_key", streamKey))
-		streamEncoder.Cancel() // This will kill the FFmpeg process
-		delete(e.activeProcesses, streamKey)
-	} else {
+	if !e.cancelEncoding(streamKey, "") {
 		e.logger.Info("No active encoding found for stream", zap.String("stream_key", streamKey))
 	}
 
 	// Update database status
-	if err := e.streamRepo.StopStream(streamKey); err != nil {
+	if err := e.streamRepo.StopStream(streamKey, string(models.SessionEndPublisherLeft)); err != nil {
 		e.logger.Error("Failed to update stream status in database",
 			zap.String("stream_key", streamKey),
 			zap.Error(err),
@@ -243,6 +571,49 @@ func (e *EncoderService) StopEncoding(streamKey string) {
 	}
 }
 
+// KillEncoding stops encoding a stream on an operator's request and
+// disconnects its publisher. The stream's status is updated, and its session
+// closed with the admin_kill reason, once its FFmpeg process has exited.
+func (e *EncoderService) KillEncoding(streamKey string) error {
+	if !e.cancelEncoding(streamKey, models.SessionEndAdminKill) {
+		return ErrStreamNotActive
+	}
+
+	// Otherwise the publisher keeps sending to the RTMP server with nothing
+	// encoding it; its unpublish callback then finds no active stream
+	if err := e.dropPublisher(streamKey); err != nil {
+		e.logger.Error("Failed to drop publisher",
+			zap.String("stream_key", streamKey),
+			zap.Error(err),
+		)
+	}
+	return nil
+}
+
+// cancelEncoding kills a stream's FFmpeg process and removes it from the
+// active set, recording endReason for its session if set. It reports whether
+// the stream was being encoded.
+func (e *EncoderService) cancelEncoding(streamKey string, endReason models.SessionEndReason) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	streamEncoder, exists := e.activeProcesses[streamKey]
+	if !exists {
+		return false
+	}
+
+	e.logger.Info("Stopping encoding for stream",
+		zap.String("stream_key", streamKey),
+		zap.String("end_reason", string(endReason)),
+	)
+	streamEncoder.EndReason = endReason
+	streamEncoder.Cancel() // This will kill the FFmpeg process
+	delete(e.activeProcesses, streamKey)
+	e.webhookService.Emit(streamEncoder.OrganizationID, models.WebhookEventStreamEnded,
+		streamEncoder.EventData(""))
+	return true
+}
+
 // GetActiveStreamsCount returns the number of active encoding streams
 func (e *EncoderService) GetActiveStreamsCount() int {
 	e.mu.RLock()
@@ -250,12 +621,87 @@ func (e *EncoderService) GetActiveStreamsCount() int {
 	return len(e.activeProcesses)
 }
 
-// GetActiveStreams returns a list of active stream keys from database
+// GetActiveStreams returns a list of active stream keys from database, with
+// the latest FFmpeg progress of those encoded by this instance
 func (e *EncoderService) GetActiveStreams() ([]*models.Stream, error) {
-	return e.streamRepo.GetActiveStreams()
+	streams, err := e.streamRepo.GetActiveStreams()
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, stream := range streams {
+		if encoder, exists := e.activeProcesses[stream.StreamKey]; exists {
+			stream.Progress = encoder.Progress.Load()
+		}
+	}
+
+	return streams, nil
 }
 
-// GetStreamStats returns stream statistics from database
+// LowLatencyOutput returns the LL-HLS output of the stream with a playback ID
+// if it is being encoded in low-latency mode by this instance, or nil
+func (e *EncoderService) LowLatencyOutput(playbackID string) *LLHLSOutput {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, encoder := range e.activeProcesses {
+		if encoder.PlaybackID == playbackID {
+			return e.lowLatencyOutputs[encoder]
+		}
+	}
+	return nil
+}
+
+// StreamLogs returns the FFmpeg log of a stream encoded by this instance, or
+// nil if it is not being encoded here
+func (e *EncoderService) StreamLogs(streamKey string) *models.LogBuffer {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if encoder, exists := e.activeProcesses[streamKey]; exists {
+		return encoder.Logs
+	}
+	return nil
+}
+
+// GetEndedSession returns an ended session of a stream with its FFmpeg log:
+// the one with sessionID, or the latest when sessionID is 0. It returns nil
+// if there is none.
+func (e *EncoderService) GetEndedSession(streamKey string, sessionID int64) (*models.StreamSession, error) {
+	return e.sessionRepo.GetEndedSession(streamKey, sessionID)
+}
+
+// GetStream returns the encoder state of the stream with a playback ID,
+// including restart tracking, or nil if its key has never been published
+func (e *EncoderService) GetStream(playbackID string) (*models.Stream, error) {
+	return e.streamRepo.GetStreamByPlaybackID(playbackID)
+}
+
+// GetStreamStats returns stream statistics from database, broken down by
+// organization, with the streams each organization is encoding here
 func (e *EncoderService) GetStreamStats() (*models.StreamStats, error) {
-	return e.streamRepo.GetStreamStats()
+	stats, err := e.streamRepo.GetStreamStats()
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Tenants, err = e.streamRepo.GetTenantStats()
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	encoding := make(map[int]int)
+	for _, encoder := range e.activeProcesses {
+		encoding[encoder.OrganizationID]++
+	}
+	e.mu.RUnlock()
+
+	for _, tenant := range stats.Tenants {
+		tenant.EncodingStreams = encoding[tenant.OrganizationID]
+	}
+
+	return stats, nil
 }
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+	"streamkit/internal/encoder-service/repos"
+	"streamkit/internal/shared/keyseal"
+)
+
+const (
+	// keyDirName is the directory of a stream's output directory holding its
+	// plaintext keys while it is encoded. Nothing in it is uploaded.
+	keyDirName = "keys"
+
+	// keyInfoFileName is the FFmpeg key info file in the key directory: the
+	// key URI for playlists and the key file's path. With periodic_rekey
+	// FFmpeg reads it again for every segment.
+	keyInfoFileName = "keyinfo"
+
+	// contentKeySize is the size of an AES-128 key
+	contentKeySize = 16
+
+	// keyURILifetime is how long the signed key URIs of a served playlist
+	// can be fetched at most, long enough to play a recording through from
+	// one load of its playlist. They never outlive the viewer's playback
+	// token.
+	keyURILifetime = 4 * time.Hour
+)
+
+// ErrPlaybackTokenRequired is returned when an encrypted playlist is
+// requested without a valid playback token for its playback ID
+var ErrPlaybackTokenRequired = errors.New("a valid playback token is required")
+
+// keyRotator issues the AES-128 keys of a stream being encoded. Each key is
+// stored sealed through the key repository, and written in plaintext to the
+// key directory where FFmpeg reads it through the key info file.
+type keyRotator struct {
+	logger       *zap.Logger
+	keyRepo      *repos.KeyRepo
+	keyring      *keyseal.Keyring
+	instanceID   string
+	streamKey    string
+	liveStreamID int
+	dir          string
+	// keyURL is the URL of the stream's keys in the API, which key IDs are
+	// appended to. Playlists are stored with unsigned key URIs; they are
+	// signed whenever a playlist is served.
+	keyURL string
+	// recordingID is the ID of the recording the keys belong to, or 0 if
+	// the publish is not recorded
+	recordingID int64
+	// keyIDs are the IDs of the keys issued, deleted when encoding ends if
+	// no recording needs them
+	keyIDs []int64
+
+	done chan struct{}
+}
+
+// newKeyRotator creates the key rotator of a stream encoded to outputDir
+func (e *EncoderService) newKeyRotator(encoder *models.StreamEncoder, outputDir string) *keyRotator {
+	rotator := &keyRotator{
+		logger:       e.logger,
+		keyRepo:      e.keyRepo,
+		keyring:      e.keyring,
+		instanceID:   e.instanceID,
+		streamKey:    encoder.StreamKey,
+		liveStreamID: encoder.LiveStreamID,
+		dir:          filepath.Join(outputDir, keyDirName),
+		keyURL:       fmt.Sprintf("%s/keys/%s", e.keyBaseURL, encoder.PlaybackID),
+		done:         make(chan struct{}),
+	}
+	if encoder.Recording != nil {
+		rotator.recordingID = encoder.Recording.ID
+	}
+	return rotator
+}
+
+// infoPath returns the path of the key info file FFmpeg is given
+func (k *keyRotator) infoPath() string {
+	return filepath.Join(k.dir, keyInfoFileName)
+}
+
+// rotate issues a new key. FFmpeg encrypts segments it starts after the key
+// info file is replaced with it.
+func (k *keyRotator) rotate() error {
+	if err := os.MkdirAll(k.dir, 0o700); err != nil {
+		return err
+	}
+
+	key := make([]byte, contentKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	sealed, err := k.keyring.Seal(k.liveStreamID, key)
+	if err != nil {
+		return err
+	}
+	id, err := k.keyRepo.CreateKey(k.liveStreamID, k.recordingID, k.instanceID, sealed)
+	if err != nil {
+		return err
+	}
+	k.keyIDs = append(k.keyIDs, id)
+
+	keyPath := filepath.Join(k.dir, fmt.Sprintf("%d.key", id))
+	if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+		return err
+	}
+
+	// FFmpeg may read the key info file at any time, so replace it whole
+	info := fmt.Sprintf("%s/%d\n%s\n", k.keyURL, id, keyPath)
+	tmpPath := k.infoPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(info), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, k.infoPath()); err != nil {
+		return err
+	}
+
+	k.logger.Info("Issued stream encryption key",
+		zap.String("stream_key", k.streamKey),
+		zap.Int64("key_id", id),
+	)
+	return nil
+}
+
+// run issues a new key every interval until the rotator is stopped. A failed
+// rotation keeps the current key.
+func (k *keyRotator) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		case <-k.done:
+			return
+		}
+
+		if err := k.rotate(); err != nil {
+			k.logger.Error("Failed to rotate stream encryption key",
+				zap.String("stream_key", k.streamKey),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// stop ends rotation and removes the plaintext keys from disk. The stored
+// keys of a publish that is not recorded are deleted too, since its segments
+// are deleted from storage when encoding ends; a recording's keys are
+// deleted with it. FFmpeg must have exited.
+func (k *keyRotator) stop() {
+	close(k.done)
+	if err := os.RemoveAll(k.dir); err != nil {
+		k.logger.Error("Failed to remove stream encryption keys",
+			zap.String("stream_key", k.streamKey),
+			zap.Error(err),
+		)
+	}
+	if k.recordingID == 0 && len(k.keyIDs) > 0 {
+		if err := k.keyRepo.DeleteKeys(k.keyIDs); err != nil {
+			k.logger.Error("Failed to delete stored stream encryption keys",
+				zap.String("stream_key", k.streamKey),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// SignKeyURIs returns a media playlist of a playback ID with the key URI of
+// each of its EXT-X-KEY tags signed, so players can fetch the keys from the
+// API for keyURILifetime, or until token expires if it is sooner. token is
+// the viewer's playback token issued by the API; without a valid one the
+// keys of an encrypted playlist are not signed and ErrPlaybackTokenRequired
+// is returned. It reports whether any URI was signed; playlists without
+// keys, or served when encryption is not configured, are returned as they
+// are.
+func (e *EncoderService) SignKeyURIs(playlist []byte, playbackID, token string) ([]byte, bool, error) {
+	if e.keyring == nil || !bytes.Contains(playlist, []byte("#EXT-X-KEY:")) {
+		return playlist, false, nil
+	}
+
+	now := time.Now()
+	tokenExpires, err := e.keyring.VerifyPlaybackToken(playbackID, token, now)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrPlaybackTokenRequired, err)
+	}
+	expires := now.Add(keyURILifetime)
+	if tokenExpires.Before(expires) {
+		expires = tokenExpires
+	}
+	query := e.keyring.SignKeyURI(playbackID, expires).Encode()
+
+	lines := strings.Split(string(playlist), "\n")
+	signed := false
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "#EXT-X-KEY:") {
+			continue
+		}
+		uri := playlistAttribute(line, "URI")
+		if uri == "" {
+			continue
+		}
+		separator := "?"
+		if strings.Contains(uri, "?") {
+			separator = "&"
+		}
+		lines[i] = strings.Replace(line, `URI="`+uri+`"`, `URI="`+uri+separator+query+`"`, 1)
+		signed = true
+	}
+
+	return []byte(strings.Join(lines, "\n")), signed, nil
+}
+
+// AddPlaybackToken returns a master playlist with a viewer's playback token
+// added to the URI of each of its media playlists, which players resolve
+// without the master playlist's query. Media playlists are returned as they
+// are.
+func AddPlaybackToken(playlist []byte, token string) []byte {
+	if token == "" || !bytes.Contains(playlist, []byte("#EXT-X-STREAM-INF:")) {
+		return playlist
+	}
+
+	query := url.Values{"token": {token}}.Encode()
+	withToken := func(uri string) string {
+		if strings.Contains(uri, "?") {
+			return uri + "&" + query
+		}
+		return uri + "?" + query
+	}
+
+	lines := strings.Split(string(playlist), "\n")
+	for i, line := range lines {
+		switch {
+		case line == "":
+		case !strings.HasPrefix(line, "#"):
+			lines[i] = withToken(line)
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"), strings.HasPrefix(line, "#EXT-X-I-FRAME-STREAM-INF:"):
+			if uri := playlistAttribute(line, "URI"); uri != "" {
+				lines[i] = strings.Replace(line, `URI="`+uri+`"`, `URI="`+withToken(uri)+`"`, 1)
+			}
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"streamkit/internal/shared/keyseal"
+)
+
+func TestSignKeyURIs(t *testing.T) {
+	keyring, err := keyseal.New(strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &EncoderService{keyring: keyring}
+
+	encrypted := "#EXTM3U\n" +
+		`#EXT-X-KEY:METHOD=AES-128,URI="http://localhost:8080/keys/abc123/1",IV=0x01` + "\n" +
+		"#EXTINF:2.000,\nsegment_1.ts\n" +
+		`#EXT-X-KEY:METHOD=AES-128,URI="http://localhost:8080/keys/abc123/2?v=1"` + "\n" +
+		"#EXTINF:2.000,\nsegment_2.ts\n"
+	token := keyring.SignPlaybackToken("abc123", time.Now().Add(24*time.Hour))
+	shortToken := keyring.SignPlaybackToken("abc123", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name       string
+		playlist   string
+		token      string
+		wantSigned bool
+		wantErr    error
+		// wantExpiry is how long after now the signed URIs expire at most
+		wantExpiry time.Duration
+	}{
+		{
+			name:       "key tags",
+			playlist:   encrypted,
+			token:      token,
+			wantSigned: true,
+			wantExpiry: keyURILifetime,
+		},
+		{
+			name:       "token expiring first",
+			playlist:   encrypted,
+			token:      shortToken,
+			wantSigned: true,
+			wantExpiry: time.Hour,
+		},
+		{
+			name:     "no token",
+			playlist: encrypted,
+			wantErr:  ErrPlaybackTokenRequired,
+		},
+		{
+			name:     "token of another playback ID",
+			playlist: encrypted,
+			token:    keyring.SignPlaybackToken("abc124", time.Now().Add(time.Hour)),
+			wantErr:  ErrPlaybackTokenRequired,
+		},
+		{
+			name:     "no keys",
+			playlist: "#EXTM3U\n#EXTINF:2.000,\nsegment_1.ts\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, signed, err := service.SignKeyURIs([]byte(tt.playlist), "abc123", tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SignKeyURIs() error = %v, want %v", err, tt.wantErr)
+			}
+			if signed != tt.wantSigned {
+				t.Fatalf("SignKeyURIs() signed = %v, want %v", signed, tt.wantSigned)
+			}
+			if err != nil {
+				return
+			}
+			if !signed {
+				if string(got) != tt.playlist {
+					t.Errorf("SignKeyURIs() changed an unsigned playlist:\n%s", got)
+				}
+				return
+			}
+
+			var keys int
+			for _, line := range strings.Split(string(got), "\n") {
+				if !strings.HasPrefix(line, "#EXT-X-KEY:") {
+					continue
+				}
+				keys++
+				uri, err := url.Parse(playlistAttribute(line, "URI"))
+				if err != nil {
+					t.Fatalf("signed URI does not parse: %v", err)
+				}
+				if err := keyring.VerifyKeyURI("abc123", uri.Query(), time.Now()); err != nil {
+					t.Errorf("VerifyKeyURI(%q) error = %v", uri, err)
+				}
+				if err := keyring.VerifyKeyURI("abc123", uri.Query(), time.Now().Add(tt.wantExpiry)); err == nil {
+					t.Errorf("signed URI %q is still valid after %v", uri, tt.wantExpiry)
+				}
+			}
+			if keys != 2 {
+				t.Errorf("signed playlist has %d key tags, want 2", keys)
+			}
+		})
+	}
+
+	// Without a keyring playlists are served as they are
+	unsigned := &EncoderService{}
+	if _, signed, err := unsigned.SignKeyURIs([]byte(encrypted), "abc123", ""); signed || err != nil {
+		t.Errorf("SignKeyURIs() without a keyring = %v, %v, want unsigned", signed, err)
+	}
+}
+
+func TestAddPlaybackToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		token    string
+		want     string
+	}{
+		{
+			name: "master playlist",
+			playlist: "#EXTM3U\n" +
+				`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="audio",URI="audio/playlist.m3u8"` + "\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720\n720p/playlist.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n360p/playlist.m3u8?v=1\n",
+			token: "1700000000.ab",
+			want: "#EXTM3U\n" +
+				`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="audio",URI="audio/playlist.m3u8?token=1700000000.ab"` + "\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720\n720p/playlist.m3u8?token=1700000000.ab\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n360p/playlist.m3u8?v=1&token=1700000000.ab\n",
+		},
+		{
+			name:     "media playlist",
+			playlist: "#EXTM3U\n#EXTINF:2.000,\nsegment_1.ts\n",
+			token:    "1700000000.ab",
+			want:     "#EXTM3U\n#EXTINF:2.000,\nsegment_1.ts\n",
+		},
+		{
+			name:     "no token",
+			playlist: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\n360p/playlist.m3u8\n",
+			want:     "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\n360p/playlist.m3u8\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(AddPlaybackToken([]byte(tt.playlist), tt.token)); got != tt.want {
+				t.Errorf("AddPlaybackToken() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
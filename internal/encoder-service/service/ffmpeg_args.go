@@ -0,0 +1,273 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+const (
+	// masterPlaylistName is the multivariant playlist written by FFmpeg
+	masterPlaylistName = "master.m3u8"
+
+	// mediaPlaylistName is the per-rendition playlist name
+	mediaPlaylistName = "playlist.m3u8"
+
+	// dashManifestName is the DASH manifest written with CMAF packaging
+	dashManifestName = "manifest.mpd"
+
+	// cmafPlaylistPattern matches the media playlists FFmpeg's DASH muxer
+	// writes next to its manifest, media_{n}.m3u8 for representation n
+	cmafPlaylistPattern = "media_*.m3u8"
+)
+
+// buildFFmpegArgs builds the FFmpeg arguments that encode an RTMP input into
+// one HLS media playlist per rendition plus a master playlist. Keyframes are
+// forced on every segment boundary so all renditions switch at the same points.
+// When record is set, segments are kept and the playlists list every segment
+// so the broadcast can be turned into a VOD asset afterwards. Segment numbers
+// begin at startNumber, which callers make unique per publish so a segment
+// name is never reused for different content. With CMAF packaging the output
+// is written by cmafOutputArgs instead.
+// When keyInfoPath is set, segments are encrypted with AES-128 using the key
+// the key info file names, which FFmpeg reads again for every segment so the
+// key can be rotated by replacing the file.
+func buildFFmpegArgs(
+	rtmpURL, outputDir string,
+	profile *models.EncodingProfile,
+	ladder []models.Rendition,
+	startNumber int64,
+	record bool,
+	keyInfoPath string,
+) []string {
+	// FFmpeg writes its progress reports to stdout instead of status lines to
+	// stderr
+	args := []string{"-nostats", "-progress", "pipe:1", "-i", rtmpURL}
+
+	// Split the source video once per video rendition and scale each branch
+	var videoRenditions []models.Rendition
+	for _, rendition := range ladder {
+		if !rendition.IsAudioOnly() {
+			videoRenditions = append(videoRenditions, rendition)
+		}
+	}
+
+	if len(videoRenditions) > 0 {
+		var filters []string
+		split := fmt.Sprintf("[0:v]split=%d", len(videoRenditions))
+		for i := range videoRenditions {
+			split += fmt.Sprintf("[v%d]", i)
+		}
+		filters = append(filters, split)
+		for i, rendition := range videoRenditions {
+			filters = append(filters,
+				fmt.Sprintf("[v%d]scale=-2:%d[v%dout]", i, rendition.Height, i))
+		}
+		args = append(args, "-filter_complex", strings.Join(filters, ";"))
+	}
+
+	if profile.Packaging == models.PackagingCMAF {
+		return append(args, cmafOutputArgs(outputDir, profile, ladder, startNumber, record)...)
+	}
+
+	// Map outputs: video streams first, then one audio stream per rendition
+	var streamMap []string
+	videoIndex := 0
+	for audioIndex, rendition := range ladder {
+		if rendition.IsAudioOnly() {
+			streamMap = append(streamMap,
+				fmt.Sprintf("a:%d,name:%s", audioIndex, rendition.Name))
+		} else {
+			args = append(args, videoOutputArgs(videoIndex, rendition)...)
+			streamMap = append(streamMap,
+				fmt.Sprintf("v:%d,a:%d,name:%s", videoIndex, audioIndex, rendition.Name))
+			videoIndex++
+		}
+	}
+
+	for audioIndex, rendition := range ladder {
+		audioBitrate := rendition.AudioBitrate
+		if profile.AudioBitrate > 0 {
+			audioBitrate = profile.AudioBitrate
+		}
+		args = append(args,
+			"-map", "0:a:0",
+			fmt.Sprintf("-c:a:%d", audioIndex), "aac",
+			fmt.Sprintf("-b:a:%d", audioIndex), fmt.Sprintf("%dk", audioBitrate),
+		)
+	}
+
+	if len(videoRenditions) > 0 {
+		args = append(args, videoEncoderArgs(profile)...)
+	}
+
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%d", profile.SegmentDuration),
+		"-start_number", fmt.Sprintf("%d", startNumber),
+	)
+	// append_list lets a restarted process continue the existing playlists
+	// and segment numbering instead of overwriting them
+	hlsFlags := "independent_segments+append_list"
+	if record {
+		args = append(args, "-hls_playlist_type", "event")
+	} else {
+		args = append(args, "-hls_list_size", fmt.Sprintf("%d", profile.PlaylistSize))
+		hlsFlags = "delete_segments+" + hlsFlags
+	}
+	if keyInfoPath != "" {
+		args = append(args, "-hls_key_info_file", keyInfoPath)
+		hlsFlags += "+periodic_rekey"
+	}
+	args = append(args, "-hls_flags", hlsFlags)
+	args = append(args,
+		"-master_pl_name", masterPlaylistName,
+		"-hls_segment_filename", filepath.Join(outputDir, "%v", "segment_%03d.ts"),
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(outputDir, "%v", mediaPlaylistName),
+	)
+
+	return args
+}
+
+// cmafOutputArgs returns the output arguments for CMAF packaging. FFmpeg's
+// DASH muxer writes fMP4 segments and a DASH manifest, plus an HLS media
+// playlist per representation and a master playlist that reference the same
+// segments. The video renditions share a single audio representation, which
+// also stands in for audio-only renditions. The DASH muxer numbers segments
+// from 1 and cannot continue an earlier process's manifest, so startNumber,
+// which callers make unique per process, prefixes the segment names instead.
+func cmafOutputArgs(
+	outputDir string,
+	profile *models.EncodingProfile,
+	ladder []models.Rendition,
+	startNumber int64,
+	record bool,
+) []string {
+	var args []string
+
+	videoIndex := 0
+	audioBitrate := 0
+	for _, rendition := range ladder {
+		audioBitrate = max(audioBitrate, rendition.AudioBitrate)
+		if rendition.IsAudioOnly() {
+			continue
+		}
+		args = append(args, videoOutputArgs(videoIndex, rendition)...)
+		videoIndex++
+	}
+
+	// The shared audio gets the ladder's highest audio bitrate
+	if profile.AudioBitrate > 0 {
+		audioBitrate = profile.AudioBitrate
+	}
+	args = append(args,
+		"-map", "0:a:0",
+		"-c:a:0", "aac",
+		"-b:a:0", fmt.Sprintf("%dk", audioBitrate),
+	)
+
+	adaptationSets := "id=0,streams=a"
+	if videoIndex > 0 {
+		args = append(args, videoEncoderArgs(profile)...)
+		adaptationSets = "id=0,streams=v id=1,streams=a"
+	}
+
+	args = append(args,
+		"-f", "dash",
+		"-seg_duration", fmt.Sprintf("%d", profile.SegmentDuration),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-adaptation_sets", adaptationSets,
+		"-init_seg_name", fmt.Sprintf("init_%d_$RepresentationID$.mp4", startNumber),
+		"-media_seg_name", fmt.Sprintf("segment_%d_$RepresentationID$_$Number%%05d$.m4s", startNumber),
+		"-hls_playlist", "1",
+		"-hls_master_name", masterPlaylistName,
+	)
+	// Low-latency segments are written as fragments of the LL-HLS part
+	// duration as they are encoded, each of which is served as a part
+	if profile.LowLatency {
+		args = append(args,
+			"-streaming", "1",
+			"-frag_type", "duration",
+			"-frag_duration", fmt.Sprintf("%g", llhlsPartTarget.Seconds()),
+		)
+	}
+	// A window size of 0 keeps every segment listed, so the broadcast can be
+	// turned into a VOD asset afterwards
+	if record {
+		args = append(args, "-window_size", "0")
+	} else {
+		args = append(args,
+			"-window_size", fmt.Sprintf("%d", profile.PlaylistSize),
+			"-extra_window_size", "5",
+		)
+	}
+
+	return append(args, filepath.Join(outputDir, dashManifestName))
+}
+
+// videoOutputArgs maps and encodes the scaled video of the rendition at
+// videoIndex among the ladder's video renditions
+func videoOutputArgs(videoIndex int, rendition models.Rendition) []string {
+	return []string{
+		"-map", fmt.Sprintf("[v%dout]", videoIndex),
+		fmt.Sprintf("-c:v:%d", videoIndex), "libx264",
+		fmt.Sprintf("-b:v:%d", videoIndex), fmt.Sprintf("%dk", rendition.VideoBitrate),
+		fmt.Sprintf("-maxrate:v:%d", videoIndex), fmt.Sprintf("%dk", rendition.VideoBitrate*107/100),
+		fmt.Sprintf("-bufsize:v:%d", videoIndex), fmt.Sprintf("%dk", rendition.VideoBitrate*3/2),
+	}
+}
+
+// videoEncoderArgs returns the libx264 settings shared by all video
+// renditions, with keyframes aligned across renditions on segment boundaries
+func videoEncoderArgs(profile *models.EncodingProfile) []string {
+	args := []string{"-preset", profile.Preset}
+	if profile.Tune != "" {
+		args = append(args, "-tune", profile.Tune)
+	}
+	return append(args,
+		"-sc_threshold", "0",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", profile.SegmentDuration),
+	)
+}
+
+// videoPlaylistPath returns the media playlist FFmpeg writes for the video
+// rendition at videoIndex among the ladder's video renditions
+func videoPlaylistPath(
+	outputDir string,
+	profile *models.EncodingProfile,
+	rendition models.Rendition,
+	videoIndex int,
+) string {
+	if profile.Packaging == models.PackagingCMAF {
+		// Representations are numbered in output order, video first
+		return filepath.Join(outputDir, fmt.Sprintf("media_%d.m3u8", videoIndex))
+	}
+	return filepath.Join(outputDir, rendition.Name, mediaPlaylistName)
+}
+
+// mediaPlaylists returns the media playlists FFmpeg has written to a stream's
+// output directory, for either packaging
+func mediaPlaylists(outputDir string) ([]string, error) {
+	playlists, err := filepath.Glob(filepath.Join(outputDir, "*", mediaPlaylistName))
+	if err != nil {
+		return nil, err
+	}
+	cmafPlaylists, err := filepath.Glob(filepath.Join(outputDir, cmafPlaylistPattern))
+	if err != nil {
+		return nil, err
+	}
+	return append(playlists, cmafPlaylists...), nil
+}
+
+// isMediaPlaylist reports whether a file name is that of a media playlist
+func isMediaPlaylist(name string) bool {
+	if name == mediaPlaylistName {
+		return true
+	}
+	matched, _ := filepath.Match(cmafPlaylistPattern, name)
+	return matched
+}
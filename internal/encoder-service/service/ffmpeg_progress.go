@@ -0,0 +1,86 @@
+package service
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"streamkit/internal/encoder-service/metrics"
+	"streamkit/internal/encoder-service/models"
+)
+
+// progressWriter parses the key=value report FFmpeg writes with -progress and
+// publishes each complete report on the stream encoder and as metrics. FFmpeg
+// ends every report, about twice a second, with a progress=continue line, or
+// progress=end when it exits. One writer is used per FFmpeg process.
+type progressWriter struct {
+	encoder *models.StreamEncoder
+	buf     []byte
+	report  models.EncoderProgress
+	// last is the previous report of this process, for the frame counters
+	last *models.EncoderProgress
+}
+
+func newProgressWriter(encoder *models.StreamEncoder) *progressWriter {
+	return &progressWriter{encoder: encoder}
+}
+
+// Write buffers FFmpeg's output and handles each complete line. It never
+// fails, so a malformed report cannot stall the FFmpeg process.
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.handleLine(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// handleLine records one key=value pair of the current report
+func (w *progressWriter) handleLine(line string) {
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok {
+		return
+	}
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "frame":
+		w.report.Frames = parseProgressInt(value)
+	case "fps":
+		w.report.FPS = parseProgressFloat(value, "")
+	case "bitrate":
+		w.report.BitrateKbps = parseProgressFloat(value, "kbits/s")
+	case "speed":
+		w.report.Speed = parseProgressFloat(value, "x")
+	case "drop_frames":
+		w.report.DroppedFrames = parseProgressInt(value)
+	case "dup_frames":
+		w.report.DuplicatedFrames = parseProgressInt(value)
+	case "progress":
+		report := w.report
+		report.UpdatedAt = time.Now()
+		metrics.FFmpegProgress(w.last, &report)
+		w.encoder.Progress.Store(&report)
+		w.last = &report
+	}
+}
+
+// parseProgressInt parses an integer progress value, which is 0 while FFmpeg
+// reports N/A
+func parseProgressInt(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+// parseProgressFloat parses a decimal progress value with an optional unit
+// suffix, which is 0 while FFmpeg reports N/A
+func parseProgressFloat(value, unit string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSuffix(value, unit), 64)
+	return f
+}
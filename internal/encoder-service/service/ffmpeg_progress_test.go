@@ -0,0 +1,127 @@
+package service
+
+import (
+	"testing"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+func TestProgressWriter(t *testing.T) {
+	report := "frame=250\nfps=29.97\nstream_0_0_q=23.0\nbitrate=2150.3kbits/s\n" +
+		"total_size=1048576\nout_time=00:00:08.341000\ndup_frames=2\ndrop_frames=1\nspeed=1.01x\n"
+
+	tests := []struct {
+		name   string
+		chunks []string
+		want   *models.EncoderProgress // nil if no report is complete
+	}{
+		{
+			name:   "one report",
+			chunks: []string{report + "progress=continue\n"},
+			want: &models.EncoderProgress{
+				Frames: 250, FPS: 29.97, BitrateKbps: 2150.3, Speed: 1.01,
+				DroppedFrames: 1, DuplicatedFrames: 2,
+			},
+		},
+		{
+			name:   "report split mid-line",
+			chunks: []string{report[:17], report[17:40], report[40:] + "progr", "ess=continue\n"},
+			want: &models.EncoderProgress{
+				Frames: 250, FPS: 29.97, BitrateKbps: 2150.3, Speed: 1.01,
+				DroppedFrames: 1, DuplicatedFrames: 2,
+			},
+		},
+		{
+			name: "values not available yet",
+			chunks: []string{"frame=0\nfps=0.00\nbitrate=N/A\nspeed=N/A\n" +
+				"drop_frames=0\ndup_frames=0\nprogress=continue\n"},
+			want: &models.EncoderProgress{},
+		},
+		{
+			name: "latest of several reports",
+			chunks: []string{
+				report + "progress=continue\n",
+				"frame=300\r\nfps=30.0\r\nbitrate=2000.0kbits/s\r\nspeed=0.98x\r\nprogress=end\r\n",
+			},
+			want: &models.EncoderProgress{
+				Frames: 300, FPS: 30, BitrateKbps: 2000, Speed: 0.98,
+				DroppedFrames: 1, DuplicatedFrames: 2,
+			},
+		},
+		{
+			name:   "incomplete report",
+			chunks: []string{report},
+			want:   nil,
+		},
+		{
+			name:   "malformed lines",
+			chunks: []string{"garbage\n=\nframe=abc\nspeed=fastx\nprogress=continue\n"},
+			want:   &models.EncoderProgress{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := &models.StreamEncoder{}
+			writer := newProgressWriter(encoder)
+			for _, chunk := range tt.chunks {
+				n, err := writer.Write([]byte(chunk))
+				if err != nil || n != len(chunk) {
+					t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(chunk))
+				}
+			}
+
+			got := encoder.Progress.Load()
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("Progress = %+v, want none", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("Progress = none, want a report")
+			}
+			if got.UpdatedAt.IsZero() {
+				t.Error("Progress.UpdatedAt is not set")
+			}
+			gotReport := *got
+			gotReport.UpdatedAt = tt.want.UpdatedAt
+			if gotReport != *tt.want {
+				t.Errorf("Progress = %+v, want %+v", gotReport, *tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProgressValues(t *testing.T) {
+	floatTests := []struct {
+		value, unit string
+		want        float64
+	}{
+		{"29.97", "", 29.97},
+		{"2150.3kbits/s", "kbits/s", 2150.3},
+		{"1.01x", "x", 1.01},
+		{"N/A", "x", 0},
+		{"", "", 0},
+	}
+	for _, tt := range floatTests {
+		if got := parseProgressFloat(tt.value, tt.unit); got != tt.want {
+			t.Errorf("parseProgressFloat(%q, %q) = %v, want %v", tt.value, tt.unit, got, tt.want)
+		}
+	}
+
+	intTests := []struct {
+		value string
+		want  int64
+	}{
+		{"250", 250},
+		{"0", 0},
+		{"N/A", 0},
+		{"12.5", 0},
+	}
+	for _, tt := range intTests {
+		if got := parseProgressInt(tt.value); got != tt.want {
+			t.Errorf("parseProgressInt(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
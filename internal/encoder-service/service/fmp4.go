@@ -0,0 +1,267 @@
+package service
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// sampleIsNonSync is the sample flags bit set on samples that are not
+// keyframes
+const sampleIsNonSync = 0x00010000
+
+// fmp4Track holds the defaults an fMP4 initialization segment sets for the
+// fragments of its single track
+type fmp4Track struct {
+	timescale             uint32
+	defaultSampleDuration uint32
+	defaultSampleFlags    uint32
+	hasDefaultFlags       bool
+}
+
+// fmp4Fragment is a complete moof+mdat pair of a media segment, with any
+// boxes written before it, such as styp
+type fmp4Fragment struct {
+	offset      int64
+	length      int64
+	duration    float64 // seconds
+	independent bool    // starts with a keyframe
+}
+
+// box is an ISO BMFF box read from memory
+type box struct {
+	kind string
+	body []byte
+}
+
+// readBoxes splits data into its top-level boxes
+func readBoxes(data []byte) ([]box, error) {
+	var boxes []box
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		kind := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, fmt.Errorf("truncated box header")
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid %s box size %d", kind, size)
+		}
+		boxes = append(boxes, box{kind: kind, body: data[header:size]})
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+// findBox returns the first box at the end of a path of nested box types,
+// e.g. "moov", "trak", "mdia", "mdhd"
+func findBox(data []byte, path ...string) ([]byte, bool) {
+	boxes, err := readBoxes(data)
+	if err != nil {
+		return nil, false
+	}
+	for _, b := range boxes {
+		if b.kind != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return b.body, true
+		}
+		return findBox(b.body, path[1:]...)
+	}
+	return nil, false
+}
+
+// readFMP4Track reads the timescale and sample defaults of the single track
+// of an fMP4 initialization segment
+func readFMP4Track(initPath string) (*fmp4Track, error) {
+	data, err := os.ReadFile(initPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mdhd, ok := findBox(data, "moov", "trak", "mdia", "mdhd")
+	if !ok || len(mdhd) < 24 {
+		return nil, fmt.Errorf("%s: no media header", initPath)
+	}
+	track := &fmp4Track{}
+	// Version 1 headers have 64-bit creation and modification times
+	if mdhd[0] == 1 {
+		if len(mdhd) < 32 {
+			return nil, fmt.Errorf("%s: truncated media header", initPath)
+		}
+		track.timescale = binary.BigEndian.Uint32(mdhd[20:])
+	} else {
+		track.timescale = binary.BigEndian.Uint32(mdhd[12:])
+	}
+	if track.timescale == 0 {
+		return nil, fmt.Errorf("%s: zero timescale", initPath)
+	}
+
+	if trex, ok := findBox(data, "moov", "mvex", "trex"); ok && len(trex) >= 24 {
+		track.defaultSampleDuration = binary.BigEndian.Uint32(trex[12:])
+		track.defaultSampleFlags = binary.BigEndian.Uint32(trex[20:])
+		track.hasDefaultFlags = true
+	}
+
+	return track, nil
+}
+
+// readFMP4Fragments returns the complete fragments of a media segment that
+// may still be being written. A fragment is complete once its mdat is.
+func readFMP4Fragments(segmentPath string, track *fmp4Track) ([]fmp4Fragment, error) {
+	file, err := os.Open(segmentPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	var fragments []fmp4Fragment
+	var start, offset int64
+	var moof []byte
+	header := make([]byte, 16)
+	for offset+8 <= size {
+		if _, err := file.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header))
+		kind := string(header[4:8])
+		headerSize := int64(8)
+		if boxSize == 1 {
+			if offset+16 > size {
+				break
+			}
+			if _, err := file.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if boxSize < headerSize {
+			// A size of 0 runs to the end of the file, which is not
+			// known while it is being written
+			break
+		}
+		if offset+boxSize > size {
+			break
+		}
+
+		switch kind {
+		case "moof":
+			moof = make([]byte, boxSize-headerSize)
+			if _, err := file.ReadAt(moof, offset+headerSize); err != nil && err != io.EOF {
+				return nil, err
+			}
+		case "mdat":
+			if moof == nil {
+				return nil, fmt.Errorf("%s: mdat without moof", segmentPath)
+			}
+			duration, independent := fragmentTiming(moof, track)
+			fragments = append(fragments, fmp4Fragment{
+				offset:      start,
+				length:      offset + boxSize - start,
+				duration:    duration,
+				independent: independent,
+			})
+			start = offset + boxSize
+			moof = nil
+		}
+		offset += boxSize
+	}
+
+	return fragments, nil
+}
+
+// fragmentTiming returns the duration of a movie fragment in seconds and
+// whether its first sample is a keyframe
+func fragmentTiming(moof []byte, track *fmp4Track) (float64, bool) {
+	tfhd, _ := findBox(moof, "traf", "tfhd")
+	trun, ok := findBox(moof, "traf", "trun")
+	if !ok || len(trun) < 8 {
+		return 0, false
+	}
+
+	defaultDuration := track.defaultSampleDuration
+	defaultFlags, hasDefaultFlags := track.defaultSampleFlags, track.hasDefaultFlags
+	if len(tfhd) >= 8 {
+		flags := binary.BigEndian.Uint32(tfhd) & 0xffffff
+		pos := 8 // version, flags and track ID
+		for _, field := range []uint32{0x01, 0x02, 0x08, 0x10, 0x20} {
+			if flags&field == 0 {
+				continue
+			}
+			width := 4
+			if field == 0x01 {
+				width = 8 // base data offset
+			}
+			if pos+width > len(tfhd) {
+				break
+			}
+			switch field {
+			case 0x08:
+				defaultDuration = binary.BigEndian.Uint32(tfhd[pos:])
+			case 0x20:
+				defaultFlags, hasDefaultFlags = binary.BigEndian.Uint32(tfhd[pos:]), true
+			}
+			pos += width
+		}
+	}
+
+	flags := binary.BigEndian.Uint32(trun) & 0xffffff
+	samples := binary.BigEndian.Uint32(trun[4:])
+	pos := 8
+	if flags&0x01 != 0 {
+		pos += 4 // data offset
+	}
+	firstFlags, hasFirstFlags := uint32(0), false
+	if flags&0x04 != 0 && pos+4 <= len(trun) {
+		firstFlags, hasFirstFlags = binary.BigEndian.Uint32(trun[pos:]), true
+		pos += 4
+	}
+
+	var total uint64
+	for i := uint32(0); i < samples; i++ {
+		duration := defaultDuration
+		for _, field := range []uint32{0x100, 0x200, 0x400, 0x800} {
+			if flags&field == 0 {
+				continue
+			}
+			if pos+4 > len(trun) {
+				return float64(total) / float64(track.timescale), false
+			}
+			value := binary.BigEndian.Uint32(trun[pos:])
+			switch {
+			case field == 0x100:
+				duration = value
+			case field == 0x400 && i == 0 && !hasFirstFlags:
+				firstFlags, hasFirstFlags = value, true
+			}
+			pos += 4
+		}
+		total += uint64(duration)
+	}
+
+	if !hasFirstFlags {
+		firstFlags, hasFirstFlags = defaultFlags, hasDefaultFlags
+	}
+	independent := hasFirstFlags && firstFlags&sampleIsNonSync == 0
+
+	return float64(total) / float64(track.timescale), independent
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// mp4Box builds an ISO BMFF box of kind around payload
+func mp4Box(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], kind)
+	return append(b, body...)
+}
+
+// u32 encodes big-endian 32-bit fields
+func u32(values ...uint32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint32(b[4*i:], value)
+	}
+	return b
+}
+
+// testInitSegment builds an initialization segment with a version 0 media
+// header of timescale and a trex with default sample duration and flags
+func testInitSegment(timescale, defaultDuration, defaultFlags uint32) []byte {
+	mdhd := mp4Box("mdhd", u32(0, 0, 0, timescale, 0, 0))
+	trex := mp4Box("trex", u32(0, 1, 1, defaultDuration, 0, defaultFlags))
+	return mp4Box("moov",
+		mp4Box("mvhd", u32(0)),
+		mp4Box("trak", mp4Box("tkhd", u32(0)), mp4Box("mdia", mdhd)),
+		mp4Box("mvex", trex),
+	)
+}
+
+// testFragment builds a moof with one trun listing sampleDurations, the
+// first sample flagged as a keyframe or not, and an mdat of mdatSize bytes
+func testFragment(keyframe bool, mdatSize int, sampleDurations ...uint32) []byte {
+	firstFlags := uint32(sampleIsNonSync)
+	if keyframe {
+		firstFlags = 0
+	}
+	trun := u32(0x000105, uint32(len(sampleDurations)), 0, firstFlags)
+	for _, duration := range sampleDurations {
+		trun = append(trun, u32(duration)...)
+	}
+	moof := mp4Box("moof",
+		mp4Box("mfhd", u32(0, 1)),
+		mp4Box("traf", mp4Box("tfhd", u32(0x020000, 1)), mp4Box("trun", trun)),
+	)
+	return append(moof, mp4Box("mdat", make([]byte, mdatSize))...)
+}
+
+func TestReadBoxes(t *testing.T) {
+	largeBox := append(u32(1), []byte("free")...)
+	largeBox = append(largeBox, 0, 0, 0, 0)
+	largeBox = append(largeBox, u32(20)...)
+	largeBox = append(largeBox, 1, 2, 3, 4)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantKinds []string
+		wantErr   bool
+	}{
+		{"empty", nil, nil, false},
+		{"sequence", append(mp4Box("ftyp", []byte("iso6")), mp4Box("moov")...), []string{"ftyp", "moov"}, false},
+		{"size 0 runs to the end", append(u32(0), []byte("mdat12345")...), []string{"mdat"}, false},
+		{"64-bit size", largeBox, []string{"free"}, false},
+		{"truncated header", []byte{0, 0, 0}, nil, true},
+		{"truncated 64-bit header", append(u32(1), []byte("free")...), nil, true},
+		{"size past the end", append(u32(64), []byte("mdat")...), nil, true},
+		{"size below the header", append(u32(4), []byte("mdat")...), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boxes, err := readBoxes(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readBoxes() error = %v, want error %v", err, tt.wantErr)
+			}
+			var kinds []string
+			for _, b := range boxes {
+				kinds = append(kinds, b.kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.wantKinds) {
+				t.Errorf("readBoxes() kinds = %v, want %v", kinds, tt.wantKinds)
+			}
+		})
+	}
+}
+
+func TestFindBox(t *testing.T) {
+	data := testInitSegment(90000, 3000, 0)
+
+	tests := []struct {
+		path    []string
+		wantLen int
+		wantOK  bool
+	}{
+		{[]string{"moov", "trak", "mdia", "mdhd"}, 24, true},
+		{[]string{"moov", "mvex", "trex"}, 24, true},
+		{[]string{"moov", "trak", "tkhd"}, 4, true},
+		{[]string{"moov", "trak", "mdia", "hdlr"}, 0, false},
+		{[]string{"moof"}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(filepath.Join(tt.path...), func(t *testing.T) {
+			body, ok := findBox(data, tt.path...)
+			if ok != tt.wantOK || len(body) != tt.wantLen {
+				t.Errorf("findBox() = %d bytes, %v, want %d bytes, %v", len(body), ok, tt.wantLen, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestReadFMP4Track(t *testing.T) {
+	mdhdV1 := mp4Box("mdhd", u32(1<<24, 0, 0, 0, 0, 48000, 0, 0, 0))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *fmp4Track
+		wantErr bool
+	}{
+		{
+			name: "version 0 header with trex",
+			data: testInitSegment(90000, 3000, sampleIsNonSync),
+			want: &fmp4Track{timescale: 90000, defaultSampleDuration: 3000,
+				defaultSampleFlags: sampleIsNonSync, hasDefaultFlags: true},
+		},
+		{
+			name: "version 1 header without mvex",
+			data: mp4Box("moov", mp4Box("trak", mp4Box("mdia", mdhdV1))),
+			want: &fmp4Track{timescale: 48000},
+		},
+		{
+			name:    "zero timescale",
+			data:    testInitSegment(0, 0, 0),
+			wantErr: true,
+		},
+		{
+			name:    "no media header",
+			data:    mp4Box("moov", mp4Box("trak")),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "init_1_0.mp4")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readFMP4Track(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readFMP4Track() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && *got != *tt.want {
+				t.Errorf("readFMP4Track() = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestFragmentTiming(t *testing.T) {
+	track := &fmp4Track{timescale: 1000, defaultSampleDuration: 40}
+	keyframeDefaults := &fmp4Track{timescale: 1000, defaultSampleDuration: 40, hasDefaultFlags: true}
+
+	tests := []struct {
+		name            string
+		track           *fmp4Track
+		traf            []byte
+		wantDuration    float64
+		wantIndependent bool
+	}{
+		{
+			name:  "per-sample durations and first sample flags",
+			track: track,
+			traf: mp4Box("traf", mp4Box("tfhd", u32(0, 1)),
+				mp4Box("trun", u32(0x000105, 3, 0, 0, 100, 150, 250))),
+			wantDuration:    0.5,
+			wantIndependent: true,
+		},
+		{
+			name:  "non-sync first sample",
+			track: track,
+			traf: mp4Box("traf", mp4Box("tfhd", u32(0, 1)),
+				mp4Box("trun", u32(0x000004, 2, sampleIsNonSync))),
+			wantDuration:    0.08,
+			wantIndependent: false,
+		},
+		{
+			name:  "tfhd default duration and flags",
+			track: track,
+			traf: mp4Box("traf", mp4Box("tfhd", u32(0x000028, 1, 20, 0)),
+				mp4Box("trun", u32(0, 10))),
+			wantDuration:    0.2,
+			wantIndependent: true,
+		},
+		{
+			name:  "tfhd fields after a base data offset",
+			track: track,
+			traf: mp4Box("traf", mp4Box("tfhd", u32(0x00002b, 1, 0, 64, 1, 25, sampleIsNonSync)),
+				mp4Box("trun", u32(0, 4))),
+			wantDuration:    0.1,
+			wantIndependent: false,
+		},
+		{
+			name:  "per-sample flags of the first sample",
+			track: track,
+			traf: mp4Box("traf", mp4Box("tfhd", u32(0, 1)),
+				mp4Box("trun", u32(0x000500, 2, 10, 0, 10, sampleIsNonSync))),
+			wantDuration:    0.02,
+			wantIndependent: true,
+		},
+		{
+			name:  "trex default flags",
+			track: keyframeDefaults,
+			traf: mp4Box("traf", mp4Box("tfhd", u32(0, 1)),
+				mp4Box("trun", u32(0, 25))),
+			wantDuration:    1,
+			wantIndependent: true,
+		},
+		{
+			name:            "no flags at all",
+			track:           track,
+			traf:            mp4Box("traf", mp4Box("tfhd", u32(0, 1)), mp4Box("trun", u32(0, 25))),
+			wantDuration:    1,
+			wantIndependent: false,
+		},
+		{
+			name:            "no trun",
+			track:           track,
+			traf:            mp4Box("traf", mp4Box("tfhd", u32(0, 1))),
+			wantDuration:    0,
+			wantIndependent: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, independent := fragmentTiming(tt.traf, tt.track)
+			if duration != tt.wantDuration || independent != tt.wantIndependent {
+				t.Errorf("fragmentTiming() = %v, %v, want %v, %v",
+					duration, independent, tt.wantDuration, tt.wantIndependent)
+			}
+		})
+	}
+}
+
+func TestReadFMP4Fragments(t *testing.T) {
+	track := &fmp4Track{timescale: 1000}
+	styp := mp4Box("styp", []byte("msdh"))
+	first := testFragment(true, 100, 250, 250)
+	second := testFragment(false, 50, 500)
+	complete := bytes.Join([][]byte{styp, first, second}, nil)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []fmp4Fragment
+	}{
+		{
+			name: "complete segment",
+			data: complete,
+			want: []fmp4Fragment{
+				{offset: 0, length: int64(len(styp) + len(first)), duration: 0.5, independent: true},
+				{offset: int64(len(styp) + len(first)), length: int64(len(second)), duration: 0.5},
+			},
+		},
+		{
+			name: "segment being written",
+			data: complete[:len(complete)-10],
+			want: []fmp4Fragment{
+				{offset: 0, length: int64(len(styp) + len(first)), duration: 0.5, independent: true},
+			},
+		},
+		{
+			name: "partial box header",
+			data: append(append([]byte{}, styp...), 0, 0),
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "segment_1_0_00001.m4s")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readFMP4Fragments(path, track)
+			if err != nil {
+				t.Fatalf("readFMP4Fragments() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readFMP4Fragments() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFMP4FragmentsMdatWithoutMoof(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segment_1_0_00001.m4s")
+	if err := os.WriteFile(path, mp4Box("mdat", make([]byte, 8)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readFMP4Fragments(path, &fmp4Track{timescale: 1000}); err == nil {
+		t.Error("readFMP4Fragments() succeeded, want error")
+	}
+}
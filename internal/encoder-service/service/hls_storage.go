@@ -0,0 +1,197 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// TenantKey places key under a tenant's storage prefix. The default tenant
+// has an empty prefix and keeps its files at the root of the storage.
+func TenantKey(tenantPrefix, key string) string {
+	tenantPrefix = strings.Trim(tenantPrefix, "/")
+	if tenantPrefix == "" {
+		return key
+	}
+	return tenantPrefix + "/" + key
+}
+
+// UploadHLSFile uploads one file of a stream's live output. The local layout
+// is {localDir}/master.m3u8 plus {localDir}/{rendition}/playlist.m3u8 and
+// {localDir}/{rendition}/segment_*.ts, or with CMAF packaging
+// {localDir}/manifest.mpd, {localDir}/media_{n}.m3u8, {localDir}/init_*.mp4
+// and {localDir}/segment_*.m4s, mirrored under keyPrefix, the stream's
+// StreamFilesPrefix.
+func UploadHLSFile(storage Storage, keyPrefix, localDir, localPath string) error {
+	return storage.UploadFile(localPath, hlsKey(keyPrefix, localDir, localPath))
+}
+
+// hlsKey maps a local HLS file to its storage key under keyPrefix
+func hlsKey(keyPrefix, localDir, localPath string) string {
+	relPath, err := filepath.Rel(localDir, localPath)
+	if err != nil {
+		relPath = filepath.Base(localPath)
+	}
+	return keyPrefix + filepath.ToSlash(relPath)
+}
+
+// StreamFilesPrefix returns the storage prefix of a stream's live HLS output,
+// {tenantPrefix}/hls/{playbackID}/
+func StreamFilesPrefix(tenantPrefix, playbackID string) string {
+	return TenantKey(tenantPrefix, fmt.Sprintf("hls/%s/", playbackID))
+}
+
+// RecordingPrefix returns the storage prefix of a recording,
+// {tenantPrefix}/recordings/{playbackID}/{recordingID}
+func RecordingPrefix(tenantPrefix, playbackID string, recordingID int64) string {
+	return TenantKey(tenantPrefix, fmt.Sprintf("recordings/%s/%d", playbackID, recordingID))
+}
+
+// RecordingsPrefix returns the storage prefix of all of a stream's
+// recordings, {tenantPrefix}/recordings/{playbackID}/
+func RecordingsPrefix(tenantPrefix, playbackID string) string {
+	return TenantKey(tenantPrefix, fmt.Sprintf("recordings/%s/", playbackID))
+}
+
+// ThumbnailKey returns the storage key of a stream's latest thumbnail,
+// {tenantPrefix}/thumbnails/{playbackID}/latest.jpg
+func ThumbnailKey(tenantPrefix, playbackID string) string {
+	return TenantKey(tenantPrefix, fmt.Sprintf("thumbnails/%s/%s", playbackID, thumbnailFileName))
+}
+
+// UploadRecording stores a finished recording under prefix: the segments
+// each of the media playlists in localDir references, and in place of each
+// playlist the VOD playlist written next to it. Segments the segment uploader
+// already stored under liveKeyPrefix, the stream's StreamFilesPrefix, are
+// copied within the storage; only the others are uploaded. Sprite sheets and
+// their WebVTT track go under {prefix}/sprites/.
+func UploadRecording(
+	logger *zap.Logger,
+	storage Storage,
+	prefix, liveKeyPrefix, localDir string,
+	playlists []string,
+) error {
+	keyPrefix := prefix + "/"
+	segmentCount := 0
+	uploadedCount := 0
+
+	for _, playlistPath := range playlists {
+		vodPath := vodPlaylistPath(playlistPath)
+		playlist, err := readMediaPlaylist(vodPath)
+		if err != nil {
+			return fmt.Errorf("failed to read VOD playlist: %w", err)
+		}
+
+		files := playlist.Segments
+		if playlist.InitSegment != "" {
+			files = append([]string{playlist.InitSegment}, files...)
+		}
+		for _, file := range files {
+			segmentPath := filepath.Join(filepath.Dir(playlistPath), file)
+			key := hlsKey(keyPrefix, localDir, segmentPath)
+
+			err := storage.CopyFile(hlsKey(liveKeyPrefix, localDir, segmentPath), key)
+			if errors.Is(err, ErrFileNotFound) {
+				// Written after the segment uploader last ran
+				err = storage.UploadFile(segmentPath, key)
+				uploadedCount++
+			}
+			if err != nil {
+				return fmt.Errorf("failed to store recording segment: %w", err)
+			}
+		}
+		segmentCount += len(playlist.Segments)
+
+		if err := storage.UploadFile(vodPath, hlsKey(keyPrefix, localDir, playlistPath)); err != nil {
+			return fmt.Errorf("failed to upload recording playlist: %w", err)
+		}
+	}
+
+	// Seek preview sprite sheets and their WebVTT track, if they were built
+	spriteFiles, err := filepath.Glob(filepath.Join(localDir, spriteDirName, "*"))
+	if err != nil {
+		return fmt.Errorf("failed to glob sprite files: %w", err)
+	}
+
+	for _, spritePath := range spriteFiles {
+		key := fmt.Sprintf("%s/%s/%s", prefix, spriteDirName, filepath.Base(spritePath))
+		if err := storage.UploadFile(spritePath, key); err != nil {
+			return fmt.Errorf("failed to upload recording sprite: %w", err)
+		}
+	}
+
+	masterPath := filepath.Join(localDir, masterPlaylistName)
+	if err := storage.UploadFile(masterPath, prefix+"/"+masterPlaylistName); err != nil {
+		return fmt.Errorf("failed to upload recording master playlist: %w", err)
+	}
+
+	logger.Info("Uploaded recording",
+		zap.String("prefix", prefix),
+		zap.Int("segment_count", segmentCount),
+		zap.Int("uploaded_segments", uploadedCount),
+	)
+
+	return nil
+}
+
+// DeleteStreamFiles deletes all live files for a tenant's playback ID
+func DeleteStreamFiles(logger *zap.Logger, storage Storage, tenantPrefix, playbackID string) error {
+	fileCount, err := deletePrefix(logger, storage, StreamFilesPrefix(tenantPrefix, playbackID))
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Deleted stream files",
+		zap.String("playback_id", playbackID),
+		zap.Int("file_count", fileCount),
+	)
+
+	return nil
+}
+
+// DeleteAllStreamFiles deletes everything stored for a tenant's deleted
+// playback ID: its thumbnail, any live files and its recordings
+func DeleteAllStreamFiles(logger *zap.Logger, storage Storage, tenantPrefix, playbackID string) error {
+	if err := storage.DeleteFile(ThumbnailKey(tenantPrefix, playbackID)); err != nil {
+		return fmt.Errorf("failed to delete thumbnail: %w", err)
+	}
+
+	liveCount, err := deletePrefix(logger, storage, StreamFilesPrefix(tenantPrefix, playbackID))
+	if err != nil {
+		return err
+	}
+	recordingCount, err := deletePrefix(logger, storage, RecordingsPrefix(tenantPrefix, playbackID))
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Deleted files of deleted stream",
+		zap.String("playback_id", playbackID),
+		zap.Int("file_count", liveCount+recordingCount),
+	)
+
+	return nil
+}
+
+// deletePrefix deletes every file under prefix and returns how many it
+// listed. Files that fail to delete are logged and skipped.
+func deletePrefix(logger *zap.Logger, storage Storage, prefix string) (int, error) {
+	files, err := storage.ListFiles(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list files for deletion: %w", err)
+	}
+
+	for _, file := range files {
+		if err := storage.DeleteFile(file.Key); err != nil {
+			logger.Error("Failed to delete object",
+				zap.String("key", file.Key),
+				zap.Error(err),
+			)
+		}
+	}
+
+	return len(files), nil
+}
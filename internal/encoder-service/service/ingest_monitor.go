@@ -0,0 +1,152 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+// rtmpApplication is the nginx-rtmp application that publishers connect to
+const rtmpApplication = "live"
+
+// rtmpStat is the part of nginx-rtmp's /stat document that lists the streams
+// being published and the bytes received for each
+type rtmpStat struct {
+	Applications []struct {
+		Name    string `xml:"name"`
+		Streams []struct {
+			Name    string `xml:"name"`
+			BytesIn int64  `xml:"bytes_in"`
+			// Publishing is present while a publisher is connected; streams
+			// are also listed while only players are
+			Publishing *struct{} `xml:"publishing"`
+		} `xml:"live>stream"`
+	} `xml:"server>application"`
+}
+
+// MonitorIngest samples the bytes received from each publisher from the RTMP
+// server's statistics every interval, for the session of every active stream.
+// nginx-rtmp forgets a stream once its publisher leaves, so the last sample
+// of a session is at most one interval old. It never returns.
+func (e *EncoderService) MonitorIngest(interval time.Duration) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		stat, err := e.fetchRTMPStat(client)
+		if err != nil {
+			e.logger.Warn("Failed to read RTMP server statistics", zap.Error(err))
+			continue
+		}
+
+		e.mu.RLock()
+		for _, application := range stat.Applications {
+			if application.Name != rtmpApplication {
+				continue
+			}
+			for _, stream := range application.Streams {
+				if encoder, exists := e.activeProcesses[stream.Name]; exists {
+					encoder.BytesIngested.Store(stream.BytesIn)
+				}
+			}
+		}
+		e.mu.RUnlock()
+	}
+}
+
+// sampleIngest takes a last sample of the bytes received for a stream, whose
+// session is ending. Publishers that are already gone are not listed anymore,
+// so their last periodic sample stands.
+func (e *EncoderService) sampleIngest(encoder *models.StreamEncoder) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	stat, err := e.fetchRTMPStat(client)
+	if err != nil {
+		e.logger.Warn("Failed to read RTMP server statistics",
+			zap.String("stream_key", encoder.StreamKey),
+			zap.Error(err),
+		)
+		return
+	}
+
+	for _, application := range stat.Applications {
+		if application.Name != rtmpApplication {
+			continue
+		}
+		for _, stream := range application.Streams {
+			if stream.Name == encoder.StreamKey && stream.BytesIn > encoder.BytesIngested.Load() {
+				encoder.BytesIngested.Store(stream.BytesIn)
+			}
+		}
+	}
+}
+
+// publisherConnected reports whether a publisher is still sending a stream
+// key to the RTMP server. If the server's statistics cannot be read the
+// publisher is assumed to be connected.
+func (e *EncoderService) publisherConnected(streamKey string) bool {
+	client := &http.Client{Timeout: 5 * time.Second}
+	stat, err := e.fetchRTMPStat(client)
+	if err != nil {
+		e.logger.Warn("Failed to read RTMP server statistics",
+			zap.String("stream_key", streamKey),
+			zap.Error(err),
+		)
+		return true
+	}
+
+	for _, application := range stat.Applications {
+		if application.Name != rtmpApplication {
+			continue
+		}
+		for _, stream := range application.Streams {
+			if stream.Name == streamKey && stream.Publishing != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fetchRTMPStat reads the RTMP server's statistics document
+func (e *EncoderService) fetchRTMPStat(client *http.Client) (*rtmpStat, error) {
+	resp, err := client.Get(e.rtmpHTTPURL + "/stat")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	stat := &rtmpStat{}
+	if err := xml.NewDecoder(resp.Body).Decode(stat); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+// dropPublisher disconnects a stream key's publisher from the RTMP server
+// through the nginx-rtmp control module
+func (e *EncoderService) dropPublisher(streamKey string) error {
+	query := url.Values{"app": {rtmpApplication}, "name": {streamKey}}
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Get(e.rtmpHTTPURL + "/control/drop/publisher?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+const (
+	// inputProbeWindow is how much of the input is read to measure the
+	// keyframe interval
+	inputProbeWindow = 8 * time.Second
+
+	// inputProbeTimeout bounds a probe, including connecting to the RTMP
+	// server and waiting for the publisher's first packets
+	inputProbeTimeout = 15 * time.Second
+
+	// inputStreamsTimeout is how long FFmpeg's first start waits for the
+	// input's streams to be probed before encoding the full ladder
+	inputStreamsTimeout = 5 * time.Second
+
+	// maxKeyframeInterval is the longest keyframe interval accepted without
+	// a warning; players cannot start decoding between keyframes
+	maxKeyframeInterval = 4.0
+)
+
+// keyframeGaps measures the longest gap between consecutive video keyframes
+type keyframeGaps struct {
+	count   int
+	last    float64
+	longest float64
+}
+
+// add records a keyframe at pts seconds
+func (k *keyframeGaps) add(pts float64) {
+	if k.count > 0 && pts-k.last > k.longest {
+		k.longest = pts - k.last
+	}
+	k.last = pts
+	k.count++
+}
+
+// finishInputProbe stores the keyframe interval on a probe of the input's
+// streams and warns about publisher settings that hurt playback
+func finishInputProbe(probe *models.InputProbe, keyframes *keyframeGaps) {
+	probe.KeyframeInterval = keyframes.longest
+
+	switch {
+	case probe.VideoCodec == "":
+		probe.Warnings = append(probe.Warnings, "no video stream")
+	case probe.KeyframeInterval > maxKeyframeInterval:
+		probe.Warnings = append(probe.Warnings, fmt.Sprintf(
+			"keyframe interval is %.1fs; set it to 2s (at most %.0fs) in the encoder",
+			probe.KeyframeInterval, maxKeyframeInterval))
+	case keyframes.count < 2:
+		probe.Warnings = append(probe.Warnings, fmt.Sprintf(
+			"fewer than two keyframes in %s; set the keyframe interval to 2s in the encoder",
+			inputProbeWindow))
+	}
+	if probe.AudioCodec == "" {
+		probe.Warnings = append(probe.Warnings, "no audio stream")
+	}
+}
@@ -0,0 +1,156 @@
+//go:build !goav
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+// ffprobeStreamEntries are the stream fields ffprobe is asked for
+const ffprobeStreamEntries = "stream=index,codec_type,codec_name,width,height,avg_frame_rate,r_frame_rate,sample_rate,channels"
+
+// ffprobeOutput is the part of ffprobe's JSON output used to describe an input
+type ffprobeOutput struct {
+	Streams []struct {
+		Index        int    `json:"index"`
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		RFrameRate   string `json:"r_frame_rate"`
+		SampleRate   string `json:"sample_rate"`
+		Channels     int    `json:"channels"`
+	} `json:"streams"`
+	Packets []struct {
+		StreamIndex int    `json:"stream_index"`
+		PTSTime     string `json:"pts_time"`
+		Flags       string `json:"flags"`
+	} `json:"packets"`
+}
+
+// probeInput reads the first seconds of an RTMP input and describes its video
+// and audio, with warnings about poor publisher settings. onStreams receives
+// the description of the streams as soon as they are known, before the
+// keyframe interval has been measured. The probe is cancelled with ctx.
+//
+// Builds without the goav tag probe with ffprobe, which reads the streams
+// and then the packets over two connections.
+func probeInput(
+	ctx context.Context,
+	rtmpURL string,
+	onStreams func(*models.InputProbe),
+) (*models.InputProbe, error) {
+	ctx, cancel := context.WithTimeout(ctx, inputProbeTimeout)
+	defer cancel()
+
+	streams, err := runFFprobe(ctx, "-show_entries", ffprobeStreamEntries, rtmpURL)
+	if err != nil {
+		return nil, err
+	}
+	onStreams(describeStreams(streams))
+
+	result, err := runFFprobe(ctx,
+		"-read_intervals", fmt.Sprintf("%%+%d", int(inputProbeWindow.Seconds())),
+		"-show_entries", ffprobeStreamEntries+":packet=stream_index,pts_time,flags",
+		rtmpURL,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return describeInput(result), nil
+}
+
+// runFFprobe runs ffprobe with JSON output and parses what it printed
+func runFFprobe(ctx context.Context, args ...string) (*ffprobeOutput, error) {
+	args = append([]string{"-v", "error", "-of", "json"}, args...)
+	output, err := exec.CommandContext(ctx, "ffprobe", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var result ffprobeOutput
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	return &result, nil
+}
+
+// describeStreams summarizes the first video and audio streams in ffprobe's
+// output for an input
+func describeStreams(result *ffprobeOutput) *models.InputProbe {
+	probe := &models.InputProbe{Warnings: []string{}}
+	seenVideo := false
+	for _, stream := range result.Streams {
+		switch {
+		case stream.CodecType == "video" && !seenVideo:
+			seenVideo = true
+			probe.VideoCodec = stream.CodecName
+			probe.Width = stream.Width
+			probe.Height = stream.Height
+			probe.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			if probe.FrameRate == 0 {
+				probe.FrameRate = parseFrameRate(stream.RFrameRate)
+			}
+		case stream.CodecType == "audio" && probe.AudioCodec == "":
+			probe.AudioCodec = stream.CodecName
+			probe.AudioSampleRate, _ = strconv.Atoi(stream.SampleRate)
+			probe.AudioChannels = stream.Channels
+		}
+	}
+	return probe
+}
+
+// describeInput summarizes ffprobe's output for an input, including the
+// keyframe interval of its first video stream
+func describeInput(result *ffprobeOutput) *models.InputProbe {
+	probe := describeStreams(result)
+
+	videoIndex := -1
+	for _, stream := range result.Streams {
+		if stream.CodecType == "video" {
+			videoIndex = stream.Index
+			break
+		}
+	}
+
+	var keyframes keyframeGaps
+	for _, packet := range result.Packets {
+		if packet.StreamIndex != videoIndex || !strings.HasPrefix(packet.Flags, "K") {
+			continue
+		}
+		pts, err := strconv.ParseFloat(packet.PTSTime, 64)
+		if err != nil {
+			continue
+		}
+		keyframes.add(pts)
+	}
+
+	finishInputProbe(probe, &keyframes)
+	return probe
+}
+
+// parseFrameRate parses an ffprobe rational frame rate such as "30000/1001",
+// returning 0 if it is unknown
+func parseFrameRate(rate string) float64 {
+	numerator, denominator, ok := strings.Cut(rate, "/")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseFloat(numerator, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(denominator, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
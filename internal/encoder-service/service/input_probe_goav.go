@@ -0,0 +1,137 @@
+//go:build goav
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/giorgisio/goav/avcodec"
+	"github.com/giorgisio/goav/avformat"
+	"github.com/giorgisio/goav/avutil"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+const (
+	// avPacketFlagKey is AV_PKT_FLAG_KEY, set on packets holding a keyframe
+	avPacketFlagKey = 0x0001
+
+	// avNoPTS is AV_NOPTS_VALUE, the timestamp of packets without one
+	avNoPTS = math.MinInt64
+)
+
+// networkInit initializes libavformat's network protocols once per process
+var networkInit sync.Once
+
+// probeInput reads the first seconds of an RTMP input and describes its video
+// and audio, with warnings about poor publisher settings. onStreams receives
+// the description of the streams as soon as they are known, before the
+// keyframe interval has been measured. The probe is cancelled with ctx.
+//
+// Builds with the goav tag probe through libavformat, over one connection.
+// libavformat cannot be interrupted by ctx, so every read times out instead
+// of waiting on a publisher that stopped sending, and ctx is checked between
+// packets.
+func probeInput(
+	ctx context.Context,
+	rtmpURL string,
+	onStreams func(*models.InputProbe),
+) (*models.InputProbe, error) {
+	networkInit.Do(func() { avformat.AvformatNetworkInit() })
+	deadline := time.Now().Add(inputProbeTimeout)
+
+	var options *avutil.Dictionary
+	avutil.AvDictSet(&options, "rw_timeout", strconv.FormatInt(inputProbeTimeout.Microseconds(), 10), 0)
+	defer avutil.AvDictFree(&options)
+
+	formatCtx := avformat.AvformatAllocContext()
+	if code := avformat.AvformatOpenInput(&formatCtx, rtmpURL, nil, &options); code != 0 {
+		return nil, fmt.Errorf("failed to open input: libavformat error %d", code)
+	}
+	defer formatCtx.AvformatCloseInput()
+
+	if code := formatCtx.AvformatFindStreamInfo(nil); code < 0 {
+		return nil, fmt.Errorf("failed to read stream info: libavformat error %d", code)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	probe := &models.InputProbe{Warnings: []string{}}
+	videoIndex := -1
+	var timeBase float64
+	for i, stream := range formatCtx.Streams() {
+		codec := stream.Codec()
+		switch mediaType := stream.CodecParameters().AvCodecGetType(); {
+		case mediaType == avformat.AVMEDIA_TYPE_VIDEO && videoIndex < 0:
+			videoIndex = i
+			timeBase = rationalValue(stream.TimeBase())
+			probe.VideoCodec = avcodec.AvcodecGetName(avcodec.CodecId(codec.GetCodecId()))
+			probe.Width = codec.GetWidth()
+			probe.Height = codec.GetHeight()
+			probe.FrameRate = rationalValue(stream.AvgFrameRate())
+			if probe.FrameRate == 0 {
+				probe.FrameRate = rationalValue(stream.RFrameRate())
+			}
+		case mediaType == avformat.AVMEDIA_TYPE_AUDIO && probe.AudioCodec == "":
+			probe.AudioCodec = avcodec.AvcodecGetName(avcodec.CodecId(codec.GetCodecId()))
+			probe.AudioSampleRate = codec.GetSampleRate()
+			probe.AudioChannels = codec.GetChannels()
+		}
+	}
+
+	streams := *probe
+	onStreams(&streams)
+
+	// The keyframe interval is measured over inputProbeWindow of video
+	var keyframes keyframeGaps
+	if videoIndex >= 0 {
+		packet := avcodec.AvPacketAlloc()
+		defer avutil.AvFree(unsafe.Pointer(packet))
+
+		var start float64
+		started := false
+		for ctx.Err() == nil && time.Now().Before(deadline) {
+			// The input ended or a read timed out
+			if formatCtx.AvReadFrame(packet) < 0 {
+				break
+			}
+			index, flags, pts := packet.StreamIndex(), packet.Flags(), packet.Pts()
+			packet.AvFreePacket()
+			if index != videoIndex || pts == avNoPTS {
+				continue
+			}
+
+			seconds := float64(pts) * timeBase
+			if !started {
+				start, started = seconds, true
+			}
+			if seconds-start >= inputProbeWindow.Seconds() {
+				break
+			}
+			if flags&avPacketFlagKey != 0 {
+				keyframes.add(seconds)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	finishInputProbe(probe, &keyframes)
+	return probe, nil
+}
+
+// rationalValue converts a libavutil rational, returning 0 if it is unknown
+func rationalValue(r avcodec.Rational) float64 {
+	if r.Den() == 0 {
+		return 0
+	}
+	return float64(r.Num()) / float64(r.Den())
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+func TestFinishInputProbe(t *testing.T) {
+	tests := []struct {
+		name         string
+		probe        models.InputProbe
+		keyframes    []float64
+		wantInterval float64
+		wantWarnings []string
+	}{
+		{
+			name:         "2-second keyframe interval",
+			probe:        models.InputProbe{VideoCodec: "h264", AudioCodec: "aac"},
+			keyframes:    []float64{10, 12, 14, 16},
+			wantInterval: 2,
+			wantWarnings: []string{},
+		},
+		{
+			name:         "longest gap counts",
+			probe:        models.InputProbe{VideoCodec: "h264", AudioCodec: "aac"},
+			keyframes:    []float64{0, 2, 7},
+			wantInterval: 5,
+			wantWarnings: []string{"keyframe interval is 5.0s; set it to 2s (at most 4s) in the encoder"},
+		},
+		{
+			name:         "one keyframe",
+			probe:        models.InputProbe{VideoCodec: "h264", AudioCodec: "aac"},
+			keyframes:    []float64{3},
+			wantWarnings: []string{"fewer than two keyframes in 8s; set the keyframe interval to 2s in the encoder"},
+		},
+		{
+			name:         "audio only",
+			probe:        models.InputProbe{AudioCodec: "aac"},
+			wantWarnings: []string{"no video stream"},
+		},
+		{
+			name:         "video only",
+			probe:        models.InputProbe{VideoCodec: "h264"},
+			keyframes:    []float64{0, 2},
+			wantInterval: 2,
+			wantWarnings: []string{"no audio stream"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe := tt.probe
+			probe.Warnings = []string{}
+			var keyframes keyframeGaps
+			for _, pts := range tt.keyframes {
+				keyframes.add(pts)
+			}
+
+			finishInputProbe(&probe, &keyframes)
+			if probe.KeyframeInterval != tt.wantInterval {
+				t.Errorf("KeyframeInterval = %v, want %v", probe.KeyframeInterval, tt.wantInterval)
+			}
+			if !reflect.DeepEqual(probe.Warnings, tt.wantWarnings) {
+				t.Errorf("Warnings = %q, want %q", probe.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// llhlsPartTarget is the duration of LL-HLS partial segments, the length
+	// of the fragments FFmpeg writes low-latency segments in
+	llhlsPartTarget = 500 * time.Millisecond
+
+	// llhlsPollInterval is how often a blocked request looks for new parts
+	llhlsPollInterval = 50 * time.Millisecond
+
+	// llhlsPartWindow is the number of target durations from the live edge
+	// within which segments keep their parts listed
+	llhlsPartWindow = 3
+
+	// tempSuffix is appended by FFmpeg to a segment's name while writing it
+	tempSuffix = ".tmp"
+)
+
+var (
+	// ErrBlockingRequestTooFar is returned for a blocking playlist request
+	// for a segment more than two segments after the live edge
+	ErrBlockingRequestTooFar = errors.New("requested segment is too far ahead of the playlist")
+
+	// ErrPlaylistNotReady is returned when a blocking request is not
+	// satisfied within three target durations, or encoding stops
+	ErrPlaylistNotReady = errors.New("playlist was not updated in time")
+)
+
+var (
+	// initNamePattern matches CMAF initialization segment names,
+	// init_{start}_{representation}.mp4
+	initNamePattern = regexp.MustCompile(`^init_(\d+)_(\d+)\.mp4$`)
+
+	// segmentNamePattern matches CMAF media segment names,
+	// segment_{start}_{representation}_{number}.m4s
+	segmentNamePattern = regexp.MustCompile(`^segment_(\d+)_(\d+)_(\d+)\.m4s$`)
+
+	// partNamePattern matches partial segment names, {segment}.part{n}.m4s
+	partNamePattern = regexp.MustCompile(`^(segment_\d+_\d+_\d+)\.part(\d+)\.m4s$`)
+)
+
+// LLHLSOutput serves the LL-HLS playlists and partial segments of a stream
+// encoded in low-latency mode from the encoder's local output, ahead of
+// storage. FFmpeg writes low-latency segments as a series of fragments,
+// each of which is a partial segment, so parts of the segment in progress
+// are read from its file while FFmpeg is still writing it.
+type LLHLSOutput struct {
+	dir           string
+	segmentTarget int
+	done          chan struct{}
+	stopOnce      sync.Once
+
+	mu sync.Mutex
+	// tracks caches the track defaults of initialization segments by name
+	tracks map[string]*fmp4Track
+}
+
+// newLLHLSOutput creates the LL-HLS output of a stream encoded to dir with
+// segments of segmentDuration seconds
+func newLLHLSOutput(dir string, segmentDuration int) *LLHLSOutput {
+	return &LLHLSOutput{
+		dir:           dir,
+		segmentTarget: segmentDuration,
+		done:          make(chan struct{}),
+		tracks:        make(map[string]*fmp4Track),
+	}
+}
+
+// stop releases blocked requests once encoding is over
+func (o *LLHLSOutput) stop() {
+	o.stopOnce.Do(func() { close(o.done) })
+}
+
+// llhlsSegment is a media segment of a representation with its parts
+type llhlsSegment struct {
+	name     string
+	number   int64 // media sequence number
+	duration float64
+	parts    []fmp4Fragment
+}
+
+// llhlsPlaylist is the state of a representation: its complete segments
+// followed by the segment in progress
+type llhlsPlaylist struct {
+	initSegment string
+	segments    []*llhlsSegment
+}
+
+// live returns the segment in progress
+func (p *llhlsPlaylist) live() *llhlsSegment {
+	return p.segments[len(p.segments)-1]
+}
+
+// contains reports whether the playlist holds media segment msn, or its part
+// `part` if part is not negative
+func (p *llhlsPlaylist) contains(msn, part int64) bool {
+	live := p.live()
+	if msn != live.number {
+		return msn < live.number
+	}
+	return part >= 0 && part < int64(len(live.parts))
+}
+
+// Playlist returns the LL-HLS version of the media playlist name. If msn is
+// not negative it blocks until the playlist holds media segment msn, or its
+// part `part` if that is not negative, as the _HLS_msn and _HLS_part query
+// parameters ask. It returns ErrFileNotFound for names that are not CMAF
+// media playlists, which are served from storage instead.
+func (o *LLHLSOutput) Playlist(ctx context.Context, name string, msn, part int64) ([]byte, error) {
+	timeout := time.NewTimer(3 * time.Duration(o.segmentTarget) * time.Second)
+	defer timeout.Stop()
+	ticker := time.NewTicker(llhlsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		playlist, err := o.readPlaylist(name)
+		if err != nil {
+			return nil, err
+		}
+		if msn < 0 || playlist.contains(msn, part) {
+			return o.render(playlist), nil
+		}
+		if msn > playlist.live().number+2 {
+			return nil, ErrBlockingRequestTooFar
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			return nil, ErrPlaylistNotReady
+		case <-o.done:
+			return nil, ErrPlaylistNotReady
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// readPlaylist reads a representation's state from the media playlist FFmpeg
+// writes for it and the segment FFmpeg is writing
+func (o *LLHLSOutput) readPlaylist(name string) (*llhlsPlaylist, error) {
+	if matched, _ := filepath.Match(cmafPlaylistPattern, name); !matched {
+		return nil, ErrFileNotFound
+	}
+
+	source, err := readMediaPlaylist(filepath.Join(o.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+
+	match := initNamePattern.FindStringSubmatch(source.InitSegment)
+	if match == nil {
+		return nil, fmt.Errorf("%s: unexpected initialization segment %q", name, source.InitSegment)
+	}
+	track, err := o.track(source.InitSegment)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist := &llhlsPlaylist{initSegment: source.InitSegment}
+	next := int64(1)
+	for i, segmentName := range source.Segments {
+		number, ok := segmentNumber(segmentName)
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected segment %q", name, segmentName)
+		}
+		playlist.segments = append(playlist.segments, &llhlsSegment{
+			name:     segmentName,
+			number:   number,
+			duration: source.Durations[i],
+		})
+		next = number + 1
+	}
+
+	// Segments near the live edge keep their parts listed
+	var fromEdge float64
+	for i := len(playlist.segments) - 1; i >= 0; i-- {
+		if fromEdge >= float64(llhlsPartWindow*o.segmentTarget) {
+			break
+		}
+		segment := playlist.segments[i]
+		segment.parts, err = readFMP4Fragments(filepath.Join(o.dir, segment.name), track)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		fromEdge += segment.duration
+	}
+
+	// The segment in progress is the one after the last listed, and may
+	// have been completed since the playlist was written
+	live := &llhlsSegment{
+		name:   fmt.Sprintf("segment_%s_%s_%05d.m4s", match[1], match[2], next),
+		number: next,
+	}
+	live.parts, _, err = o.readParts(live.name, track)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	playlist.segments = append(playlist.segments, live)
+
+	return playlist, nil
+}
+
+// readParts returns the complete parts of a segment, read from its file while
+// FFmpeg writes it or once it is done, and the path they were read from
+func (o *LLHLSOutput) readParts(segmentName string, track *fmp4Track) ([]fmp4Fragment, string, error) {
+	segmentPath := filepath.Join(o.dir, segmentName)
+	for _, path := range []string{segmentPath + tempSuffix, segmentPath} {
+		parts, err := readFMP4Fragments(path, track)
+		if err == nil || !os.IsNotExist(err) {
+			return parts, path, err
+		}
+	}
+	return nil, "", os.ErrNotExist
+}
+
+// track returns the track defaults of an initialization segment
+func (o *LLHLSOutput) track(initSegment string) (*fmp4Track, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if track, ok := o.tracks[initSegment]; ok {
+		return track, nil
+	}
+	track, err := readFMP4Track(filepath.Join(o.dir, initSegment))
+	if err != nil {
+		return nil, err
+	}
+	o.tracks[initSegment] = track
+	return track, nil
+}
+
+// render writes a playlist as an LL-HLS media playlist. Parts are listed by
+// their own URIs, which OpenFile maps to a range of their segment.
+func (o *LLHLSOutput) render(playlist *llhlsPlaylist) []byte {
+	targetDuration := o.segmentTarget
+	for _, segment := range playlist.segments {
+		targetDuration = max(targetDuration, int(math.Ceil(segment.duration)))
+	}
+	partTarget := llhlsPartTarget.Seconds()
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:6\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*partTarget)
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partTarget)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", playlist.segments[0].number)
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=%q\n", playlist.initSegment)
+
+	for i, segment := range playlist.segments {
+		for n, part := range segment.parts {
+			fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=%q", part.duration, partName(segment.name, n))
+			if part.independent {
+				b.WriteString(",INDEPENDENT=YES")
+			}
+			b.WriteString("\n")
+		}
+		if i < len(playlist.segments)-1 {
+			fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", segment.duration, segment.name)
+		}
+	}
+
+	live := playlist.live()
+	fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=%q\n", partName(live.name, len(live.parts)))
+
+	return []byte(b.String())
+}
+
+// LocalFile is a segment, or a part of one, read from the encoder's disk
+type LocalFile struct {
+	*io.SectionReader
+	file *os.File
+}
+
+// Close closes the underlying file
+func (f *LocalFile) Close() error {
+	return f.file.Close()
+}
+
+// OpenFile opens a segment, initialization segment or part of the output. A
+// part of the segment in progress that FFmpeg has not finished yet, such as
+// the one a preload hint names, is waited for. It returns ErrFileNotFound
+// for files that are not on disk, which are served from storage instead.
+func (o *LLHLSOutput) OpenFile(ctx context.Context, name string) (*LocalFile, error) {
+	match := partNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		if initNamePattern.MatchString(name) || segmentNamePattern.MatchString(name) {
+			return openLocalFile(filepath.Join(o.dir, name), 0, -1)
+		}
+		return nil, ErrFileNotFound
+	}
+
+	segmentName := match[1] + ".m4s"
+	index, err := strconv.Atoi(match[2])
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+	segment := segmentNamePattern.FindStringSubmatch(segmentName)
+	track, err := o.track(fmt.Sprintf("init_%s_%s.mp4", segment[1], segment[2]))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+
+	timeout := time.NewTimer(3 * time.Duration(o.segmentTarget) * time.Second)
+	defer timeout.Stop()
+	ticker := time.NewTicker(llhlsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		parts, path, err := o.readParts(segmentName, track)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, ErrFileNotFound
+			}
+			return nil, err
+		}
+		if index < len(parts) {
+			return openLocalFile(path, parts[index].offset, parts[index].length)
+		}
+		// A finished segment gets no more parts
+		if !strings.HasSuffix(path, tempSuffix) {
+			return nil, ErrFileNotFound
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			return nil, ErrFileNotFound
+		case <-o.done:
+			return nil, ErrFileNotFound
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// openLocalFile opens length bytes of a file from offset, or the whole file
+// if length is negative
+func openLocalFile(path string, offset, length int64) (*LocalFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	if length < 0 {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		length = info.Size()
+	}
+	return &LocalFile{SectionReader: io.NewSectionReader(file, offset, length), file: file}, nil
+}
+
+// partName returns the URI of part n of a segment
+func partName(segmentName string, n int) string {
+	return fmt.Sprintf("%s.part%d.m4s", strings.TrimSuffix(segmentName, ".m4s"), n)
+}
+
+// segmentNumber returns the media sequence number in a CMAF segment name
+func segmentNumber(name string) (int64, bool) {
+	match := segmentNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return 0, false
+	}
+	number, err := strconv.ParseInt(match[3], 10, 64)
+	return number, err == nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLLHLSRender(t *testing.T) {
+	keyframe := fmp4Fragment{duration: 0.5, independent: true}
+	delta := fmp4Fragment{duration: 0.5}
+
+	tests := []struct {
+		name     string
+		playlist *llhlsPlaylist
+		want     []string
+	}{
+		{
+			name: "parts near the live edge",
+			playlist: &llhlsPlaylist{
+				initSegment: "init_0_0.mp4",
+				segments: []*llhlsSegment{
+					{name: "segment_0_0_00004.m4s", number: 4, duration: 1},
+					{name: "segment_0_0_00005.m4s", number: 5, duration: 1, parts: []fmp4Fragment{keyframe, delta}},
+					{name: "segment_0_0_00006.m4s", number: 6, parts: []fmp4Fragment{keyframe}},
+				},
+			},
+			want: []string{
+				"#EXTM3U",
+				"#EXT-X-VERSION:6",
+				"#EXT-X-TARGETDURATION:1",
+				"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=1.500",
+				"#EXT-X-PART-INF:PART-TARGET=0.500",
+				"#EXT-X-MEDIA-SEQUENCE:4",
+				`#EXT-X-MAP:URI="init_0_0.mp4"`,
+				"#EXTINF:1.000,",
+				"segment_0_0_00004.m4s",
+				`#EXT-X-PART:DURATION=0.500,URI="segment_0_0_00005.part0.m4s",INDEPENDENT=YES`,
+				`#EXT-X-PART:DURATION=0.500,URI="segment_0_0_00005.part1.m4s"`,
+				"#EXTINF:1.000,",
+				"segment_0_0_00005.m4s",
+				`#EXT-X-PART:DURATION=0.500,URI="segment_0_0_00006.part0.m4s",INDEPENDENT=YES`,
+				`#EXT-X-PRELOAD-HINT:TYPE=PART,URI="segment_0_0_00006.part1.m4s"`,
+			},
+		},
+		{
+			name: "long segment raises the target duration",
+			playlist: &llhlsPlaylist{
+				initSegment: "init_0_1.mp4",
+				segments: []*llhlsSegment{
+					{name: "segment_0_1_00001.m4s", number: 1, duration: 1.2},
+					{name: "segment_0_1_00002.m4s", number: 2},
+				},
+			},
+			want: []string{
+				"#EXTM3U",
+				"#EXT-X-VERSION:6",
+				"#EXT-X-TARGETDURATION:2",
+				"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=1.500",
+				"#EXT-X-PART-INF:PART-TARGET=0.500",
+				"#EXT-X-MEDIA-SEQUENCE:1",
+				`#EXT-X-MAP:URI="init_0_1.mp4"`,
+				"#EXTINF:1.200,",
+				"segment_0_1_00001.m4s",
+				`#EXT-X-PRELOAD-HINT:TYPE=PART,URI="segment_0_1_00002.part0.m4s"`,
+			},
+		},
+	}
+
+	output := newLLHLSOutput(t.TempDir(), 1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(output.render(tt.playlist))
+			want := strings.Join(tt.want, "\n") + "\n"
+			if got != want {
+				t.Errorf("render() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestLLHLSPlaylistContains(t *testing.T) {
+	playlist := &llhlsPlaylist{
+		segments: []*llhlsSegment{
+			{number: 7},
+			{number: 8, parts: make([]fmp4Fragment, 2)},
+		},
+	}
+
+	tests := []struct {
+		msn, part int64
+		want      bool
+	}{
+		{7, -1, true},
+		{7, 5, true},
+		{8, -1, false},
+		{8, 0, true},
+		{8, 1, true},
+		{8, 2, false},
+		{9, 0, false},
+	}
+
+	for _, tt := range tests {
+		if got := playlist.contains(tt.msn, tt.part); got != tt.want {
+			t.Errorf("contains(%d, %d) = %v, want %v", tt.msn, tt.part, got, tt.want)
+		}
+	}
+}
+
+func TestSegmentNumberAndPartName(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantNumber int64
+		wantOK     bool
+		wantPart   string
+	}{
+		{"segment_0_0_00001.m4s", 1, true, "segment_0_0_00001.part3.m4s"},
+		{"segment_1760000000_2_12345.m4s", 12345, true, "segment_1760000000_2_12345.part3.m4s"},
+		{"segment_0_0_00001.m4s.tmp", 0, false, ""},
+		{"init_0_0.mp4", 0, false, ""},
+		{"segment_0_00001.m4s", 0, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			number, ok := segmentNumber(tt.name)
+			if number != tt.wantNumber || ok != tt.wantOK {
+				t.Errorf("segmentNumber() = %d, %v, want %d, %v", number, ok, tt.wantNumber, tt.wantOK)
+			}
+			if ok && partName(tt.name, 3) != tt.wantPart {
+				t.Errorf("partName() = %q, want %q", partName(tt.name, 3), tt.wantPart)
+			}
+		})
+	}
+}
+
+func TestLLHLSOutputPlaylist(t *testing.T) {
+	// FFmpeg has listed segment 1 and is writing segment 2, which has one of
+	// its two parts so far
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"init_0_0.mp4": testInitSegment(1000, 0, 0),
+		"media_0.m3u8": []byte("#EXTM3U\n#EXT-X-MAP:URI=\"init_0_0.mp4\"\n" +
+			"#EXTINF:1.000,\nsegment_0_0_00001.m4s\n"),
+		"segment_0_0_00001.m4s":     append(testFragment(true, 16, 250, 250), testFragment(false, 16, 250, 250)...),
+		"segment_0_0_00002.m4s.tmp": testFragment(true, 16, 250, 250),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output := newLLHLSOutput(dir, 1)
+	defer output.stop()
+
+	// Requests the playlist cannot satisfy yet block until ctx is done
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name      string
+		playlist  string
+		msn, part int64
+		wantErr   error
+	}{
+		{"not blocking", "media_0.m3u8", -1, -1, nil},
+		{"complete segment", "media_0.m3u8", 1, -1, nil},
+		{"part of the live segment", "media_0.m3u8", 2, 0, nil},
+		{"next part", "media_0.m3u8", 2, 1, context.Canceled},
+		{"too far ahead", "media_0.m3u8", 5, -1, ErrBlockingRequestTooFar},
+		{"not a CMAF playlist", "index.m3u8", -1, -1, ErrFileNotFound},
+		{"missing playlist", "media_1.m3u8", -1, -1, ErrFileNotFound},
+	}
+
+	want := strings.Join([]string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:6",
+		"#EXT-X-TARGETDURATION:1",
+		"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=1.500",
+		"#EXT-X-PART-INF:PART-TARGET=0.500",
+		"#EXT-X-MEDIA-SEQUENCE:1",
+		`#EXT-X-MAP:URI="init_0_0.mp4"`,
+		`#EXT-X-PART:DURATION=0.500,URI="segment_0_0_00001.part0.m4s",INDEPENDENT=YES`,
+		`#EXT-X-PART:DURATION=0.500,URI="segment_0_0_00001.part1.m4s"`,
+		"#EXTINF:1.000,",
+		"segment_0_0_00001.m4s",
+		`#EXT-X-PART:DURATION=0.500,URI="segment_0_0_00002.part0.m4s",INDEPENDENT=YES`,
+		`#EXT-X-PRELOAD-HINT:TYPE=PART,URI="segment_0_0_00002.part1.m4s"`,
+	}, "\n") + "\n"
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := output.Playlist(cancelled, tt.playlist, tt.msn, tt.part)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Playlist() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != want {
+				t.Errorf("Playlist() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+// LocalStorage is a Storage that keeps files in a directory on local disk,
+// for single-node deployments without an object store
+type LocalStorage struct {
+	logger     *zap.Logger
+	rootDir    string
+	cdnBaseURL string
+}
+
+// NewLocalStorage creates a local disk storage backend rooted at rootDir
+func NewLocalStorage(logger *zap.Logger, rootDir, cdnBaseURL string) (*LocalStorage, error) {
+	if rootDir == "" {
+		return nil, fmt.Errorf("local storage path is required")
+	}
+
+	if err := os.MkdirAll(rootDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &LocalStorage{
+		logger:     logger,
+		rootDir:    rootDir,
+		cdnBaseURL: cdnBaseURL,
+	}, nil
+}
+
+// UploadFile copies a file into the storage directory
+func (s *LocalStorage) UploadFile(localPath, key string) error {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	if err := s.writeFile(key, src); err != nil {
+		return err
+	}
+
+	s.logger.Debug("Stored file on local disk",
+		zap.String("local_path", localPath),
+		zap.String("key", key),
+	)
+
+	return nil
+}
+
+// CopyFile copies a file within the storage directory
+func (s *LocalStorage) CopyFile(srcKey, dstKey string) error {
+	srcPath, err := s.path(srcKey)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	return s.writeFile(dstKey, src)
+}
+
+// writeFile stores the content of src under key. It is written to a
+// temporary file and renamed so readers never see a partial file.
+func (s *LocalStorage) writeFile(key string, src io.Reader) error {
+	dstPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dstPath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dstPath); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return nil
+}
+
+// StatFile returns the metadata of a file in the storage directory
+func (s *LocalStorage) StatFile(key string) (*models.StorageFile, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, ErrFileNotFound
+	}
+
+	return localStorageFile(key, info), nil
+}
+
+// OpenFile opens a file in the storage directory for reading from offset
+func (s *LocalStorage) OpenFile(key string, offset int64) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to seek file: %w", err)
+		}
+	}
+
+	return file, nil
+}
+
+// ListFiles lists all files whose key starts with prefix
+func (s *LocalStorage) ListFiles(prefix string) ([]*models.StorageFile, error) {
+	var files []*models.StorageFile
+	err := filepath.WalkDir(s.rootDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(s.rootDir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relPath)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, localStorageFile(key, info))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	return files, nil
+}
+
+// DeleteFile deletes a file from the storage directory
+func (s *LocalStorage) DeleteFile(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return nil
+}
+
+// GetPublicURL returns the URL for key on the CDN or the encoder's own routes
+func (s *LocalStorage) GetPublicURL(tenantPrefix, key string) string {
+	return originURL(s.cdnBaseURL, tenantPrefix, key)
+}
+
+// localStorageFile describes a stored file. Files are replaced by rename on
+// every upload, so modification time and size identify a version.
+func localStorageFile(key string, info fs.FileInfo) *models.StorageFile {
+	return &models.StorageFile{
+		Key:          key,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+		ETag:         fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		ContentType:  contentTypeFor(filepath.Ext(key)),
+	}
+}
+
+// path maps a key to a path inside the storage directory
+func (s *LocalStorage) path(key string) (string, error) {
+	cleanKey := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleanKey) || cleanKey == ".." ||
+		strings.HasPrefix(cleanKey, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.rootDir, cleanKey), nil
+}
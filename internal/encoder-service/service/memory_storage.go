@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+// MemoryStorage is a Storage that keeps files in memory. Nothing survives a
+// restart, so it is meant for development and tests.
+type MemoryStorage struct {
+	logger     *zap.Logger
+	cdnBaseURL string
+	files      map[string]*memoryFile
+	mu         sync.RWMutex
+}
+
+// memoryFile is a file held by MemoryStorage
+type memoryFile struct {
+	content      []byte
+	lastModified time.Time
+	etag         string
+}
+
+// storageFile describes the file as stored under key
+func (f *memoryFile) storageFile(key string) *models.StorageFile {
+	return &models.StorageFile{
+		Key:          key,
+		Size:         int64(len(f.content)),
+		LastModified: f.lastModified,
+		ETag:         f.etag,
+		ContentType:  contentTypeFor(filepath.Ext(key)),
+	}
+}
+
+// NewMemoryStorage creates an in-memory storage backend
+func NewMemoryStorage(logger *zap.Logger, cdnBaseURL string) *MemoryStorage {
+	return &MemoryStorage{
+		logger:     logger,
+		cdnBaseURL: cdnBaseURL,
+		files:      make(map[string]*memoryFile),
+	}
+}
+
+// UploadFile reads a local file into memory under key
+func (s *MemoryStorage) UploadFile(localPath, key string) error {
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	sum := md5.Sum(content)
+	file := &memoryFile{
+		content:      content,
+		lastModified: time.Now(),
+		etag:         hex.EncodeToString(sum[:]),
+	}
+
+	s.mu.Lock()
+	s.files[key] = file
+	s.mu.Unlock()
+
+	return nil
+}
+
+// CopyFile stores the file under srcKey under dstKey as well. Uploads replace
+// files rather than modifying them, so both keys can share it.
+func (s *MemoryStorage) CopyFile(srcKey, dstKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, exists := s.files[srcKey]
+	if !exists {
+		return ErrFileNotFound
+	}
+	s.files[dstKey] = file
+
+	return nil
+}
+
+// StatFile returns the metadata of the file stored under key
+func (s *MemoryStorage) StatFile(key string) (*models.StorageFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file, exists := s.files[key]
+	if !exists {
+		return nil, ErrFileNotFound
+	}
+
+	return file.storageFile(key), nil
+}
+
+// OpenFile returns a reader over the file stored under key, from offset
+func (s *MemoryStorage) OpenFile(key string, offset int64) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file, exists := s.files[key]
+	if !exists {
+		return nil, ErrFileNotFound
+	}
+	if offset > int64(len(file.content)) {
+		offset = int64(len(file.content))
+	}
+
+	// Uploads replace the slice rather than modifying it, so it is safe to
+	// read after the lock is released
+	return io.NopCloser(bytes.NewReader(file.content[offset:])), nil
+}
+
+// ListFiles lists all files whose key starts with prefix, sorted by key
+func (s *MemoryStorage) ListFiles(prefix string) ([]*models.StorageFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var files []*models.StorageFile
+	for key, file := range s.files {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		files = append(files, file.storageFile(key))
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	return files, nil
+}
+
+// DeleteFile removes the file stored under key
+func (s *MemoryStorage) DeleteFile(key string) error {
+	s.mu.Lock()
+	delete(s.files, key)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// GetPublicURL returns the URL for key on the CDN or the encoder's own routes
+func (s *MemoryStorage) GetPublicURL(tenantPrefix, key string) string {
+	return originURL(s.cdnBaseURL, tenantPrefix, key)
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// newTestMemoryStorage returns a memory storage holding files, keyed by
+// storage key
+func newTestMemoryStorage(t *testing.T, files map[string]string) *MemoryStorage {
+	t.Helper()
+
+	storage := NewMemoryStorage(zap.NewNop(), "")
+	dir := t.TempDir()
+	for key, content := range files {
+		localPath := filepath.Join(dir, "upload")
+		if err := os.WriteFile(localPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.UploadFile(localPath, key); err != nil {
+			t.Fatalf("UploadFile(%q) error = %v", key, err)
+		}
+	}
+	return storage
+}
+
+func TestMemoryStorageOpenFile(t *testing.T) {
+	storage := newTestMemoryStorage(t, map[string]string{"hls/abc/segment_1.ts": "0123456789"})
+
+	tests := []struct {
+		name    string
+		key     string
+		offset  int64
+		want    string
+		wantErr error
+	}{
+		{"whole file", "hls/abc/segment_1.ts", 0, "0123456789", nil},
+		{"from offset", "hls/abc/segment_1.ts", 4, "456789", nil},
+		{"offset at end", "hls/abc/segment_1.ts", 10, "", nil},
+		{"offset past end", "hls/abc/segment_1.ts", 25, "", nil},
+		{"missing key", "hls/abc/segment_2.ts", 0, "", ErrFileNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := storage.OpenFile(tt.key, tt.offset)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("OpenFile() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer reader.Close()
+
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("OpenFile() read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStorageStatFile(t *testing.T) {
+	storage := newTestMemoryStorage(t, map[string]string{
+		"hls/abc/master.m3u8":  "#EXTM3U\n",
+		"hls/abc/segment_1.ts": "segment",
+		"thumbnails/abc/x.jpg": "jpeg",
+	})
+
+	tests := []struct {
+		key             string
+		wantSize        int64
+		wantContentType string
+	}{
+		{"hls/abc/master.m3u8", 8, "application/vnd.apple.mpegurl"},
+		{"hls/abc/segment_1.ts", 7, "video/mp2t"},
+		{"thumbnails/abc/x.jpg", 4, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			file, err := storage.StatFile(tt.key)
+			if err != nil {
+				t.Fatalf("StatFile() error = %v", err)
+			}
+			if file.Key != tt.key || file.Size != tt.wantSize || file.ContentType != tt.wantContentType {
+				t.Errorf("StatFile() = %+v, want key %q, size %d, content type %q",
+					file, tt.key, tt.wantSize, tt.wantContentType)
+			}
+			if file.ETag == "" {
+				t.Error("StatFile() returned no ETag")
+			}
+		})
+	}
+}
+
+func TestMemoryStorageListFiles(t *testing.T) {
+	storage := newTestMemoryStorage(t, map[string]string{
+		"hls/abc/master.m3u8":          "a",
+		"hls/abc/720p/segment_2.ts":    "b",
+		"hls/abc/720p/segment_1.ts":    "c",
+		"hls/abcd/master.m3u8":         "d",
+		"tenant/hls/abc/master.m3u8":   "e",
+		"recordings/abc/12/index.m3u8": "f",
+	})
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"hls/abc/", []string{"hls/abc/720p/segment_1.ts", "hls/abc/720p/segment_2.ts", "hls/abc/master.m3u8"}},
+		{"hls/abc", []string{
+			"hls/abc/720p/segment_1.ts", "hls/abc/720p/segment_2.ts", "hls/abc/master.m3u8", "hls/abcd/master.m3u8",
+		}},
+		{"tenant/", []string{"tenant/hls/abc/master.m3u8"}},
+		{"missing/", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			files, err := storage.ListFiles(tt.prefix)
+			if err != nil {
+				t.Fatalf("ListFiles() error = %v", err)
+			}
+			var got []string
+			for _, file := range files {
+				got = append(got, file.Key)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ListFiles(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ListFiles(%q) = %v, want %v", tt.prefix, got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStorageCopyAndDeleteFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		copyFrom    string
+		deleteKey   string
+		wantCopyErr error
+		wantKeys    map[string]bool // key: whether it must still exist
+	}{
+		{
+			name:      "copy survives deleting the source",
+			copyFrom:  "hls/abc/segment_1.ts",
+			deleteKey: "hls/abc/segment_1.ts",
+			wantKeys:  map[string]bool{"hls/abc/segment_1.ts": false, "recordings/abc/1/segment_1.ts": true},
+		},
+		{
+			name:      "deleting the copy keeps the source",
+			copyFrom:  "hls/abc/segment_1.ts",
+			deleteKey: "recordings/abc/1/segment_1.ts",
+			wantKeys:  map[string]bool{"hls/abc/segment_1.ts": true, "recordings/abc/1/segment_1.ts": false},
+		},
+		{
+			name:        "copying a missing file",
+			copyFrom:    "hls/abc/segment_9.ts",
+			deleteKey:   "hls/abc/segment_9.ts",
+			wantCopyErr: ErrFileNotFound,
+			wantKeys:    map[string]bool{"hls/abc/segment_1.ts": true, "recordings/abc/1/segment_1.ts": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestMemoryStorage(t, map[string]string{"hls/abc/segment_1.ts": "segment"})
+
+			err := storage.CopyFile(tt.copyFrom, "recordings/abc/1/segment_1.ts")
+			if !errors.Is(err, tt.wantCopyErr) {
+				t.Fatalf("CopyFile() error = %v, want %v", err, tt.wantCopyErr)
+			}
+			// Deleting a missing file is not an error
+			if err := storage.DeleteFile(tt.deleteKey); err != nil {
+				t.Fatalf("DeleteFile() error = %v", err)
+			}
+
+			for key, wantExists := range tt.wantKeys {
+				_, err := storage.StatFile(key)
+				if exists := err == nil; exists != wantExists {
+					t.Errorf("after delete, %q exists = %v, want %v", key, exists, wantExists)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStorageGetPublicURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		cdnBaseURL   string
+		tenantPrefix string
+		key          string
+		want         string
+	}{
+		{"origin", "", "acme", "hls/abc/master.m3u8", "/hls/abc/master.m3u8"},
+		{"cdn with tenant", "https://cdn.example.com/", "acme", "hls/abc/master.m3u8",
+			"https://cdn.example.com/acme/hls/abc/master.m3u8"},
+		{"cdn for default tenant", "https://cdn.example.com", "", "hls/abc/master.m3u8",
+			"https://cdn.example.com/hls/abc/master.m3u8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := NewMemoryStorage(zap.NewNop(), tt.cdnBaseURL)
+			if got := storage.GetPublicURL(tt.tenantPrefix, tt.key); got != tt.want {
+				t.Errorf("GetPublicURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+// vodPlaylistPath returns the local path of a media playlist's finalized VOD
+// version, next to it
+func vodPlaylistPath(playlistPath string) string {
+	return filepath.Join(filepath.Dir(playlistPath), "vod_"+filepath.Base(playlistPath))
+}
+
+// finalizeRecording turns the event playlists left by FFmpeg into VOD
+// playlists, uploads an encoder's recording and records the result
+func (e *EncoderService) finalizeRecording(encoder *models.StreamEncoder, outputDir string) {
+	recording := encoder.Recording
+	recording.Status = models.RecordingStatusReady
+
+	// Sprites would publish encrypted recordings' frames in the clear
+	videoPlaylist := encoder.VideoPlaylist
+	if encoder.Encrypted {
+		videoPlaylist = ""
+	}
+
+	if err := e.buildRecording(recording, encoder.StoragePrefix, outputDir, videoPlaylist); err != nil {
+		e.logger.Error("Failed to finalize recording",
+			zap.String("stream_key", recording.StreamKey),
+			zap.Int64("recording_id", recording.ID),
+			zap.Error(err),
+		)
+		recording.Status = models.RecordingStatusFailed
+	}
+
+	if err := e.recordingRepo.FinishRecording(recording); err != nil {
+		e.logger.Error("Failed to update recording in database",
+			zap.Int64("recording_id", recording.ID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if recording.Status == models.RecordingStatusReady {
+		e.webhookService.Emit(encoder.OrganizationID, models.WebhookEventRecordingReady, &models.RecordingEventData{
+			RecordingID:     recording.ID,
+			LiveStreamID:    recording.LiveStreamID,
+			PlaybackID:      recording.PlaybackID,
+			StoragePrefix:   recording.StoragePrefix,
+			DurationSeconds: recording.DurationSeconds,
+		})
+	}
+}
+
+// buildRecording writes a VOD playlist per rendition, builds seek preview
+// sprites from the video rendition of videoPlaylist, if any, and uploads the
+// recording under the tenant's storage prefix
+func (e *EncoderService) buildRecording(
+	recording *models.Recording,
+	tenantPrefix, outputDir, videoPlaylist string,
+) error {
+	playlists, err := mediaPlaylists(outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to glob playlists: %w", err)
+	}
+	if len(playlists) == 0 {
+		return fmt.Errorf("no playlists found in %s", outputDir)
+	}
+
+	for i, playlistPath := range playlists {
+		duration, segments, err := writeVODPlaylist(playlistPath, vodPlaylistPath(playlistPath))
+		if err != nil {
+			return err
+		}
+
+		// Renditions share segment boundaries, so any one gives the duration
+		if i == 0 {
+			recording.DurationSeconds = duration
+			recording.SegmentCount = segments
+		}
+	}
+
+	if e.storage == nil {
+		return fmt.Errorf("no storage configured")
+	}
+
+	// A recording without previews is still playable
+	if videoPlaylist != "" {
+		spriteDir := filepath.Join(outputDir, spriteDirName)
+		sheets, err := buildSprites(vodPlaylistPath(videoPlaylist), spriteDir,
+			recording.DurationSeconds)
+		if err != nil {
+			e.logger.Warn("Failed to build recording sprites",
+				zap.Int64("recording_id", recording.ID),
+				zap.Error(err),
+			)
+			os.RemoveAll(spriteDir)
+		}
+		recording.SpriteSheets = sheets
+	}
+
+	recording.StoragePrefix = RecordingPrefix(tenantPrefix, recording.PlaybackID, recording.ID)
+	return UploadRecording(e.logger, e.storage, recording.StoragePrefix,
+		StreamFilesPrefix(tenantPrefix, recording.PlaybackID), outputDir, playlists)
+}
+
+// writeVODPlaylist converts a live or event media playlist into a VOD playlist
+// terminated by EXT-X-ENDLIST. It returns the total duration and segment count.
+func writeVODPlaylist(srcPath, dstPath string) (float64, int, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open playlist: %w", err)
+	}
+	defer src.Close()
+
+	var lines []string
+	var duration float64
+	segments := 0
+
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE"), line == "#EXT-X-ENDLIST":
+			// Replaced below
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if comma := strings.Index(value, ","); comma >= 0 {
+				value = value[:comma]
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				duration += seconds
+			}
+		case !strings.HasPrefix(line, "#"):
+			segments++
+		}
+
+		lines = append(lines, line)
+		if line == "#EXTM3U" {
+			lines = append(lines, "#EXT-X-PLAYLIST-TYPE:VOD")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to read playlist: %w", err)
+	}
+
+	lines = append(lines, "#EXT-X-ENDLIST")
+
+	if err := os.WriteFile(dstPath, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		return 0, 0, fmt.Errorf("failed to write VOD playlist: %w", err)
+	}
+
+	return duration, segments, nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteVODPlaylist(t *testing.T) {
+	tests := []struct {
+		name         string
+		live         string
+		want         string
+		wantDuration float64
+		wantSegments int
+	}{
+		{
+			name: "event playlist",
+			live: "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:0\n" +
+				"#EXT-X-PLAYLIST-TYPE:EVENT\n#EXTINF:4.000000,\nsegment_1.ts\n#EXTINF:3.500000,\nsegment_2.ts\n",
+			want: "#EXTM3U\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n" +
+				"#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:4.000000,\nsegment_1.ts\n#EXTINF:3.500000,\nsegment_2.ts\n" +
+				"#EXT-X-ENDLIST\n",
+			wantDuration: 7.5,
+			wantSegments: 2,
+		},
+		{
+			name:         "ended playlist with blank lines",
+			live:         "#EXTM3U\n\n#EXTINF:2.0,\r\nsegment_1.ts\n\n#EXT-X-ENDLIST\n",
+			want:         "#EXTM3U\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:2.0,\nsegment_1.ts\n#EXT-X-ENDLIST\n",
+			wantDuration: 2,
+			wantSegments: 1,
+		},
+		{
+			name: "fMP4 segments with encryption keys",
+			live: "#EXTM3U\n#EXT-X-MAP:URI=\"init_0.mp4\"\n" +
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"https://api.example.com/keys/abc/1\"\n" +
+				"#EXTINF:4,title\nsegment_1.m4s\n",
+			want: "#EXTM3U\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-MAP:URI=\"init_0.mp4\"\n" +
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"https://api.example.com/keys/abc/1\"\n" +
+				"#EXTINF:4,title\nsegment_1.m4s\n#EXT-X-ENDLIST\n",
+			wantDuration: 4,
+			wantSegments: 1,
+		},
+		{
+			name:         "no segments",
+			live:         "#EXTM3U\n#EXT-X-TARGETDURATION:4\n",
+			want:         "#EXTM3U\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-TARGETDURATION:4\n#EXT-X-ENDLIST\n",
+			wantDuration: 0,
+			wantSegments: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			srcPath := filepath.Join(dir, "playlist.m3u8")
+			dstPath := filepath.Join(dir, "vod.m3u8")
+			if err := os.WriteFile(srcPath, []byte(tt.live), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			duration, segments, err := writeVODPlaylist(srcPath, dstPath)
+			if err != nil {
+				t.Fatalf("writeVODPlaylist() error = %v", err)
+			}
+			if math.Abs(duration-tt.wantDuration) > 1e-9 || segments != tt.wantSegments {
+				t.Errorf("writeVODPlaylist() = %v, %d, want %v, %d",
+					duration, segments, tt.wantDuration, tt.wantSegments)
+			}
+
+			got, err := os.ReadFile(dstPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("VOD playlist =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteVODPlaylistMissingSource(t *testing.T) {
+	dir := t.TempDir()
+	_, _, err := writeVODPlaylist(filepath.Join(dir, "missing.m3u8"), filepath.Join(dir, "vod.m3u8"))
+	if err == nil {
+		t.Error("writeVODPlaylist() of a missing playlist succeeded, want error")
+	}
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+// S3Storage is a Storage backed by MinIO or any S3-compatible object store
+type S3Storage struct {
+	logger     *zap.Logger
+	s3Client   *s3.S3
+	bucketName string
+	cdnBaseURL string
+}
+
+// NewS3Storage creates an S3 storage backend, creating the bucket if needed
+func NewS3Storage(
+	logger *zap.Logger,
+	config *models.StorageConfig,
+	cdnBaseURL string,
+) (*S3Storage, error) {
+	// Create AWS session for MinIO
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials(
+			config.AccessKeyID,
+			config.SecretAccessKey,
+			"",
+		),
+		Endpoint:         aws.String(config.Endpoint),
+		Region:           aws.String(config.Region),
+		DisableSSL:       aws.Bool(!config.UseSSL),
+		S3ForcePathStyle: aws.Bool(true), // Required for MinIO
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	s3Client := s3.New(sess)
+
+	// Ensure bucket exists
+	_, err = s3Client.HeadBucket(&s3.HeadBucketInput{
+		Bucket: aws.String(config.BucketName),
+	})
+	if err != nil {
+		// Create bucket if it doesn't exist
+		_, err = s3Client.CreateBucket(&s3.CreateBucketInput{
+			Bucket: aws.String(config.BucketName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create bucket: %w", err)
+		}
+		logger.Info("Created bucket", zap.String("bucket", config.BucketName))
+	}
+
+	return &S3Storage{
+		logger:     logger,
+		s3Client:   s3Client,
+		bucketName: config.BucketName,
+		cdnBaseURL: cdnBaseURL,
+	}, nil
+}
+
+// UploadFile uploads a file to MinIO/S3
+func (s *S3Storage) UploadFile(localPath, s3Key string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	// Get file info for content type
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	contentType := contentTypeFor(filepath.Ext(localPath))
+
+	_, err = s.s3Client.PutObject(&s3.PutObjectInput{
+		Bucket:        aws.String(s.bucketName),
+		Key:           aws.String(s3Key),
+		Body:          file,
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(fileInfo.Size()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	s.logger.Info("Uploaded file to S3",
+		zap.String("local_path", localPath),
+		zap.String("s3_key", s3Key),
+		zap.String("content_type", contentType),
+	)
+
+	return nil
+}
+
+// CopyFile copies an object within the bucket without downloading it
+func (s *S3Storage) CopyFile(srcKey, dstKey string) error {
+	_, err := s.s3Client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucketName),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(url.PathEscape(s.bucketName + "/" + srcKey)),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+
+	return nil
+}
+
+// StatFile returns the metadata of an object in MinIO/S3
+func (s *S3Storage) StatFile(key string) (*models.StorageFile, error) {
+	result, err := s.s3Client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("failed to head object: %w", err)
+	}
+
+	return &models.StorageFile{
+		Key:          key,
+		Size:         aws.Int64Value(result.ContentLength),
+		LastModified: aws.TimeValue(result.LastModified),
+		ETag:         strings.Trim(aws.StringValue(result.ETag), `"`),
+		ContentType:  contentTypeFor(filepath.Ext(key)),
+	}, nil
+}
+
+// OpenFile streams an object from MinIO/S3, starting at offset
+func (s *S3Storage) OpenFile(key string, offset int64) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+	if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	result, err := s.s3Client.GetObject(input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	return result.Body, nil
+}
+
+// isS3NotFound reports whether err means the object does not exist. HEAD
+// responses have no body, so they report a bare "NotFound" code.
+func isS3NotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound"
+	}
+	return false
+}
+
+// GetSignedURL generates a signed URL for file access
+func (s *S3Storage) GetSignedURL(key string, expires time.Duration) (string, error) {
+	req, _ := s.s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	url, err := req.Presign(expires)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signed URL: %w", err)
+	}
+
+	return url, nil
+}
+
+// GetPublicURL generates a public URL for file access
+func (s *S3Storage) GetPublicURL(tenantPrefix, key string) string {
+	key = TenantKey(tenantPrefix, key)
+	if s.cdnBaseURL != "" {
+		return fmt.Sprintf("%s/%s", strings.TrimSuffix(s.cdnBaseURL, "/"), key)
+	}
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", s.bucketName, key)
+}
+
+// ListFiles lists all files whose key starts with prefix
+func (s *S3Storage) ListFiles(prefix string) ([]*models.StorageFile, error) {
+	var files []*models.StorageFile
+	err := s.s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			files = append(files, &models.StorageFile{
+				Key:          *obj.Key,
+				Size:         *obj.Size,
+				LastModified: *obj.LastModified,
+				ETag:         strings.Trim(*obj.ETag, `"`),
+				ContentType:  contentTypeFor(filepath.Ext(*obj.Key)),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	return files, nil
+}
+
+// DeleteFile deletes a file from MinIO/S3
+func (s *S3Storage) DeleteFile(key string) error {
+	_, err := s.s3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	return nil
+}
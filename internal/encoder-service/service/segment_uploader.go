@@ -0,0 +1,318 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// segmentUploader uploads a stream's HLS output as FFmpeg produces it. It
+// watches the output directories for playlist updates; FFmpeg only lists a
+// segment in a media playlist once the segment is complete, so each playlist
+// update uploads the newly listed segments and then the playlist itself.
+// Segments are uploaded exactly once for the lifetime of the uploader,
+// including across FFmpeg restarts. With CMAF packaging the DASH manifest is
+// uploaded once the segments of the HLS playlists written with it are.
+type segmentUploader struct {
+	logger        *zap.Logger
+	storage       Storage
+	streamKey     string
+	keyPrefix     string
+	localDir      string
+	renditionDirs []string
+
+	// uploaded records the segments already in storage, keyed by their path
+	// relative to localDir, with the playlist that lists them
+	uploaded map[string]string
+
+	// segments counts the segments uploaded since the uploader started
+	segments int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newSegmentUploader creates an uploader for a stream's output directory and
+// its rendition subdirectories, mirroring them under keyPrefix in storage
+func newSegmentUploader(
+	logger *zap.Logger,
+	storage Storage,
+	streamKey, keyPrefix, localDir string,
+	renditionDirs []string,
+) *segmentUploader {
+	return &segmentUploader{
+		logger:        logger,
+		storage:       storage,
+		streamKey:     streamKey,
+		keyPrefix:     keyPrefix,
+		localDir:      localDir,
+		renditionDirs: renditionDirs,
+		uploaded:      make(map[string]string),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start begins watching the output directories. The directories must exist.
+func (u *segmentUploader) Start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	for _, dir := range append([]string{u.localDir}, u.renditionDirs...) {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+
+	go u.run(ctx, watcher)
+	return nil
+}
+
+// Stop stops watching and waits for any in-flight upload to finish
+func (u *segmentUploader) Stop() {
+	if u.cancel == nil {
+		return
+	}
+	u.cancel()
+	<-u.done
+}
+
+// SegmentCount returns the number of segments uploaded. It must be called
+// after Stop.
+func (u *segmentUploader) SegmentCount() int {
+	return u.segments
+}
+
+// run handles file events until the uploader is stopped
+func (u *segmentUploader) run(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer close(u.done)
+	defer watcher.Close()
+
+	// Pick up anything written before the watches were in place
+	playlists, _ := mediaPlaylists(u.localDir)
+	for _, playlistPath := range playlists {
+		u.syncPlaylist(playlistPath)
+	}
+	u.uploadMaster()
+	u.uploadManifest()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// FFmpeg writes playlists to a temp file and renames them into
+			// place, which is reported as a create
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+
+			switch name := filepath.Base(event.Name); {
+			case isMediaPlaylist(name):
+				u.syncPlaylist(event.Name)
+			case name == masterPlaylistName:
+				u.uploadMaster()
+			case name == dashManifestName:
+				u.uploadManifest()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			u.logger.Error("File watcher error",
+				zap.String("stream_key", u.streamKey),
+				zap.Error(err),
+			)
+		case <-ctx.Done():
+			u.logger.Info("Segment upload stopped",
+				zap.String("stream_key", u.streamKey),
+			)
+			return
+		}
+	}
+}
+
+// syncPlaylist uploads the segments a media playlist references that are not
+// yet in storage, then the playlist itself. The playlist is not uploaded if
+// any of its segments failed, so viewers never see a missing segment.
+func (u *segmentUploader) syncPlaylist(playlistPath string) {
+	if !u.syncSegments(playlistPath) {
+		return
+	}
+
+	if err := UploadHLSFile(u.storage, u.keyPrefix, u.localDir, playlistPath); err != nil {
+		u.logger.Error("Failed to upload playlist",
+			zap.String("stream_key", u.streamKey),
+			zap.String("playlist_path", playlistPath),
+			zap.Error(err),
+		)
+	}
+}
+
+// syncSegments uploads the segments a media playlist references, including
+// its initialization segment, that are not yet in storage. It reports whether
+// all of them are in storage.
+func (u *segmentUploader) syncSegments(playlistPath string) bool {
+	playlist, err := readMediaPlaylist(playlistPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			u.logger.Error("Failed to read media playlist",
+				zap.String("stream_key", u.streamKey),
+				zap.String("playlist_path", playlistPath),
+				zap.Error(err),
+			)
+		}
+		return false
+	}
+
+	files := playlist.Segments
+	if playlist.InitSegment != "" {
+		files = append([]string{playlist.InitSegment}, files...)
+	}
+
+	dir := filepath.Dir(playlistPath)
+	listed := make(map[string]bool, len(files))
+	for _, file := range files {
+		segmentPath := filepath.Join(dir, file)
+		relPath, err := filepath.Rel(u.localDir, segmentPath)
+		if err != nil {
+			continue
+		}
+		listed[relPath] = true
+		if _, ok := u.uploaded[relPath]; ok {
+			continue
+		}
+
+		if err := UploadHLSFile(u.storage, u.keyPrefix, u.localDir, segmentPath); err != nil {
+			u.logger.Error("Failed to upload segment",
+				zap.String("stream_key", u.streamKey),
+				zap.String("segment_path", segmentPath),
+				zap.Error(err),
+			)
+			return false
+		}
+		u.uploaded[relPath] = playlistPath
+		if file != playlist.InitSegment {
+			u.segments++
+		}
+	}
+
+	// Forget segments that have slid out of a live playlist's window; segment
+	// numbers only increase, so they are never listed again
+	for relPath, listedBy := range u.uploaded {
+		if listedBy == playlistPath && !listed[relPath] {
+			delete(u.uploaded, relPath)
+		}
+	}
+
+	return true
+}
+
+// uploadMaster uploads the master playlist once FFmpeg has written it
+func (u *segmentUploader) uploadMaster() {
+	masterPath := filepath.Join(u.localDir, masterPlaylistName)
+	if _, err := os.Stat(masterPath); err != nil {
+		return
+	}
+
+	if err := UploadHLSFile(u.storage, u.keyPrefix, u.localDir, masterPath); err != nil {
+		u.logger.Error("Failed to upload master playlist",
+			zap.String("stream_key", u.streamKey),
+			zap.Error(err),
+		)
+	}
+}
+
+// uploadManifest uploads the DASH manifest once FFmpeg has written it. The
+// manifest lists the same segments as the CMAF media playlists, so those
+// segments are uploaded first and the manifest never lists a missing one.
+func (u *segmentUploader) uploadManifest() {
+	manifestPath := filepath.Join(u.localDir, dashManifestName)
+	if _, err := os.Stat(manifestPath); err != nil {
+		return
+	}
+
+	playlists, err := filepath.Glob(filepath.Join(u.localDir, cmafPlaylistPattern))
+	if err != nil {
+		return
+	}
+	for _, playlistPath := range playlists {
+		if !u.syncSegments(playlistPath) {
+			return
+		}
+	}
+
+	if err := UploadHLSFile(u.storage, u.keyPrefix, u.localDir, manifestPath); err != nil {
+		u.logger.Error("Failed to upload DASH manifest",
+			zap.String("stream_key", u.streamKey),
+			zap.Error(err),
+		)
+	}
+}
+
+// mediaPlaylist holds the URIs a media playlist references
+type mediaPlaylist struct {
+	// InitSegment is the EXT-X-MAP initialization segment of fMP4 segments,
+	// empty for MPEG-TS segments
+	InitSegment string
+	Segments    []string
+	// Durations holds the EXTINF duration of each segment, in seconds
+	Durations []float64
+}
+
+// readMediaPlaylist returns the segment URIs listed in a media playlist
+func readMediaPlaylist(playlistPath string) (*mediaPlaylist, error) {
+	file, err := os.Open(playlistPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	playlist := &mediaPlaylist{}
+	var duration float64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			playlist.InitSegment = playlistAttribute(line, "URI")
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			duration, _ = strconv.ParseFloat(value, 64)
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			playlist.Segments = append(playlist.Segments, line)
+			playlist.Durations = append(playlist.Durations, duration)
+			duration = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return playlist, nil
+}
+
+// playlistAttribute returns the value of a quoted attribute of a playlist
+// tag, e.g. URI in #EXT-X-MAP:URI="init.mp4", or "" if it is absent
+func playlistAttribute(line, name string) string {
+	_, value, found := strings.Cut(line, name+`="`)
+	if !found {
+		return ""
+	}
+	value, _, _ = strings.Cut(value, `"`)
+	return value
+}
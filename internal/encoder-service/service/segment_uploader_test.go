@@ -0,0 +1,80 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadMediaPlaylist(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     *mediaPlaylist
+	}{
+		{
+			name: "MPEG-TS segments",
+			playlist: "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.000000,\nsegment_1.ts\n" +
+				"#EXTINF:2.5,\nsegment_2.ts\n",
+			want: &mediaPlaylist{
+				Segments:  []string{"segment_1.ts", "segment_2.ts"},
+				Durations: []float64{4, 2.5},
+			},
+		},
+		{
+			name: "fMP4 segments with an initialization segment",
+			playlist: "#EXTM3U\n#EXT-X-MAP:URI=\"init_1.mp4\"\n#EXTINF:2,\nsegment_1_1.m4s\n" +
+				"#EXT-X-ENDLIST\n",
+			want: &mediaPlaylist{
+				InitSegment: "init_1.mp4",
+				Segments:    []string{"segment_1_1.m4s"},
+				Durations:   []float64{2},
+			},
+		},
+		{
+			name:     "segment without EXTINF",
+			playlist: "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"https://api.example.com/keys/abc/1\"\nsegment_1.ts\n",
+			want: &mediaPlaylist{
+				Segments:  []string{"segment_1.ts"},
+				Durations: []float64{0},
+			},
+		},
+		{
+			name:     "indented lines and blank lines",
+			playlist: "#EXTM3U\n\n  #EXTINF:1.5,\n  segment_1.ts  \n\n",
+			want: &mediaPlaylist{
+				Segments:  []string{"segment_1.ts"},
+				Durations: []float64{1.5},
+			},
+		},
+		{
+			name:     "empty playlist",
+			playlist: "#EXTM3U\n",
+			want:     &mediaPlaylist{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "playlist.m3u8")
+			if err := os.WriteFile(path, []byte(tt.playlist), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readMediaPlaylist(path)
+			if err != nil {
+				t.Fatalf("readMediaPlaylist() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readMediaPlaylist() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMediaPlaylistMissing(t *testing.T) {
+	if _, err := readMediaPlaylist(filepath.Join(t.TempDir(), "missing.m3u8")); err == nil {
+		t.Error("readMediaPlaylist() of a missing playlist succeeded, want error")
+	}
+}
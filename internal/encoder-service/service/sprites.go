@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"image/jpeg"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// spriteInterval is the time between seek preview thumbnails
+	spriteInterval = 10 * time.Second
+
+	// spriteColumns and spriteRows are the thumbnails per sprite sheet
+	spriteColumns = 10
+	spriteRows    = 10
+
+	// spriteThumbnailWidth is the width of a preview thumbnail; its height
+	// follows the video's aspect ratio
+	spriteThumbnailWidth = 160
+
+	// spriteDirName is the directory of a recording's sprite sheets and
+	// WebVTT track, next to its renditions
+	spriteDirName = "sprites"
+
+	// spriteTrackName is the WebVTT track that maps time ranges to sprite
+	// sheet regions
+	spriteTrackName = "thumbnails.vtt"
+)
+
+// buildSprites writes seek preview sprite sheets for a VOD playlist of the
+// given duration to spriteDir, with a WebVTT track whose cues point at a
+// region of a sheet, e.g. sprite_000.jpg#xywh=160,0,160,90. It returns the
+// number of sheets.
+func buildSprites(playlistPath, spriteDir string, duration float64) (int, error) {
+	if err := os.MkdirAll(spriteDir, 0o755); err != nil {
+		return 0, err
+	}
+
+	filter := fmt.Sprintf("fps=1/%d,scale=%d:-2,tile=%dx%d",
+		int(spriteInterval.Seconds()), spriteThumbnailWidth, spriteColumns, spriteRows)
+	cmd := exec.Command("ffmpeg",
+		"-v", "error",
+		"-y",
+		"-i", playlistPath,
+		"-an",
+		"-vf", filter,
+		"-q:v", "5",
+		"-start_number", "0",
+		filepath.Join(spriteDir, "sprite_%03d.jpg"),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("ffmpeg sprite generation failed: %w: %s", err, output)
+	}
+
+	sheets, err := filepath.Glob(filepath.Join(spriteDir, "sprite_*.jpg"))
+	if err != nil {
+		return 0, err
+	}
+	if len(sheets) == 0 {
+		return 0, fmt.Errorf("no sprite sheets written")
+	}
+
+	// Every sheet has the full grid, so the first gives the thumbnail size
+	width, height, err := jpegSize(sheets[0])
+	if err != nil {
+		return 0, err
+	}
+	tileWidth, tileHeight := width/spriteColumns, height/spriteRows
+
+	perSheet := spriteColumns * spriteRows
+	thumbnails := int(math.Ceil(duration / spriteInterval.Seconds()))
+	if thumbnails > len(sheets)*perSheet {
+		thumbnails = len(sheets) * perSheet
+	}
+
+	var track strings.Builder
+	track.WriteString("WEBVTT\n")
+	for i := 0; i < thumbnails; i++ {
+		start := float64(i) * spriteInterval.Seconds()
+		end := math.Min(start+spriteInterval.Seconds(), duration)
+		tile := i % perSheet
+		fmt.Fprintf(&track, "\n%s --> %s\nsprite_%03d.jpg#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), i/perSheet,
+			(tile%spriteColumns)*tileWidth, (tile/spriteColumns)*tileHeight, tileWidth, tileHeight)
+	}
+
+	if err := os.WriteFile(filepath.Join(spriteDir, spriteTrackName), []byte(track.String()), 0o644); err != nil {
+		return 0, fmt.Errorf("failed to write sprite track: %w", err)
+	}
+
+	return len(sheets), nil
+}
+
+// jpegSize returns the dimensions of a JPEG file
+func jpegSize(path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, err := jpeg.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read sprite sheet: %w", err)
+	}
+	return config.Width, config.Height, nil
+}
+
+// vttTimestamp formats seconds as a WebVTT timestamp, hh:mm:ss.ttt
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
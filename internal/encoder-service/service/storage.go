@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/metrics"
+	"streamkit/internal/encoder-service/models"
+)
+
+// Storage backends selectable with StorageConfig.Backend
+const (
+	StorageBackendS3     = "s3"
+	StorageBackendLocal  = "local"
+	StorageBackendMemory = "memory"
+)
+
+// ErrFileNotFound is returned by Storage when a key does not exist
+var ErrFileNotFound = errors.New("file not found")
+
+// Storage stores HLS output and recordings under slash-separated keys such as
+// hls/{playback_id}/master.m3u8, placed under the owning organization's
+// storage prefix with TenantKey. The encoder and the HLS handler only depend
+// on this interface, so the backend can be swapped by configuration.
+type Storage interface {
+	// UploadFile uploads a local file under key, replacing any existing file
+	UploadFile(localPath, key string) error
+
+	// CopyFile copies the file stored under srcKey to dstKey within the
+	// storage, replacing any existing file. It returns ErrFileNotFound if
+	// srcKey does not exist.
+	CopyFile(srcKey, dstKey string) error
+
+	// StatFile returns the metadata of the file stored under key
+	StatFile(key string) (*models.StorageFile, error)
+
+	// OpenFile streams the file stored under key, starting at offset bytes.
+	// The caller must close the returned reader.
+	OpenFile(key string, offset int64) (io.ReadCloser, error)
+
+	// ListFiles lists all files whose key starts with prefix
+	ListFiles(prefix string) ([]*models.StorageFile, error)
+
+	// DeleteFile deletes the file stored under key
+	DeleteFile(key string) error
+
+	// GetPublicURL returns the URL viewers use to fetch key, given relative
+	// to a tenant's storage prefix
+	GetPublicURL(tenantPrefix, key string) string
+}
+
+// NewStorage creates the storage backend selected by config.Backend, with
+// its uploads recorded in the metrics
+func NewStorage(
+	logger *zap.Logger,
+	config *models.StorageConfig,
+	cdnBaseURL string,
+) (Storage, error) {
+	var storage Storage
+	var err error
+	switch config.Backend {
+	case StorageBackendS3, "":
+		storage, err = NewS3Storage(logger, config, cdnBaseURL)
+	case StorageBackendLocal:
+		storage, err = NewLocalStorage(logger, config.LocalPath, cdnBaseURL)
+	case StorageBackendMemory:
+		storage = NewMemoryStorage(logger, cdnBaseURL)
+	default:
+		err = fmt.Errorf("unknown storage backend %q", config.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return instrumentedStorage{storage}, nil
+}
+
+// instrumentedStorage records the latency, size and failures of a backend's
+// uploads
+type instrumentedStorage struct {
+	Storage
+}
+
+// UploadFile uploads through the wrapped backend and records the upload
+func (s instrumentedStorage) UploadFile(localPath, key string) error {
+	start := time.Now()
+	err := s.Storage.UploadFile(localPath, key)
+
+	var size int64
+	if info, statErr := os.Stat(localPath); statErr == nil {
+		size = info.Size()
+	}
+	metrics.ObserveUpload(key, size, time.Since(start), err)
+
+	return err
+}
+
+// contentTypeFor returns the content type based on file extension
+func contentTypeFor(ext string) string {
+	switch ext {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".mp4":
+		return "video/mp4"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// originURL returns the URL for a tenant's key on the CDN, or relative to the
+// encoder's own /hls/ and /recordings/ routes when no CDN is configured. Those
+// routes resolve the tenant from the playback ID, so they omit the prefix.
+func originURL(cdnBaseURL, tenantPrefix, key string) string {
+	if cdnBaseURL != "" {
+		return fmt.Sprintf("%s/%s", strings.TrimSuffix(cdnBaseURL, "/"), TenantKey(tenantPrefix, key))
+	}
+	return "/" + key
+}
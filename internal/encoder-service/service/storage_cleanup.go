@@ -0,0 +1,43 @@
+package service
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// storageCleanupBatch bounds the deleted streams cleaned up per interval
+const storageCleanupBatch = 20
+
+// CleanUpDeletedStreams deletes the files of streams deleted through the API
+// from storage every interval: their thumbnails, which are kept after a
+// stream ends as its poster image, any live files and their recordings. A
+// cleanup is only dropped once its files are deleted, so failed ones are
+// retried. It never returns.
+func (e *EncoderService) CleanUpDeletedStreams(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if e.storage == nil {
+			continue
+		}
+
+		cleanups, err := e.streamRepo.GetStorageCleanups(storageCleanupBatch)
+		if err != nil {
+			continue
+		}
+
+		for _, cleanup := range cleanups {
+			err := DeleteAllStreamFiles(e.logger, e.storage, cleanup.StoragePrefix, cleanup.PlaybackID)
+			if err != nil {
+				e.logger.Error("Failed to delete files of deleted stream",
+					zap.String("playback_id", cleanup.PlaybackID),
+					zap.Error(err),
+				)
+				continue
+			}
+			e.streamRepo.DeleteStorageCleanup(cleanup.ID)
+		}
+	}
+}
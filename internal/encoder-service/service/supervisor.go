@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/metrics"
+	"streamkit/internal/encoder-service/models"
+)
+
+const (
+	// ffmpegMaxRestarts is the number of consecutive crashes tolerated before
+	// the stream is marked as errored
+	ffmpegMaxRestarts = 5
+
+	// ffmpegRestartBackoff is the delay before the first restart; it doubles
+	// after every consecutive crash up to ffmpegMaxRestartBackoff
+	ffmpegRestartBackoff    = time.Second
+	ffmpegMaxRestartBackoff = 30 * time.Second
+
+	// ffmpegStableRunTime is how long a process must run before its crash is
+	// no longer counted as consecutive with the previous one
+	ffmpegStableRunTime = time.Minute
+
+	// ffmpegLogLines is the number of FFmpeg stderr lines kept per session
+	ffmpegLogLines = 1000
+)
+
+// startFFmpeg starts a new FFmpeg process for a stream encoder. Only the
+// goroutine supervising the stream may wait for it.
+func (e *EncoderService) startFFmpeg(encoder *models.StreamEncoder, args []string) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(encoder.Ctx, "ffmpeg", args...)
+
+	// Progress reports arrive on stdout; the previous process's report no
+	// longer describes the encoder
+	encoder.Progress.Store(nil)
+	cmd.Stdout = newProgressWriter(encoder)
+	cmd.Stderr = encoder.Logs
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// superviseEncoding starts a stream's FFmpeg process with the arguments
+// ffmpegArgs builds, waits for it and restarts it with bounded exponential
+// backoff when it crashes, or cannot be started, while the publisher is
+// still connected. After ffmpegMaxRestarts consecutive crashes the stream is
+// marked as errored. Once encoding is over the stream is cleaned up.
+func (e *EncoderService) superviseEncoding(
+	encoder *models.StreamEncoder,
+	ffmpegArgs func() []string,
+	outputDir string,
+	uploader *segmentUploader,
+) {
+	streamKey := encoder.StreamKey
+	failures := 0
+	backoff := ffmpegRestartBackoff
+	status := "encoding started"
+	var failErr error
+
+	for {
+		// StopEncoding cancels the context and emits stream.ended itself
+		if encoder.Ctx.Err() != nil {
+			break
+		}
+
+		startedAt := time.Now()
+		cmd, exitErr := e.startFFmpeg(encoder, ffmpegArgs())
+		if exitErr != nil {
+			metrics.FFmpegExited(ffmpegExitReason(encoder.Ctx, exitErr))
+		} else {
+			if err := e.streamRepo.MarkStreamLive(streamKey, status); err != nil {
+				e.logger.Error("Failed to update stream status in database",
+					zap.String("stream_key", streamKey),
+					zap.Error(err),
+				)
+			}
+			exitErr = waitFFmpeg(encoder.Ctx, cmd)
+		}
+		status = "encoding restarted"
+
+		if encoder.Ctx.Err() != nil {
+			break
+		}
+
+		if exitErr == nil {
+			e.logger.Info("FFmpeg process completed",
+				zap.String("stream_key", streamKey),
+			)
+			e.webhookService.Emit(encoder.OrganizationID, models.WebhookEventStreamEnded,
+				encoder.EventData(""))
+			break
+		}
+
+		e.logger.Error("FFmpeg process failed",
+			zap.String("stream_key", streamKey),
+			zap.Error(exitErr),
+		)
+
+		// A crash after a long healthy run starts a new failure sequence
+		if time.Since(startedAt) >= ffmpegStableRunTime {
+			failures = 0
+			backoff = ffmpegRestartBackoff
+		}
+		failures++
+
+		if failures > ffmpegMaxRestarts {
+			failErr = exitErr
+			break
+		}
+
+		metrics.FFmpegRestarted()
+		encoder.Logs.Append(fmt.Sprintf("streamkit: FFmpeg exited (%v), restarting in %s (attempt %d)",
+			exitErr, backoff, failures))
+		if err := e.streamRepo.RecordRestart(streamKey, exitErr.Error()); err != nil {
+			e.logger.Error("Failed to record FFmpeg restart",
+				zap.String("stream_key", streamKey),
+				zap.Error(err),
+			)
+		}
+
+		e.logger.Warn("Restarting FFmpeg",
+			zap.String("stream_key", streamKey),
+			zap.Int("attempt", failures),
+			zap.Duration("backoff", backoff),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-encoder.Ctx.Done():
+			continue
+		}
+
+		backoff *= 2
+		if backoff > ffmpegMaxRestartBackoff {
+			backoff = ffmpegMaxRestartBackoff
+		}
+
+		// Without a publisher FFmpeg would only fail again. Its unpublish
+		// callback normally stops the stream first, but may have been lost.
+		if !e.publisherConnected(streamKey) {
+			e.logger.Info("Publisher disconnected, not restarting FFmpeg",
+				zap.String("stream_key", streamKey),
+			)
+			e.webhookService.Emit(encoder.OrganizationID, models.WebhookEventStreamEnded,
+				encoder.EventData(""))
+			break
+		}
+	}
+
+	e.finishEncoding(encoder, outputDir, uploader, failErr)
+}
+
+// waitFFmpeg waits for an FFmpeg process of a stream encoded under ctx and
+// counts its exit
+func waitFFmpeg(ctx context.Context, cmd *exec.Cmd) error {
+	exitErr := cmd.Wait()
+	metrics.FFmpegExited(ffmpegExitReason(ctx, exitErr))
+	return exitErr
+}
+
+// ffmpegExitReason classifies how an FFmpeg process ended for metrics.
+// exitErr is the error from waiting for the process, or from starting it.
+func ffmpegExitReason(ctx context.Context, exitErr error) string {
+	if ctx.Err() != nil {
+		return metrics.FFmpegExitStopped
+	}
+	if exitErr == nil {
+		return metrics.FFmpegExitCompleted
+	}
+
+	var exitError *exec.ExitError
+	if !errors.As(exitErr, &exitError) {
+		return metrics.FFmpegExitStartFailed
+	}
+	if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return metrics.FFmpegExitSignaled
+	}
+	return metrics.FFmpegExitCrashed
+}
+
+// finishEncoding removes a stream from the active set, records its final
+// status, stops its segment upload, closes its session, finalizes any
+// recording and deletes its live storage files and output directory.
+// failErr is set when encoding failed: FFmpeg could not be started or kept
+// crashing. If the key has been published again meanwhile, the stream's
+// status and live storage files belong to the new publish and are left
+// alone.
+func (e *EncoderService) finishEncoding(
+	encoder *models.StreamEncoder,
+	outputDir string,
+	uploader *segmentUploader,
+	failErr error,
+) {
+	streamKey := encoder.StreamKey
+
+	if uploader != nil {
+		uploader.Stop()
+	}
+
+	// Remove from active processes unless the key has been republished since
+	e.mu.Lock()
+	current, exists := e.activeProcesses[streamKey]
+	if exists && current == encoder {
+		delete(e.activeProcesses, streamKey)
+	}
+	republished := exists && current != encoder
+	if output, exists := e.lowLatencyOutputs[encoder]; exists {
+		output.stop()
+		delete(e.lowLatencyOutputs, encoder)
+	}
+	rotator := e.keyRotators[encoder]
+	delete(e.keyRotators, encoder)
+	endReason := encoder.EndReason
+	e.mu.Unlock()
+
+	// FFmpeg has exited, so the plaintext keys are no longer needed
+	if rotator != nil {
+		rotator.stop()
+	}
+
+	if failErr != nil {
+		endReason = models.SessionEndFFmpegCrash
+	} else if endReason == "" {
+		endReason = models.SessionEndPublisherLeft
+	}
+
+	// Update database status
+	if failErr != nil {
+		e.logger.Error("Encoding failed, giving up",
+			zap.String("stream_key", streamKey),
+			zap.Int("max_restarts", ffmpegMaxRestarts),
+			zap.Error(failErr),
+		)
+		if !republished {
+			if err := e.streamRepo.MarkStreamError(streamKey, failErr.Error()); err != nil {
+				e.logger.Error("Failed to update stream status in database",
+					zap.String("stream_key", streamKey),
+					zap.Error(err),
+				)
+			}
+		}
+		e.webhookService.Emit(encoder.OrganizationID, models.WebhookEventStreamErrored,
+			encoder.EventData(failErr.Error()))
+	} else if !republished {
+		if err := e.streamRepo.StopStream(streamKey, string(endReason)); err != nil {
+			e.logger.Error("Failed to update stream status in database",
+				zap.String("stream_key", streamKey),
+				zap.Error(err),
+			)
+		}
+	}
+
+	// FFmpeg has exited, so its log is complete
+	encoder.Logs.Close()
+
+	if encoder.Session != nil {
+		encoder.Session.EndReason = endReason
+		encoder.Session.FFmpegLog = encoder.Logs.String()
+		e.sampleIngest(encoder)
+		encoder.Session.BytesIngested = encoder.BytesIngested.Load()
+		if uploader != nil {
+			encoder.Session.SegmentsProduced = uploader.SegmentCount()
+		}
+		if err := e.sessionRepo.FinishSession(encoder.Session); err != nil {
+			e.logger.Error("Failed to finish session",
+				zap.String("stream_key", streamKey),
+				zap.Int64("session_id", encoder.Session.ID),
+				zap.Error(err),
+			)
+		}
+	}
+
+	// Turn the archived segments into a VOD recording
+	if encoder.Recording != nil {
+		e.finalizeRecording(encoder, outputDir)
+	}
+
+	// Clean up live storage files, which share their location with those of
+	// any publish started while the recording was finalized
+	if e.storage != nil && !e.republished(encoder) {
+		err := DeleteStreamFiles(e.logger, e.storage, encoder.StoragePrefix, encoder.PlaybackID)
+		if err != nil {
+			e.logger.Error("Failed to delete stream files from storage",
+				zap.String("stream_key", streamKey),
+				zap.Error(err),
+			)
+		}
+	}
+
+	if err := os.RemoveAll(outputDir); err != nil {
+		e.logger.Error("Failed to remove output directory",
+			zap.String("stream_key", streamKey),
+			zap.String("output_dir", outputDir),
+			zap.Error(err),
+		)
+	}
+}
+
+// republished reports whether the key of a stream encoder has been published
+// again since the encoder was started
+func (e *EncoderService) republished(encoder *models.StreamEncoder) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	current, exists := e.activeProcesses[encoder.StreamKey]
+	return exists && current != encoder
+}
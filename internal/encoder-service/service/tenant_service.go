@@ -0,0 +1,123 @@
+package service
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/metrics"
+	"streamkit/internal/encoder-service/repos"
+)
+
+const (
+	// tenantCacheTTL bounds how long a playback ID's tenant is cached.
+	// Playback IDs never move between organizations, so this only limits how
+	// long deleted streams are remembered.
+	tenantCacheTTL = 5 * time.Minute
+
+	// tenantCacheMaxEntries caps the cache; the least recently used playback
+	// ID is evicted when it is full
+	tenantCacheMaxEntries = 10000
+)
+
+// ErrUnknownPlaybackID is returned for playback IDs the API never issued
+var ErrUnknownPlaybackID = errors.New("unknown playback ID")
+
+// TenantService resolves which organization's storage prefix a playback ID
+// is stored under, so the HLS origin can serve tenant files from URLs that
+// only carry the playback ID. Lookups of known playback IDs are cached to
+// keep the database off the request path for segments. Unknown ones are not,
+// so requests for made-up IDs cannot fill the cache.
+type TenantService struct {
+	logger     *zap.Logger
+	streamRepo *repos.StreamRepo
+	cache      map[string]*list.Element
+	lru        *list.List // of *tenantCacheEntry, most recently used first
+	mu         sync.Mutex
+}
+
+// tenantCacheEntry is a cached lookup of a known playback ID
+type tenantCacheEntry struct {
+	playbackID    string
+	storagePrefix string
+	expiresAt     time.Time
+}
+
+// NewTenantService creates a new tenant service
+func NewTenantService(logger *zap.Logger, streamRepo *repos.StreamRepo) *TenantService {
+	return &TenantService{
+		logger:     logger,
+		streamRepo: streamRepo,
+		cache:      make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// StoragePrefix returns the storage prefix of the organization that owns a
+// playback ID, or ErrUnknownPlaybackID
+func (t *TenantService) StoragePrefix(playbackID string) (string, error) {
+	if storagePrefix, ok := t.cached(playbackID); ok {
+		metrics.TenantCacheLookup(true)
+		return storagePrefix, nil
+	}
+	metrics.TenantCacheLookup(false)
+
+	liveStream, err := t.streamRepo.GetLiveStreamByPlaybackID(playbackID)
+	if err != nil {
+		return "", err
+	}
+	if liveStream == nil {
+		return "", ErrUnknownPlaybackID
+	}
+
+	t.store(playbackID, liveStream.StoragePrefix)
+	return liveStream.StoragePrefix, nil
+}
+
+// cached returns the unexpired cache entry of a playback ID, marking it as
+// recently used
+func (t *TenantService) cached(playbackID string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	element, ok := t.cache[playbackID]
+	if !ok {
+		return "", false
+	}
+	entry := element.Value.(*tenantCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		t.lru.Remove(element)
+		delete(t.cache, playbackID)
+		return "", false
+	}
+	t.lru.MoveToFront(element)
+	return entry.storagePrefix, true
+}
+
+// store caches a playback ID's storage prefix, evicting the least recently
+// used entries beyond tenantCacheMaxEntries
+func (t *TenantService) store(playbackID, storagePrefix string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := &tenantCacheEntry{
+		playbackID:    playbackID,
+		storagePrefix: storagePrefix,
+		expiresAt:     time.Now().Add(tenantCacheTTL),
+	}
+	if element, ok := t.cache[playbackID]; ok {
+		element.Value = entry
+		t.lru.MoveToFront(element)
+		return
+	}
+	t.cache[playbackID] = t.lru.PushFront(entry)
+
+	for t.lru.Len() > tenantCacheMaxEntries {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.cache, oldest.Value.(*tenantCacheEntry).playbackID)
+	}
+}
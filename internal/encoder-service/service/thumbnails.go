@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+)
+
+const (
+	// thumbnailFileName is the name of a stream's latest thumbnail, both in
+	// its output directory and in storage
+	thumbnailFileName = "latest.jpg"
+
+	// snapshotTimeout bounds extracting one frame from a segment
+	snapshotTimeout = 10 * time.Second
+)
+
+// ErrNoFrame is returned when a snapshot is requested before any video
+// segment has been encoded
+var ErrNoFrame = errors.New("no video frame has been encoded yet")
+
+// ErrStreamEncrypted is returned when a snapshot is requested of a stream
+// whose segments are encrypted
+var ErrStreamEncrypted = errors.New("stream is encrypted")
+
+// captureThumbnails stores a snapshot of a stream as its thumbnail every
+// interval until encoding stops. The snapshot is only replaced when a new
+// segment has been encoded since the last one.
+func (e *EncoderService) captureThumbnails(encoder *models.StreamEncoder, outputDir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	key := ThumbnailKey(encoder.StoragePrefix, encoder.PlaybackID)
+	localPath := filepath.Join(outputDir, thumbnailFileName)
+	var lastSegment string
+
+	for {
+		select {
+		case <-encoder.Ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// The playlist changes when the ladder is fitted to the input
+		e.mu.RLock()
+		videoPlaylist := encoder.VideoPlaylist
+		e.mu.RUnlock()
+
+		initSegment, segment, err := newestSegment(videoPlaylist)
+		if err != nil || segment == lastSegment {
+			continue
+		}
+
+		if err := grabFrame(encoder.Ctx, initSegment, segment, localPath); err != nil {
+			if encoder.Ctx.Err() == nil {
+				e.logger.Warn("Failed to capture thumbnail",
+					zap.String("stream_key", encoder.StreamKey),
+					zap.String("segment_path", segment),
+					zap.Error(err),
+				)
+			}
+			continue
+		}
+
+		if err := e.storage.UploadFile(localPath, key); err != nil {
+			e.logger.Error("Failed to upload thumbnail",
+				zap.String("stream_key", encoder.StreamKey),
+				zap.Error(err),
+			)
+			continue
+		}
+		lastSegment = segment
+	}
+}
+
+// Snapshot returns a JPEG of the latest frame encoded for a stream, taken
+// from its newest complete segment, so it trails the live input by up to a
+// segment duration. It returns ErrStreamNotActive if the stream is not being
+// encoded by this instance.
+func (e *EncoderService) Snapshot(streamKey string) ([]byte, error) {
+	e.mu.RLock()
+	encoder, exists := e.activeProcesses[streamKey]
+	var videoPlaylist string
+	if exists {
+		videoPlaylist = encoder.VideoPlaylist
+	}
+	e.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrStreamNotActive
+	}
+	if encoder.Encrypted {
+		return nil, ErrStreamEncrypted
+	}
+	if videoPlaylist == "" {
+		return nil, ErrNoFrame
+	}
+
+	initSegment, segment, err := newestSegment(videoPlaylist)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "snapshot-*.jpg")
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	if err := grabFrame(encoder.Ctx, initSegment, segment, file.Name()); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(file.Name())
+}
+
+// newestSegment returns the path of the newest segment listed in a media
+// playlist, and of its initialization segment for fMP4 segments, or
+// ErrNoFrame if there is none
+func newestSegment(playlistPath string) (initSegment, segment string, err error) {
+	if playlistPath == "" {
+		return "", "", ErrNoFrame
+	}
+
+	playlist, err := readMediaPlaylist(playlistPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", ErrNoFrame
+		}
+		return "", "", err
+	}
+	if len(playlist.Segments) == 0 {
+		return "", "", ErrNoFrame
+	}
+
+	dir := filepath.Dir(playlistPath)
+	if playlist.InitSegment != "" {
+		initSegment = filepath.Join(dir, playlist.InitSegment)
+	}
+	return initSegment, filepath.Join(dir, playlist.Segments[len(playlist.Segments)-1]), nil
+}
+
+// grabFrame writes a JPEG of the frame one second before the end of a
+// segment to outputPath. An fMP4 segment is read after its initialization
+// segment, initSegment, and gives its first frame, the keyframe it starts on.
+func grabFrame(ctx context.Context, initSegment, segmentPath, outputPath string) error {
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+
+	input := []string{"-sseof", "-1", "-i", segmentPath}
+	if initSegment != "" {
+		input = []string{"-i", "concat:" + initSegment + "|" + segmentPath}
+	}
+
+	args := append([]string{"-v", "error", "-y"}, input...)
+	args = append(args,
+		"-frames:v", "1",
+		"-q:v", "3",
+		"-update", "1",
+		outputPath,
+	)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg frame grab failed: %w: %s", err, output)
+	}
+	return nil
+}
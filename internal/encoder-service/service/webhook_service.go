@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"streamkit/internal/encoder-service/models"
+	"streamkit/internal/encoder-service/repos"
+	"streamkit/internal/shared/netguard"
+)
+
+const (
+	// webhookMaxAttempts is the number of delivery attempts before giving up
+	webhookMaxAttempts = 6
+
+	// webhookInitialBackoff is doubled after every failed attempt
+	webhookInitialBackoff = 2 * time.Second
+
+	// webhookAttemptLease is how long a delivery being attempted is kept from
+	// other attempts. It outlasts the client timeout.
+	webhookAttemptLease = time.Minute
+
+	// webhookRetryBatch is the most due deliveries claimed per poll
+	webhookRetryBatch = 50
+
+	// webhookTimeout bounds a delivery attempt, including connecting
+	webhookTimeout = 10 * time.Second
+
+	// webhookSignatureHeader carries the hex HMAC-SHA256 of the request body
+	webhookSignatureHeader = "X-StreamKit-Signature"
+)
+
+// WebhookService delivers stream lifecycle events to subscribed URLs. Every
+// delivery is recorded in the database with its next attempt time, so
+// retries survive restarts and are sent by whichever instance claims them.
+type WebhookService struct {
+	logger      *zap.Logger
+	webhookRepo *repos.WebhookRepo
+	client      *http.Client
+}
+
+// NewWebhookService creates a new webhook service. Deliveries only connect to
+// public addresses, so subscriptions cannot reach internal services.
+func NewWebhookService(logger *zap.Logger, webhookRepo *repos.WebhookRepo) *WebhookService {
+	return &WebhookService{
+		logger:      logger,
+		webhookRepo: webhookRepo,
+		client:      netguard.NewClient(webhookTimeout),
+	}
+}
+
+// Emit sends an event to every subscription for its type in the stream's
+// organization. It returns immediately; deliveries happen in the background
+// and failed ones are retried by RetryDeliveries.
+func (w *WebhookService) Emit(organizationID int, eventType string, data interface{}) {
+	event := &models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+
+	go w.dispatch(organizationID, event)
+}
+
+// dispatch records and attempts an event's delivery to each matching
+// subscription
+func (w *WebhookService) dispatch(organizationID int, event *models.WebhookEvent) {
+	subscriptions, err := w.webhookRepo.GetSubscriptionsForEvent(organizationID, event.Type)
+	if err != nil {
+		return
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		w.logger.Error("Failed to encode webhook event",
+			zap.String("event_type", event.Type),
+			zap.Error(err),
+		)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		// The first attempt is made right away; the lease only matters if
+		// it is never recorded
+		delivery, err := w.webhookRepo.CreateDelivery(subscription, event, payload,
+			time.Now().Add(webhookAttemptLease))
+		if err != nil {
+			continue
+		}
+		go w.attempt(delivery)
+	}
+}
+
+// RetryDeliveries attempts the deliveries that are due again every interval,
+// including those left pending by a previous run of the service. It never
+// returns.
+func (w *WebhookService) RetryDeliveries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deliveries, err := w.webhookRepo.ClaimDueDeliveries(webhookRetryBatch, webhookAttemptLease)
+		if err != nil {
+			continue
+		}
+		for _, delivery := range deliveries {
+			go w.attempt(delivery)
+		}
+	}
+}
+
+// attempt makes one delivery attempt and records it in the delivery log,
+// scheduling the next attempt with exponential backoff if it failed and
+// attempts remain
+func (w *WebhookService) attempt(delivery *models.WebhookDelivery) {
+	statusCode, err := w.post(delivery)
+
+	delivery.Attempts++
+	delivery.ResponseStatus = nil
+	delivery.LastError = nil
+	delivery.NextAttemptAt = nil
+	if statusCode != 0 {
+		delivery.ResponseStatus = &statusCode
+	}
+
+	logFields := []zap.Field{
+		zap.Int64("delivery_id", delivery.ID),
+		zap.Int("subscription_id", delivery.SubscriptionID),
+		zap.String("event_type", delivery.EventType),
+		zap.Int("attempt", delivery.Attempts),
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = models.WebhookDeliverySucceeded
+		w.logger.Info("Delivered webhook", logFields...)
+	case errors.Is(err, netguard.ErrForbiddenAddress) || delivery.Attempts >= webhookMaxAttempts:
+		// Retrying a refused address cannot succeed
+		lastError := err.Error()
+		delivery.LastError = &lastError
+		delivery.Status = models.WebhookDeliveryFailed
+		w.logger.Warn("Webhook delivery failed", append(logFields, zap.Error(err))...)
+	default:
+		lastError := err.Error()
+		delivery.LastError = &lastError
+		nextAttemptAt := time.Now().Add(webhookBackoff(delivery.Attempts))
+		delivery.NextAttemptAt = &nextAttemptAt
+		w.logger.Warn("Webhook delivery attempt failed",
+			append(logFields, zap.Time("next_attempt_at", nextAttemptAt), zap.Error(err))...)
+	}
+
+	if err := w.webhookRepo.UpdateDelivery(delivery); err != nil {
+		// The attempt is made again once its lease expires
+		w.logger.Error("Failed to record webhook delivery attempt",
+			append(logFields, zap.Error(err))...)
+	}
+}
+
+// webhookBackoff returns the delay before the attempt after attempts failed
+// ones
+func webhookBackoff(attempts int) time.Duration {
+	return webhookInitialBackoff << (attempts - 1)
+}
+
+// post sends one signed delivery attempt and returns the response status
+func (w *WebhookService) post(delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.Subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-StreamKit-Event", delivery.EventType)
+	req.Header.Set("X-StreamKit-Delivery", delivery.EventID)
+	req.Header.Set(webhookSignatureHeader,
+		"sha256="+signWebhookPayload(delivery.Subscription.Secret, delivery.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// signWebhookPayload returns the hex-encoded HMAC-SHA256 of payload
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
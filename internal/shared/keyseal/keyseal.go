@@ -0,0 +1,171 @@
+// Package keyseal holds the HLS key encryption key the API and the encoder
+// service share. The encoder seals the AES-128 keys of encrypted streams
+// with it before storing them and signs the key URIs it puts in playlists;
+// the API checks those signatures and opens the keys to serve them to
+// players. The API also issues the playback tokens viewers need for the
+// encoder to sign key URIs for them.
+package keyseal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// signingContext separates the key URI signing key derived from the key
+	// encryption key from its use for sealing
+	signingContext = "streamkit hls key uri"
+
+	// tokenContext separates the playback token signing key from the key
+	// URI signing key, so neither signature is accepted as the other
+	tokenContext = "streamkit hls playback token"
+)
+
+var (
+	// ErrInvalidKey is returned for a key encryption key that is not 64
+	// hex characters
+	ErrInvalidKey = errors.New("key encryption key must be 64 hex characters")
+
+	// ErrInvalidSignature is returned for key URIs whose signature is
+	// missing, malformed or expired
+	ErrInvalidSignature = errors.New("invalid or expired key URI signature")
+
+	// ErrInvalidToken is returned for playback tokens that are missing,
+	// malformed, expired or for another playback ID
+	ErrInvalidToken = errors.New("invalid or expired playback token")
+)
+
+// Keyring seals keys with AES-256-GCM under the key encryption key, and
+// signs key URIs and playback tokens with HMAC-SHA256 under keys derived
+// from it
+type Keyring struct {
+	aead       cipher.AEAD
+	signingKey []byte
+	tokenKey   []byte
+}
+
+// New creates a keyring from a hex-encoded 32-byte key encryption key
+func New(hexKey string) (*Keyring, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keyring{
+		aead:       aead,
+		signingKey: deriveKey(key, signingContext),
+		tokenKey:   deriveKey(key, tokenContext),
+	}, nil
+}
+
+// deriveKey derives the signing key for a context from the key encryption key
+func deriveKey(key []byte, context string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(context))
+	return mac.Sum(nil)
+}
+
+// Seal encrypts a key of a stream, returning the nonce followed by the
+// ciphertext. The stream's ID is authenticated with it, so a sealed key only
+// opens for the stream it was created for.
+func (k *Keyring) Seal(liveStreamID int, key []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, key, []byte(strconv.Itoa(liveStreamID))), nil
+}
+
+// Open decrypts a key sealed by Seal for the same stream
+func (k *Keyring) Open(liveStreamID int, sealedKey []byte) ([]byte, error) {
+	nonceSize := k.aead.NonceSize()
+	if len(sealedKey) < nonceSize {
+		return nil, errors.New("sealed key is too short")
+	}
+	return k.aead.Open(nil, sealedKey[:nonceSize], sealedKey[nonceSize:],
+		[]byte(strconv.Itoa(liveStreamID)))
+}
+
+// SignKeyURI returns the exp and sig query parameters that let a key URI of
+// a playback ID be fetched until expires
+func (k *Keyring) SignKeyURI(playbackID string, expires time.Time) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{
+		"exp": {exp},
+		"sig": {hex.EncodeToString(signature(k.signingKey, playbackID, exp))},
+	}
+}
+
+// VerifyKeyURI checks the exp and sig query parameters of a key URI of a
+// playback ID at now. It returns ErrInvalidSignature unless they were made
+// by SignKeyURI for that playback ID and have not expired.
+func (k *Keyring) VerifyKeyURI(playbackID string, query url.Values, now time.Time) error {
+	exp := query.Get("exp")
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sig, err := hex.DecodeString(query.Get("sig"))
+	if err != nil || !hmac.Equal(sig, signature(k.signingKey, playbackID, exp)) {
+		return ErrInvalidSignature
+	}
+	if now.Unix() >= expires {
+		return fmt.Errorf("%w: expired at %s", ErrInvalidSignature, time.Unix(expires, 0).UTC())
+	}
+	return nil
+}
+
+// SignPlaybackToken returns a token that lets viewers of a playback ID get
+// the key URIs of its encrypted playlists signed until expires. Players pass
+// it as the token query parameter of playlist requests.
+func (k *Keyring) SignPlaybackToken(playbackID string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + hex.EncodeToString(signature(k.tokenKey, playbackID, exp))
+}
+
+// VerifyPlaybackToken checks a playback token of a playback ID at now and
+// returns when it expires. It returns ErrInvalidToken unless the token was
+// made by SignPlaybackToken for that playback ID and has not expired.
+func (k *Keyring) VerifyPlaybackToken(playbackID, token string, now time.Time) (time.Time, error) {
+	exp, sigHex, ok := strings.Cut(token, ".")
+	if !ok {
+		return time.Time{}, ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil || !hmac.Equal(sig, signature(k.tokenKey, playbackID, exp)) {
+		return time.Time{}, ErrInvalidToken
+	}
+	if now.Unix() >= expires {
+		return time.Time{}, fmt.Errorf("%w: expired at %s", ErrInvalidToken, time.Unix(expires, 0).UTC())
+	}
+	return time.Unix(expires, 0), nil
+}
+
+// signature returns the HMAC under key of a playback ID and an expiry
+func signature(key []byte, playbackID, exp string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(playbackID + "\n" + exp))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,179 @@
+package keyseal
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func newTestKeyring(t *testing.T, hexKey string) *Keyring {
+	t.Helper()
+
+	keyring, err := New(hexKey)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return keyring
+}
+
+func TestNewRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"empty", ""},
+		{"not hex", strings.Repeat("zz", 32)},
+		{"16 bytes", testKey[:32]},
+		{"33 bytes", testKey + "20"},
+		{"odd length", testKey[:63]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("New(%q) error = %v, want ErrInvalidKey", tt.key, err)
+			}
+		})
+	}
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	keyring := newTestKeyring(t, testKey)
+	key := []byte("0123456789abcdef")
+
+	sealed, err := keyring.Seal(7, key)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if bytes.Contains(sealed, key) {
+		t.Error("sealed key contains the key")
+	}
+	// Every seal uses a fresh nonce
+	if again, _ := keyring.Seal(7, key); bytes.Equal(sealed, again) {
+		t.Error("sealing the same key twice gave the same output")
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name         string
+		keyring      *Keyring
+		liveStreamID int
+		sealed       []byte
+		wantErr      bool
+	}{
+		{"same stream", keyring, 7, sealed, false},
+		{"another stream", keyring, 8, sealed, true},
+		{"another key encryption key", newTestKeyring(t, strings.Repeat("ab", 32)), 7, sealed, true},
+		{"tampered", keyring, 7, tampered, true},
+		{"too short", keyring, 7, sealed[:4], true},
+		{"empty", keyring, 7, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened, err := tt.keyring.Open(tt.liveStreamID, tt.sealed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(opened, key) {
+				t.Errorf("Open() = %x, want %x", opened, key)
+			}
+		})
+	}
+}
+
+func TestVerifyKeyURI(t *testing.T) {
+	keyring := newTestKeyring(t, testKey)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	query := keyring.SignKeyURI("abc123", expires)
+
+	with := func(name, value string) url.Values {
+		changed := url.Values{"exp": {query.Get("exp")}, "sig": {query.Get("sig")}}
+		changed.Set(name, value)
+		return changed
+	}
+
+	tests := []struct {
+		name       string
+		keyring    *Keyring
+		playbackID string
+		query      url.Values
+		now        time.Time
+		wantErr    bool
+	}{
+		{"valid", keyring, "abc123", query, now, false},
+		{"just before expiry", keyring, "abc123", query, expires.Add(-time.Second), false},
+		{"at expiry", keyring, "abc123", query, expires, true},
+		{"another playback ID", keyring, "abc124", query, now, true},
+		{"another key encryption key", newTestKeyring(t, strings.Repeat("ab", 32)), "abc123", query, now, true},
+		{"extended expiry", keyring, "abc123", with("exp", "4102444800"), now, true},
+		{"malformed expiry", keyring, "abc123", with("exp", "soon"), now, true},
+		{"tampered signature", keyring, "abc123", with("sig", strings.Repeat("0", 64)), now, true},
+		{"signature not hex", keyring, "abc123", with("sig", "not-hex"), now, true},
+		{"no parameters", keyring, "abc123", url.Values{}, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.keyring.VerifyKeyURI(tt.playbackID, tt.query, tt.now)
+			if tt.wantErr && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifyKeyURI() error = %v, want ErrInvalidSignature", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("VerifyKeyURI() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyPlaybackToken(t *testing.T) {
+	keyring := newTestKeyring(t, testKey)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	token := keyring.SignPlaybackToken("abc123", expires)
+	exp, sig, _ := strings.Cut(token, ".")
+
+	// A key URI signature for the same playback ID and expiry
+	keyURI := keyring.SignKeyURI("abc123", expires)
+
+	tests := []struct {
+		name       string
+		keyring    *Keyring
+		playbackID string
+		token      string
+		now        time.Time
+		wantErr    bool
+	}{
+		{"valid", keyring, "abc123", token, now, false},
+		{"just before expiry", keyring, "abc123", token, expires.Add(-time.Second), false},
+		{"at expiry", keyring, "abc123", token, expires, true},
+		{"another playback ID", keyring, "abc124", token, now, true},
+		{"another key encryption key", newTestKeyring(t, strings.Repeat("ab", 32)), "abc123", token, now, true},
+		{"extended expiry", keyring, "abc123", "4102444800." + sig, now, true},
+		{"malformed expiry", keyring, "abc123", "soon." + sig, now, true},
+		{"signature not hex", keyring, "abc123", exp + ".not-hex", now, true},
+		{"key URI signature", keyring, "abc123", keyURI.Get("exp") + "." + keyURI.Get("sig"), now, true},
+		{"no separator", keyring, "abc123", exp + sig, now, true},
+		{"empty", keyring, "abc123", "", now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.keyring.VerifyPlaybackToken(tt.playbackID, tt.token, tt.now)
+			if tt.wantErr && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("VerifyPlaybackToken() error = %v, want ErrInvalidToken", err)
+			}
+			if !tt.wantErr && (err != nil || !got.Equal(expires)) {
+				t.Errorf("VerifyPlaybackToken() = %v, %v, want %v", got, err, expires)
+			}
+		})
+	}
+}
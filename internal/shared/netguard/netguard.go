@@ -0,0 +1,112 @@
+// Package netguard keeps outbound requests made on behalf of tenants, such
+// as webhook deliveries, away from the services' own network: loopback,
+// private, link-local (including cloud metadata endpoints) and other
+// non-public addresses. It is shared by the API, which checks URLs when they
+// are registered, and the encoder service, which checks every connection.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for URLs and connections that target a
+// non-public address
+var ErrForbiddenAddress = errors.New("address is not public")
+
+// nonPublicPrefixes are ranges that are not reachable on the public internet
+// and are not covered by the netip.Addr predicates used in IsPublic
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved, and broadcast
+	netip.MustParsePrefix("100::/64"),      // discard-only
+	netip.MustParsePrefix("fec0::/10"),     // deprecated site-local
+}
+
+// IsPublic reports whether addr is a public unicast address. IPv4-mapped
+// IPv6 addresses are judged by their IPv4 address.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL checks that rawURL is an absolute http or https URL whose host
+// only resolves to public addresses. DNS can change after the check, so
+// connections must still be made through a Dialer.
+func CheckURL(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+
+	host := target.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !IsPublic(addr) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, host, addr.Unmap())
+		}
+	}
+	return nil
+}
+
+// Dialer returns a dialer that refuses to connect to non-public addresses.
+// The address is checked after name resolution, right before connecting, so
+// DNS rebinding and redirects to internal hosts are refused too.
+func Dialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+			}
+			if !IsPublic(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr().Unmap())
+			}
+			return nil
+		},
+	}
+}
+
+// NewClient returns an HTTP client that only connects to public addresses.
+// It ignores proxy environment variables, which would otherwise make every
+// connection go to the proxy's address.
+func NewClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = Dialer(timeout).DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}